@@ -0,0 +1,93 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+	"github.com/Crowdstrike/foundry-sample-scalable-rtr/functions/Func_Jobs/api/models"
+	"github.com/crowdstrike/gofalcon/falcon/client"
+	"github.com/crowdstrike/gofalcon/falcon/client/user_management"
+)
+
+// authorizeEdit checks that the caller can modify the stored job, either as its owner, one of its editors or
+// through one of its editor roles. Only the owner can change who the editors are, so any user can modify a job
+// saved without an owner but not its editors. The updated job is nil when the job is deleted. Denied attempts are
+// recorded in the audit log.
+func authorizeEdit(ctx context.Context, caller models.Identity, previous, req *models.Job, conf *models.Config, client *client.CrowdStrikeAPISpecification) []fdk.APIError {
+	// callers which are not Falcon users, such as workflows, are not checked
+	if previous == nil || caller.System() {
+		return nil
+	}
+
+	if previous.IsOwner(caller) {
+		return nil
+	}
+	allowed := previous.Unowned() || previous.IsEditor(caller)
+	if !allowed && previous.Access != nil && len(previous.Access.EditorRoles) != 0 {
+		roles, errs := callerRoles(ctx, caller, client)
+		if len(errs) != 0 {
+			return errs
+		}
+		allowed = previous.HasEditorRole(roles)
+	}
+
+	reason := "only the owner and the editors can modify it"
+	if allowed {
+		if req == nil || !req.AccessChanged(previous) {
+			return nil
+		}
+		reason = "only the owner can change its editors"
+	}
+	return denyEdit(ctx, caller, previous, reason, conf, client)
+}
+
+// denyEdit records the denied attempt of the caller to modify the job and returns the access denied error.
+func denyEdit(ctx context.Context, caller models.Identity, job *models.Job, reason string, conf *models.Config, client *client.CrowdStrikeAPISpecification) []fdk.APIError {
+	denied := *job
+	now := time.Now()
+	denied.ModifiedBy = &caller
+	denied.UpdatedAt = &now
+
+	errs := []fdk.APIError{models.AccessDeniedError(caller, job, reason)}
+	return append(errs, auditLogProducer(ctx, JobAccessDenied, &denied, conf, client)...)
+}
+
+// callerRoles returns the IDs and names of the roles granted to the caller.
+func callerRoles(ctx context.Context, caller models.Identity, client *client.CrowdStrikeAPISpecification) ([]string, []fdk.APIError) {
+	params := user_management.NewCombinedUserRolesV1ParamsWithContext(ctx)
+	params.SetUserUUID(caller.UserID)
+	resp, err := client.UserManagement.CombinedUserRolesV1(params)
+	if err != nil {
+		return nil, []fdk.APIError{models.NewAPIError(http.StatusInternalServerError, fmt.Sprintf("failed to get the roles of user %s: %v", caller.UserName, err))}
+	}
+	if len(resp.GetPayload().Errors) != 0 {
+		return nil, convertMsaErrorsToAPIErrors(resp.GetPayload().Errors)
+	}
+
+	var roles []string
+	for _, r := range resp.GetPayload().Resources {
+		if r == nil {
+			continue
+		}
+		if r.RoleID != nil {
+			roles = append(roles, *r.RoleID)
+		}
+		if r.RoleName != "" {
+			roles = append(roles, r.RoleName)
+		}
+	}
+	return roles, nil
+}
+
+// errorCode returns 403 when any of the errors denies access, the fallback code otherwise.
+func errorCode(errs []fdk.APIError, fallback int) int {
+	for _, e := range errs {
+		if e.Code == http.StatusForbidden {
+			return http.StatusForbidden
+		}
+	}
+	return fallback
+}
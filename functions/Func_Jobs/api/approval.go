@@ -0,0 +1,141 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+	"github.com/Crowdstrike/foundry-sample-scalable-rtr/functions/Func_Jobs/api/models"
+	"github.com/crowdstrike/gofalcon/falcon/client"
+)
+
+// ReviewJobHandler approves or rejects a job pending approval. Approved jobs are provisioned.
+type ReviewJobHandler struct {
+	conf    *models.Config
+	upsert  *UpsertJobHandler
+	approve bool
+}
+
+func NewApproveJobHandler(conf *models.Config) *ReviewJobHandler {
+	return &ReviewJobHandler{
+		conf:    conf,
+		upsert:  NewUpsertJobHandler(conf),
+		approve: true,
+	}
+}
+
+func NewRejectJobHandler(conf *models.Config) *ReviewJobHandler {
+	return &ReviewJobHandler{
+		conf:   conf,
+		upsert: NewUpsertJobHandler(conf),
+	}
+}
+
+func (h *ReviewJobHandler) Handle(ctx context.Context, request fdk.Request) fdk.Response {
+	response := fdk.Response{}
+
+	var req models.ReviewJobRequest
+	err := json.NewDecoder(request.Body).Decode(&req)
+	if err != nil {
+		response.Code = http.StatusBadRequest
+		response.Errors = append(response.Errors, models.NewAPIError(http.StatusBadRequest, fmt.Sprintf("Failed to unmarshal Request body err: %v.", err)))
+		return response
+	}
+
+	if errs := req.Validate(); len(errs) != 0 {
+		response.Code = http.StatusBadRequest
+		response.Errors = errs
+		return response
+	}
+
+	client, err := models.FalconClient(ctx, h.conf, request)
+	if err != nil {
+		response.Code = http.StatusInternalServerError
+		response.Errors = append(response.Errors, fdk.APIError{Code: http.StatusBadRequest, Message: "fail to initialize client"})
+		return response
+	}
+
+	caller, errs := callerIdentity(ctx, request, client)
+	if len(errs) != 0 {
+		response.Code = errs[0].Code
+		response.Errors = errs
+		return response
+	}
+
+	result, code, errs := h.review(ctx, caller, &req, client)
+	if len(errs) != 0 {
+		response.Code = code
+		response.Errors = errs
+		return response
+	}
+
+	body, err := json.Marshal(result)
+	if err != nil {
+		response.Code = http.StatusInternalServerError
+		response.Errors = append(response.Errors, models.NewAPIError(http.StatusInternalServerError, fmt.Sprintf("failed to marshal the response body with err: %v", err)))
+		return response
+	}
+
+	response.Body = json.RawMessage(body)
+	response.Code = http.StatusOK
+	return response
+}
+
+// review records the approval or rejection of the job by the caller, who must not be the user who submitted it,
+// and provisions the job once approved. It returns the status code of the response along with any error.
+func (h *ReviewJobHandler) review(ctx context.Context, caller models.Identity, req *models.ReviewJobRequest, client *client.CrowdStrikeAPISpecification) (*models.ReviewJobResponse, int, []fdk.APIError) {
+	job, errs := storedJob(ctx, req.ID, h.conf, client)
+	if len(errs) != 0 {
+		return nil, http.StatusInternalServerError, errs
+	}
+	if job == nil {
+		return nil, http.StatusNotFound, []fdk.APIError{models.NewAPIError(http.StatusNotFound, fmt.Sprintf("job %s not found", req.ID))}
+	}
+	if job.Approval == nil || job.Approval.Status != models.ApprovalPending {
+		return nil, http.StatusConflict, []fdk.APIError{models.NewAPIError(http.StatusConflict, fmt.Sprintf("job %s is not pending approval", job.Name))}
+	}
+	if job.Approval.RequestedBy.UserID == caller.UserID {
+		return nil, http.StatusForbidden, denyEdit(ctx, caller, job, "the job must be reviewed by another user than the one who submitted it", h.conf, client)
+	}
+
+	now := time.Now()
+	reviewer := caller
+	job.Approval.ReviewedBy = &reviewer
+	job.Approval.ReviewedAt = &now
+	job.Approval.Comment = req.Comment
+
+	action := JobRejected
+	var runs []models.OnDemandRun
+	if h.approve {
+		action = JobApproved
+		job.Approval.Status = models.ApprovalApproved
+		var errs []fdk.APIError
+		if runs, errs = h.upsert.decorateRequest(ctx, false, job.ID, job, client); len(errs) != 0 {
+			return nil, errorCode(errs, http.StatusInternalServerError), errs
+		}
+	} else {
+		job.Approval.Status = models.ApprovalRejected
+		job.UpdatedAt = &now
+	}
+
+	jobID, errs := putJob(ctx, job, h.conf, client)
+	if len(errs) != 0 {
+		// the workflows provisioned on approval would run a job still saved as pending approval
+		return nil, http.StatusInternalServerError, append(errs, discardWorkflows(ctx, job.Workflows, nil, h.conf, client)...)
+	}
+	if errs := runNow(ctx, job, runs, h.conf, client); len(errs) != 0 {
+		return nil, errorCode(errs, http.StatusInternalServerError), errs
+	}
+
+	// the review is attributed to the reviewer, the job stays attributed to the user who submitted it
+	reviewed := *job
+	reviewed.ModifiedBy = &reviewer
+	if errs := auditLogProducer(ctx, action, &reviewed, h.conf, client); len(errs) != 0 {
+		return nil, http.StatusInternalServerError, errs
+	}
+
+	return &models.ReviewJobResponse{Resource: jobID}, http.StatusOK, nil
+}
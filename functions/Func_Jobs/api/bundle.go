@@ -0,0 +1,289 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+	"github.com/Crowdstrike/foundry-sample-scalable-rtr/functions/Func_Jobs/api/models"
+	"github.com/crowdstrike/gofalcon/falcon/client"
+)
+
+// maxRenameAttempts is the number of suffixed names tried when importing a job with the rename policy.
+const maxRenameAttempts = 100
+
+// ExportJobsHandler exports jobs as a versioned bundle.
+type ExportJobsHandler struct {
+	conf *models.Config
+}
+
+func NewExportJobsHandler(conf *models.Config) *ExportJobsHandler {
+	return &ExportJobsHandler{
+		conf: conf,
+	}
+}
+
+func (h *ExportJobsHandler) Handle(ctx context.Context, request fdk.Request) fdk.Response {
+	response := fdk.Response{}
+
+	client, err := models.FalconClient(ctx, h.conf, request)
+	if err != nil {
+		response.Code = http.StatusInternalServerError
+		response.Errors = append(response.Errors, fdk.APIError{Code: http.StatusBadRequest, Message: "fail to initialize client"})
+		return response
+	}
+
+	bundle, errs := h.export(ctx, request.Queries[queryIDParam], client)
+	if len(errs) != 0 {
+		response.Code = http.StatusInternalServerError
+		if errs[0].Code == http.StatusNotFound {
+			response.Code = http.StatusNotFound
+		}
+		response.Errors = errs
+		return response
+	}
+
+	body, err := json.Marshal(bundle)
+	if err != nil {
+		response.Code = http.StatusInternalServerError
+		response.Errors = append(response.Errors, models.NewAPIError(http.StatusInternalServerError, fmt.Sprintf("failed to marshal the response body with err: %v", err)))
+		return response
+	}
+
+	response.Body = json.RawMessage(body)
+	response.Code = http.StatusOK
+	return response
+}
+
+// export bundles the definitions of the given jobs, or of every job when no id is given.
+func (h *ExportJobsHandler) export(ctx context.Context, ids []string, client *client.CrowdStrikeAPISpecification) (*models.JobBundle, []fdk.APIError) {
+	if len(ids) == 0 {
+		var errs []fdk.APIError
+		ids, errs = allJobIDs(ctx, h.conf, client)
+		if len(errs) != 0 {
+			return nil, errs
+		}
+	}
+
+	exportedAt := time.Now().UTC()
+	bundle := models.JobBundle{
+		Version:    models.BundleVersion,
+		ExportedAt: &exportedAt,
+		Jobs:       make([]models.JobDefinition, 0, len(ids)),
+	}
+	for _, id := range dedupe(ids) {
+		job, errs := jobInfo(ctx, id, h.conf, client)
+		if len(errs) != 0 {
+			return nil, errs
+		}
+		if job.DeletedAt != nil {
+			continue
+		}
+		bundle.Jobs = append(bundle.Jobs, models.NewJobDefinition(job))
+	}
+	return &bundle, nil
+}
+
+// allJobIDs pages through the ids of every job.
+func allJobIDs(ctx context.Context, conf *models.Config, client *client.CrowdStrikeAPISpecification) ([]string, []fdk.APIError) {
+	fqlFilter, err := models.NewFQLQuery([]models.Filter{{Field: "created_at", Value: "0", Op: models.GTE}})
+	if err != nil {
+		return nil, []fdk.APIError{models.NewAPIError(http.StatusInternalServerError, fmt.Sprintf("error constructing FQL query: %v", err))}
+	}
+	fqlSort, err := models.NewFQLSort("created_at", models.Asc)
+	if err != nil {
+		return nil, []fdk.APIError{models.NewAPIError(http.StatusInternalServerError, fmt.Sprintf("error constructing FQL sort: %v", err))}
+	}
+
+	var ids []string
+	searchReq := models.SearchObjectsRequest{
+		Collection: conf.JobsCollection,
+		Filter:     fqlFilter,
+		Sort:       fqlSort,
+	}
+	for {
+		searchResponse, errs := search(ctx, searchReq, client)
+		if len(errs) != 0 {
+			return nil, errs
+		}
+		ids = append(ids, searchResponse.ObjectKeys...)
+		// the offset is only returned while there are more results
+		if searchResponse.Offset == 0 || len(searchResponse.ObjectKeys) == 0 {
+			return ids, nil
+		}
+		searchReq.Offset = searchResponse.Offset
+	}
+}
+
+// ImportJobsHandler creates or updates jobs from a bundle through the upsert of jobs.
+type ImportJobsHandler struct {
+	conf   *models.Config
+	upsert *UpsertJobHandler
+}
+
+func NewImportJobsHandler(conf *models.Config) *ImportJobsHandler {
+	return &ImportJobsHandler{
+		conf:   conf,
+		upsert: NewUpsertJobHandler(conf),
+	}
+}
+
+func (h *ImportJobsHandler) Handle(ctx context.Context, request fdk.Request) fdk.Response {
+	response := fdk.Response{}
+
+	var req models.ImportJobsRequest
+	err := json.NewDecoder(request.Body).Decode(&req)
+	if err != nil {
+		response.Code = http.StatusBadRequest
+		response.Errors = append(response.Errors, models.NewAPIError(http.StatusBadRequest, fmt.Sprintf("Failed to unmarshal Request body err: %v.", err)))
+		return response
+	}
+
+	if errs := req.Validate(); len(errs) != 0 {
+		response.Code = http.StatusBadRequest
+		response.Errors = errs
+		return response
+	}
+
+	client, err := models.FalconClient(ctx, h.conf, request)
+	if err != nil {
+		response.Code = http.StatusInternalServerError
+		response.Errors = append(response.Errors, fdk.APIError{Code: http.StatusBadRequest, Message: "fail to initialize client"})
+		return response
+	}
+
+	caller, errs := callerIdentity(ctx, request, client)
+	if len(errs) != 0 {
+		response.Code = errs[0].Code
+		response.Errors = errs
+		return response
+	}
+
+	result := h.importJobs(ctx, caller, &req, client)
+
+	body, err := json.Marshal(result)
+	if err != nil {
+		response.Code = http.StatusInternalServerError
+		response.Errors = append(response.Errors, models.NewAPIError(http.StatusInternalServerError, fmt.Sprintf("failed to marshal the response body with err: %v", err)))
+		return response
+	}
+
+	response.Body = json.RawMessage(body)
+	response.Code = http.StatusOK
+	return response
+}
+
+// importJobs imports every job of the bundle, a failing job does not stop the import of the others.
+func (h *ImportJobsHandler) importJobs(ctx context.Context, caller models.Identity, req *models.ImportJobsRequest, client *client.CrowdStrikeAPISpecification) *models.ImportJobsResponse {
+	response := models.ImportJobsResponse{Resources: make([]models.ImportResult, 0, len(req.Bundle.Jobs))}
+
+	// names taken by the bundle, so that renamed jobs do not collide with jobs imported after them
+	taken := make(map[string]bool, len(req.Bundle.Jobs))
+	for _, d := range req.Bundle.Jobs {
+		taken[d.Name] = true
+	}
+
+	for _, d := range req.Bundle.Jobs {
+		response.Resources = append(response.Resources, h.importJob(ctx, caller, req, d, taken, client))
+	}
+	return &response
+}
+
+func (h *ImportJobsHandler) importJob(ctx context.Context, caller models.Identity, req *models.ImportJobsRequest, d models.JobDefinition, taken map[string]bool, client *client.CrowdStrikeAPISpecification) models.ImportResult {
+	result := models.ImportResult{Name: d.Name}
+	failed := func(errs []fdk.APIError) models.ImportResult {
+		result.Status = models.ImportFailed
+		result.Errors = errs
+		return result
+	}
+
+	job := d.Job()
+
+	existing, errs := existingJob(ctx, d.Name, h.conf, client)
+	if len(errs) != 0 {
+		return failed(errs)
+	}
+
+	result.Status = models.ImportCreated
+	if existing != nil {
+		switch req.Conflict {
+		case models.ConflictSkip:
+			result.ID = existing.ID
+			result.Status = models.ImportSkipped
+			return result
+		case models.ConflictOverwrite:
+			carryOver(&job, existing)
+			result.Status = models.ImportUpdated
+		case models.ConflictRename:
+			name, errs := h.availableName(ctx, d.Name, taken, client)
+			if len(errs) != 0 {
+				return failed(errs)
+			}
+			taken[name] = true
+			job.Name = name
+			result.NewName = name
+			result.Status = models.ImportRenamed
+		}
+	}
+
+	upsertResult, errs := h.upsert.upsertJob(ctx, job.Draft, caller, &models.UpsertJobRequest{Job: job}, client)
+	if len(errs) != 0 {
+		return failed(errs)
+	}
+	result.ID = upsertResult.Resource
+	return result
+}
+
+// availableName suffixes the name of a job until it is neither used by an existing job nor by the bundle.
+func (h *ImportJobsHandler) availableName(ctx context.Context, name string, taken map[string]bool, client *client.CrowdStrikeAPISpecification) (string, []fdk.APIError) {
+	for i := 2; i <= maxRenameAttempts+1; i++ {
+		candidate := fmt.Sprintf("%s (%d)", name, i)
+		if taken[candidate] {
+			continue
+		}
+		existing, errs := existingJob(ctx, candidate, h.conf, client)
+		if len(errs) != 0 {
+			return "", errs
+		}
+		if existing == nil {
+			return candidate, nil
+		}
+	}
+	return "", []fdk.APIError{models.NewAPIError(http.StatusConflict, fmt.Sprintf("failed to find an available name for job: %s", name))}
+}
+
+// existingJob returns the job with the given name, or nil when there is none.
+func existingJob(ctx context.Context, name string, conf *models.Config, client *client.CrowdStrikeAPISpecification) (*models.Job, []fdk.APIError) {
+	fqlFilter, err := models.NewFQLQuery([]models.Filter{{Field: "name", Value: strings.ReplaceAll(name, "'", `\'`), Op: models.EQ}})
+	if err != nil {
+		return nil, []fdk.APIError{models.NewAPIError(http.StatusInternalServerError, fmt.Sprintf("error constructing FQL query: %v", err))}
+	}
+	searchResponse, errs := search(ctx, models.SearchObjectsRequest{Collection: conf.JobsCollection, Filter: fqlFilter}, client)
+	if len(errs) != 0 {
+		return nil, errs
+	}
+	for _, id := range searchResponse.ObjectKeys {
+		job, errs := storedJob(ctx, id, conf, client)
+		if len(errs) != 0 {
+			return nil, errs
+		}
+		if job != nil && job.Name == name {
+			return job, nil
+		}
+	}
+	return nil, nil
+}
+
+// carryOver keeps the identity and run history of an existing job when it is overwritten by a definition, its
+// workflows are replaced by the upsert.
+func carryOver(job *models.Job, existing *models.Job) {
+	job.ID = existing.ID
+	job.Version = existing.Version
+	job.CreatedAt = existing.CreatedAt
+	job.RunCount = existing.RunCount
+	job.LastRun = existing.LastRun
+}
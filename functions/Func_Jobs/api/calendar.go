@@ -0,0 +1,173 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+	"github.com/Crowdstrike/foundry-sample-scalable-rtr/functions/Func_Jobs/api/models"
+	"github.com/crowdstrike/gofalcon/falcon/client"
+)
+
+const (
+	queryFrom            = "from"
+	queryTo              = "to"
+	queryIntervalMinutes = "interval_minutes"
+	queryMaxHosts        = "max_hosts"
+)
+
+// CalendarHandler lists the scheduled runs of every job within a time window and flags the intervals in which
+// too many hosts are targeted.
+type CalendarHandler struct {
+	conf *models.Config
+}
+
+func NewCalendarHandler(conf *models.Config) *CalendarHandler {
+	return &CalendarHandler{
+		conf: conf,
+	}
+}
+
+func (h *CalendarHandler) Handle(ctx context.Context, request fdk.Request) fdk.Response {
+	response := fdk.Response{}
+
+	calendar, errs := h.calendarWindow(request.Queries, time.Now().UTC())
+	if len(errs) != 0 {
+		response.Code = http.StatusBadRequest
+		response.Errors = errs
+		return response
+	}
+
+	client, err := models.FalconClient(ctx, h.conf, request)
+	if err != nil {
+		response.Code = http.StatusInternalServerError
+		response.Errors = append(response.Errors, fdk.APIError{Code: http.StatusBadRequest, Message: "fail to initialize client"})
+		return response
+	}
+
+	if errs := h.calendar(ctx, calendar, client); len(errs) != 0 {
+		response.Code = http.StatusInternalServerError
+		response.Errors = errs
+		return response
+	}
+
+	body, err := json.Marshal(calendar)
+	if err != nil {
+		response.Code = http.StatusInternalServerError
+		response.Errors = append(response.Errors, models.NewAPIError(http.StatusInternalServerError, fmt.Sprintf("failed to marshal the response body with err: %v", err)))
+		return response
+	}
+
+	response.Body = json.RawMessage(body)
+	response.Code = http.StatusOK
+	return response
+}
+
+// calendarWindow returns an empty calendar for the window and the intervals of the query. The window defaults to
+// the week from now and hot spots default to intervals targeting more hosts than the policy allows for a job.
+func (h *CalendarHandler) calendarWindow(q url.Values, now time.Time) (*models.CalendarResponse, []fdk.APIError) {
+	var errs []fdk.APIError
+	calendar := &models.CalendarResponse{
+		From:            now,
+		IntervalMinutes: models.DefaultCalendarIntervalMinutes,
+		MaxHosts:        models.DefaultHotSpotHosts,
+		Occurrences:     make([]models.CalendarOccurrence, 0),
+		HotSpots:        make([]models.CalendarHotSpot, 0),
+	}
+	if h.conf.Policy.MaxHostsPerJob > 0 {
+		calendar.MaxHosts = h.conf.Policy.MaxHostsPerJob
+	}
+
+	if v := q.Get(queryFrom); v != "" {
+		from, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			errs = append(errs, models.NewAPIError(http.StatusBadRequest, fmt.Sprintf("from is not an RFC3339 time: %v", err)))
+		}
+		calendar.From = from.UTC()
+	}
+	calendar.To = calendar.From.AddDate(0, 0, models.DefaultCalendarDays)
+	if v := q.Get(queryTo); v != "" {
+		to, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			errs = append(errs, models.NewAPIError(http.StatusBadRequest, fmt.Sprintf("to is not an RFC3339 time: %v", err)))
+		}
+		calendar.To = to.UTC()
+	}
+	if !calendar.To.After(calendar.From) {
+		errs = append(errs, models.NewAPIError(http.StatusBadRequest, "to must be after from"))
+	} else if calendar.To.Sub(calendar.From) > models.MaxCalendarDays*24*time.Hour {
+		errs = append(errs, models.NewAPIError(http.StatusBadRequest, fmt.Sprintf("the calendar window cannot be longer than %d days", models.MaxCalendarDays)))
+	}
+
+	for _, p := range []struct {
+		name  string
+		value *int
+		max   int
+	}{{queryIntervalMinutes, &calendar.IntervalMinutes, models.MaxCalendarIntervalMinutes}, {queryMaxHosts, &calendar.MaxHosts, 0}} {
+		s := q.Get(p.name)
+		if s == "" {
+			continue
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			errs = append(errs, models.NewAPIError(http.StatusBadRequest, fmt.Sprintf("%s must be a positive integer: %s", p.name, s)))
+			continue
+		}
+		if p.max > 0 && n > p.max {
+			errs = append(errs, models.NewAPIError(http.StatusBadRequest, fmt.Sprintf("%s cannot be greater than %d", p.name, p.max)))
+			continue
+		}
+		*p.value = n
+	}
+	return calendar, errs
+}
+
+// calendar expands the schedules of every provisioned job which is neither a draft, deleted, archived nor awaiting
+// approval into the occurrences of the calendar window, and flags its hot spots.
+func (h *CalendarHandler) calendar(ctx context.Context, calendar *models.CalendarResponse, client *client.CrowdStrikeAPISpecification) []fdk.APIError {
+	ids, errs := allJobIDs(ctx, h.conf, client)
+	if len(errs) != 0 {
+		return errs
+	}
+
+	for _, id := range ids {
+		job, errs := jobInfo(ctx, id, h.conf, client)
+		if len(errs) != 0 {
+			return errs
+		}
+		if job.Draft || job.DeletedAt != nil || job.ArchivedAt != nil {
+			continue
+		}
+		// jobs awaiting approval or rejected are not provisioned, they do not run
+		if job.AwaitingApproval() || job.Workflows == nil {
+			continue
+		}
+		runs, truncated, err := job.ScheduledRuns(calendar.From, calendar.To, models.MaxCalendarOccurrencesPerJob)
+		if err != nil {
+			return []fdk.APIError{models.NewAPIError(http.StatusInternalServerError, fmt.Sprintf("failed to expand the schedule of job %s: %v", job.Name, err))}
+		}
+		for i, t := range runs {
+			calendar.Occurrences = append(calendar.Occurrences, models.CalendarOccurrence{
+				JobID:     id,
+				JobName:   job.Name,
+				Time:      t.UTC(),
+				HostCount: job.HostCount,
+				Link:      models.JobLink(id),
+				Truncated: truncated && i == len(runs)-1,
+			})
+		}
+	}
+
+	sort.SliceStable(calendar.Occurrences, func(i, k int) bool {
+		return calendar.Occurrences[i].Time.Before(calendar.Occurrences[k].Time)
+	})
+	interval := time.Duration(calendar.IntervalMinutes) * time.Minute
+	calendar.HotSpots = models.HotSpots(calendar.Occurrences, calendar.From, interval, calendar.MaxHosts)
+	return nil
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+	"github.com/Crowdstrike/foundry-sample-scalable-rtr/functions/Func_Jobs/api/models"
+	"github.com/crowdstrike/gofalcon/falcon/client"
+)
+
+// checkDownstream checks that the downstream jobs of a job exist and that following them never leads back to the
+// job, as job_history would otherwise start the jobs one after another forever.
+func checkDownstream(ctx context.Context, id string, req *models.Job, conf *models.Config, client *client.CrowdStrikeAPISpecification) []fdk.APIError {
+	type hop struct {
+		job  *models.Job
+		path []string
+	}
+	queue := []hop{{job: req, path: []string{req.Name}}}
+	visited := map[string]bool{id: true}
+	for len(queue) != 0 {
+		h := queue[0]
+		queue = queue[1:]
+		for _, d := range h.job.Downstream {
+			if d.JobID == id {
+				return []fdk.APIError{models.ChainCycleError(append(h.path, req.Name))}
+			}
+			if visited[d.JobID] {
+				continue
+			}
+			visited[d.JobID] = true
+
+			next, errs := storedJob(ctx, d.JobID, conf, client)
+			if len(errs) != 0 {
+				return errs
+			}
+			if next == nil {
+				// downstream jobs of other jobs deleted since are skipped by job_history
+				if h.job == req {
+					return []fdk.APIError{models.NewValidationError(models.InvalidDownstreamJob, fmt.Sprintf("downstream job %s does not exist", d.JobID))}
+				}
+				continue
+			}
+			queue = append(queue, hop{job: next, path: append(append([]string{}, h.path...), next.Name)})
+		}
+	}
+	return nil
+}
+
+// authorizeDownstream checks that the caller can modify every job directly downstream of the job, as job_history
+// runs them on the hosts the job picks. The downstream jobs which do not exist are rejected by checkDownstream.
+func authorizeDownstream(ctx context.Context, caller models.Identity, req *models.Job, conf *models.Config, client *client.CrowdStrikeAPISpecification) []fdk.APIError {
+	for _, d := range req.Downstream {
+		downstream, errs := storedJob(ctx, d.JobID, conf, client)
+		if len(errs) != 0 {
+			return errs
+		}
+		if errs := authorizeEdit(ctx, caller, downstream, nil, conf, client); len(errs) != 0 {
+			return errs
+		}
+	}
+	return nil
+}
+
+// jobLaunch returns how job_history starts a run of the job when it is downstream of another job.
+func jobLaunch(req *models.Job, conf *models.Config) (*models.JobLaunch, []fdk.APIError) {
+	kind, ok := models.LookupAction(req.Action.Type)
+	if !ok {
+		return nil, []fdk.APIError{models.NewAPIError(http.StatusInternalServerError, fmt.Sprintf("Handle type is incorrect %s", req.Action.Type.String()))}
+	}
+	templates, errs := kind.Templates(req, conf)
+	if len(errs) != 0 {
+		return nil, errs
+	}
+	return models.NewJobLaunch(req, templates, conf), nil
+}
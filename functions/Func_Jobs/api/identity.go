@@ -0,0 +1,72 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+	"github.com/Crowdstrike/foundry-sample-scalable-rtr/functions/Func_Jobs/api/models"
+	"github.com/crowdstrike/gofalcon/falcon/client"
+	"github.com/crowdstrike/gofalcon/falcon/client/user_management"
+	model "github.com/crowdstrike/gofalcon/falcon/models"
+	"github.com/go-openapi/runtime"
+)
+
+// callerIdentity resolves the Falcon user calling the function from the access token of the request.
+func callerIdentity(ctx context.Context, request fdk.Request, client *client.CrowdStrikeAPISpecification) (models.Identity, []fdk.APIError) {
+	subject, caller, errs := lookupCaller(ctx, request, client)
+	if len(errs) != 0 {
+		return models.Identity{}, errs
+	}
+	if caller == nil {
+		return models.Identity{}, []fdk.APIError{models.NewAPIError(http.StatusForbidden, fmt.Sprintf("the caller %s is not a Falcon user", subject))}
+	}
+	return *caller, nil
+}
+
+// actionCallerIdentity resolves the caller of a function which is also a workflow action. Callers which are not
+// Falcon users, such as the workflows running the action, are attributed to the workflow identity.
+func actionCallerIdentity(ctx context.Context, request fdk.Request, client *client.CrowdStrikeAPISpecification) (models.Identity, []fdk.APIError) {
+	_, caller, errs := lookupCaller(ctx, request, client)
+	if len(errs) != 0 {
+		return models.Identity{}, errs
+	}
+	if caller == nil {
+		return models.WorkflowIdentity, nil
+	}
+	return *caller, nil
+}
+
+// lookupCaller returns the subject of the access token of the request along with the Falcon user it identifies, nil
+// when the subject is not a Falcon user.
+func lookupCaller(ctx context.Context, request fdk.Request, client *client.CrowdStrikeAPISpecification) (string, *models.Identity, []fdk.APIError) {
+	subject, err := models.TokenSubject(request.AccessToken)
+	if err != nil {
+		return "", nil, []fdk.APIError{models.NewAPIError(http.StatusUnauthorized, fmt.Sprintf("failed to identify the caller: %v", err))}
+	}
+
+	params := user_management.NewRetrieveUsersGETV1ParamsWithContext(ctx)
+	params.SetBody(&model.MsaspecIdsRequest{Ids: []string{subject}})
+	resp, err := client.UserManagement.RetrieveUsersGETV1(params)
+	if err != nil {
+		// subjects which are not user UUIDs, such as API client IDs, are rejected by the lookup
+		var badRequest *user_management.RetrieveUsersGETV1BadRequest
+		var apiErr *runtime.APIError
+		if errors.As(err, &badRequest) || (errors.As(err, &apiErr) && apiErr.IsCode(http.StatusNotFound)) {
+			return subject, nil, nil
+		}
+		return subject, nil, []fdk.APIError{models.NewAPIError(http.StatusUnauthorized, fmt.Sprintf("failed to look up the caller %s: %v", subject, err))}
+	}
+	if len(resp.GetPayload().Errors) != 0 {
+		return subject, nil, convertMsaErrorsToAPIErrors(resp.GetPayload().Errors)
+	}
+
+	for _, u := range resp.GetPayload().Resources {
+		if u != nil && u.UUID == subject {
+			return subject, &models.Identity{UserID: u.UUID, UserName: u.UID}, nil
+		}
+	}
+	return subject, nil, nil
+}
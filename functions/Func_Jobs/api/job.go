@@ -79,6 +79,7 @@ func (h *JobHandler) job(ctx context.Context, id string, client *client.CrowdStr
 	if len(errs) != 0 {
 		return nil, errs
 	}
+	job.RedactSecrets()
 	result := models.JobResponse{
 		Resource: *job,
 	}
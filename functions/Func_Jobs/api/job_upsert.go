@@ -53,9 +53,17 @@ func (h *UpsertJobHandler) Handle(ctx context.Context, request fdk.Request) fdk.
 		return response
 	}
 
-	result, errs := h.upsertJob(ctx, isDraft, &req, client)
+	// the upsert is also a workflow action, the workflows running it are not Falcon users
+	caller, errs := actionCallerIdentity(ctx, request, client)
 	if len(errs) != 0 {
-		response.Code = http.StatusInternalServerError
+		response.Code = errs[0].Code
+		response.Errors = errs
+		return response
+	}
+
+	result, errs := h.upsertJob(ctx, isDraft, caller, &req, client)
+	if len(errs) != 0 {
+		response.Code = errorCode(errs, http.StatusInternalServerError)
 		response.Errors = errs
 		return response
 	}
@@ -72,31 +80,40 @@ func (h *UpsertJobHandler) Handle(ctx context.Context, request fdk.Request) fdk.
 	return response
 }
 
-// upsertJob saves a job to custom storage and may attempt to run or schedule the job if requested.
-func (h *UpsertJobHandler) upsertJob(ctx context.Context, isDraft bool, req *models.UpsertJobRequest, client *client.CrowdStrikeAPISpecification) (*models.UpsertJobResponse, []fdk.APIError) {
+// upsertJob saves a job to custom storage and may attempt to run or schedule the job if requested. The job is
+// attributed to the caller, whatever identity the request claims.
+func (h *UpsertJobHandler) upsertJob(ctx context.Context, isDraft bool, caller models.Identity, req *models.UpsertJobRequest, client *client.CrowdStrikeAPISpecification) (*models.UpsertJobResponse, []fdk.APIError) {
 	var errs []fdk.APIError
 	var err error
 
-	validationErr := req.Validate()
+	validationErr := req.Validate(h.conf)
 	if len(validationErr) != 0 {
 		return nil, validationErr
 	}
 
 	id := req.ID
 	if id == "" {
-		id, err = models.GenerateID(req.Name)
+		id, err = models.NewJobID()
 		if err != nil {
 			validationErr = append(validationErr, models.NewAPIError(http.StatusInternalServerError, fmt.Sprintf("failed to generate id for job: %s with err: %v", req.Name, err)))
 			return nil, validationErr
 		}
-		prevJob, errs := jobInfo(ctx, id, h.conf, client)
+	}
+
+	previous, errs := storedJob(ctx, id, h.conf, client)
+	if len(errs) != 0 {
+		return nil, errs
+	}
+	if req.ID != "" && previous == nil {
+		return nil, []fdk.APIError{models.NewAPIError(http.StatusNotFound, fmt.Sprintf("job %s not found", req.ID))}
+	}
+	// names are unique, a job is renamed to a name no other job uses
+	if previous == nil || previous.Name != req.Name {
+		sameName, errs := existingJob(ctx, req.Name, h.conf, client)
 		if len(errs) != 0 {
-			if errs[0].Code != http.StatusNotFound {
-				validationErr = append(validationErr, errs...)
-				return nil, errs
-			}
+			return nil, errs
 		}
-		if prevJob != nil {
+		if sameName != nil && sameName.ID != id {
 			validationErr = append(validationErr, fdk.APIError{
 				Code:    http.StatusBadRequest,
 				Message: fmt.Sprintf("job with name:%s already exist", req.Name),
@@ -104,8 +121,25 @@ func (h *UpsertJobHandler) upsertJob(ctx context.Context, isDraft bool, req *mod
 			return nil, validationErr
 		}
 	}
+	if errs := authorizeEdit(ctx, caller, previous, &req.Job, h.conf, client); len(errs) != 0 {
+		return nil, errs
+	}
+	stampIdentity(caller, previous, &req.Job)
+	keepStoredSettings(previous, &req.Job)
+	if errs := authorizeDownstream(ctx, caller, &req.Job, h.conf, client); len(errs) != 0 {
+		return nil, errs
+	}
 
-	decorateErr := h.decorateRequest(ctx, isDraft, id, &req.Job, client)
+	if errs := keepWebhookSecrets(previous, &req.Job); len(errs) != 0 {
+		return nil, errs
+	}
+
+	var previousWorkflows *models.WorkflowsInfo
+	if previous != nil {
+		previousWorkflows = previous.Workflows
+	}
+	h.requestApproval(isDraft, caller, &req.Job)
+	runs, decorateErr := h.decorateRequest(ctx, isDraft, id, &req.Job, client)
 	if len(decorateErr) != 0 {
 		validationErr = append(validationErr, decorateErr...)
 		return nil, validationErr
@@ -115,10 +149,30 @@ func (h *UpsertJobHandler) upsertJob(ctx context.Context, isDraft bool, req *mod
 	jobID, errs := putJob(ctx, &req.Job, h.conf, client)
 	if len(errs) != 0 {
 		validationErr = append(validationErr, errs...)
+		// the workflows just provisioned would run a job which was never saved
+		validationErr = append(validationErr, discardWorkflows(ctx, req.Workflows, previousWorkflows, h.conf, client)...)
 		//validationErr = append(validationErr, models.NewAPIError(http.StatusInternalServerError, multierror.Append(fmt.Errorf("failed to create job: %s id: %s, with ", req.Name, id), errs...).Error()))
 		return nil, validationErr
 	}
 
+	// the workflows of the previous version are replaced by the ones just provisioned
+	stale := staleWorkflows(previousWorkflows, req.Workflows)
+	errs = deprovisionWorkflows(ctx, stale, client)
+	if len(errs) != 0 {
+		validationErr = append(validationErr, errs...)
+		return nil, validationErr
+	}
+	errs = unindexWorkflows(ctx, stale, h.conf, client)
+	if len(errs) != 0 {
+		validationErr = append(validationErr, errs...)
+		return nil, validationErr
+	}
+
+	if errs := runNow(ctx, &req.Job, runs, h.conf, client); len(errs) != 0 {
+		validationErr = append(validationErr, errs...)
+		return nil, validationErr
+	}
+
 	action := JobEdited
 	if req.Version == 1 {
 		action = JobCreated
@@ -135,9 +189,111 @@ func (h *UpsertJobHandler) upsertJob(ctx context.Context, isDraft bool, req *mod
 	return &models.UpsertJobResponse{Resource: jobID}, nil
 }
 
-func (h *UpsertJobHandler) decorateRequest(ctx context.Context, isDraft bool, id string, req *models.Job, client *client.CrowdStrikeAPISpecification) []fdk.APIError {
-	if !isDraft {
-		req.RunNowSchedule, req.WSchedule = updateSchedule(req)
+// stampIdentity sets the owner of the job to the user who created it and its modifier to the caller. The owner of an
+// existing job is kept from the stored job, the identity sent by the client is never used. Jobs created by callers
+// which are not Falcon users are saved without an owner.
+func stampIdentity(caller models.Identity, previous *models.Job, req *models.Job) {
+	req.UserID, req.UserName = caller.UserID, caller.UserName
+	modifier := caller
+	req.ModifiedBy = &modifier
+	if previous == nil {
+		return
+	}
+	// jobs saved before identities were resolved server side stay without an owner
+	req.UserID, req.UserName = previous.UserID, previous.UserName
+}
+
+// keepStoredSettings sets the settings left out of an updated job to the settings saved with the job, so that
+// clients unaware of them, such as imports of job bundles, do not clear them. The missed runs flagged on the job
+// are always kept, while saving an archived job restores it. The workflows of a job are provisioned server side,
+// the workflows sent by the client and the time they were provisioned are never used.
+func keepStoredSettings(previous *models.Job, req *models.Job) {
+	req.MissedRuns = nil
+	req.ArchivedAt = nil
+	req.Workflows = nil
+	req.ProvisionedAt = nil
+	if previous == nil {
+		return
+	}
+	req.MissedRuns = previous.MissedRuns
+	// a job provisioned before stays provisioned since then, its runs are checked across saves
+	if previous.Workflows != nil {
+		req.ProvisionedAt = previous.ProvisionedAt
+		if req.ProvisionedAt == nil {
+			req.ProvisionedAt = previous.CreatedAt
+		}
+	}
+	if req.Access == nil {
+		req.Access = previous.Access
+	}
+	if req.Downstream == nil {
+		req.Downstream = previous.Downstream
+	}
+}
+
+// requestApproval holds back the provisioning of a job which must be approved by a second user. The workflows of
+// the previous version are deprovisioned until the new version is approved, an approval sent by the client is
+// never used.
+func (h *UpsertJobHandler) requestApproval(isDraft bool, caller models.Identity, req *models.Job) {
+	req.Approval = nil
+	if isDraft || !models.RequiresApproval(req, h.conf) {
+		return
+	}
+	now := time.Now()
+	req.Approval = &models.Approval{
+		Status:      models.ApprovalPending,
+		RequestedBy: caller,
+		RequestedAt: &now,
+	}
+	req.Workflows = nil
+	req.NextRun = nil
+}
+
+// keepWebhookSecrets sets the secrets left out of the webhooks of an updated job to the secrets saved with the
+// job, as secrets are never returned to the caller.
+func keepWebhookSecrets(previous *models.Job, req *models.Job) []fdk.APIError {
+	var validationErr []fdk.APIError
+	for _, u := range req.KeepWebhookSecrets(previous) {
+		validationErr = append(validationErr, models.NewValidationError(models.InvalidNotificationTarget, fmt.Sprintf("webhook secret is required: %s", u)))
+	}
+	return validationErr
+}
+
+// decorateRequest provisions the workflows of a job which is neither a draft nor awaiting approval. It returns the
+// runs which start a run now job, executed by runNow once the job is saved.
+func (h *UpsertJobHandler) decorateRequest(ctx context.Context, isDraft bool, id string, req *models.Job, client *client.CrowdStrikeAPISpecification) ([]models.OnDemandRun, []fdk.APIError) {
+	var errs []fdk.APIError
+	var runs []models.OnDemandRun
+	req.HostCount = len(req.Target.Hosts)
+	if len(req.Target.HostGroups) != 0 {
+		req.HostCount, errs = getDeviceCountForHostGroup(ctx, req.Target.HostGroups, client)
+		if len(errs) != 0 {
+			return nil, errs
+		}
+	}
+	if errs := h.conf.Policy.CheckHostCount(req.HostCount); len(errs) != 0 {
+		return nil, errs
+	}
+	if errs := checkDownstream(ctx, id, req, h.conf, client); len(errs) != 0 {
+		return nil, errs
+	}
+
+	// the launch is only saved with provisioned jobs, a launch sent by the client is never used
+	req.Launch = nil
+
+	if !isDraft && !req.AwaitingApproval() {
+		// drafts and jobs awaiting approval are not provisioned, they do not count as active jobs
+		if h.conf.Policy.MaxActiveJobsPerUser > 0 && req.UserID != "" {
+			activeJobs, errs := activeJobCount(ctx, req.UserID, id, h.conf, client)
+			if len(errs) != 0 {
+				return nil, errs
+			}
+			if errs := h.conf.Policy.CheckActiveJobs(req.UserID, activeJobs); len(errs) != 0 {
+				return nil, errs
+			}
+		}
+
+		req.WSchedule = updateSchedule(req)
 		var nextRun time.Time
 		var errNxt error
 
@@ -145,19 +301,19 @@ func (h *UpsertJobHandler) decorateRequest(ctx context.Context, isDraft bool, id
 
 		if req.RunNow {
 			recurrences = 1
-			nextRun, errNxt = models.NextRun(req.RunNowSchedule, time.Now().UTC())
-			if errNxt != nil {
-				err := models.NewAPIError(http.StatusInternalServerError, fmt.Sprintf("failed to get the next run time err: %v", errNxt))
-				return []fdk.APIError{err}
-			}
+			nextRun = time.Now().UTC()
 		}
 
-		// only if it has a schedule
-		if req.WSchedule != nil {
+		// a one-time schedule runs once, a recurring schedule each time its time cycle fires between start and end
+		if req.Schedule.Once() {
+			// validated with the job
+			nextRun, _ = req.Schedule.RunAtTime()
+			recurrences++
+		} else if req.WSchedule != nil {
 			nextRun, errNxt = models.NextRun(req.Schedule, time.Now().UTC())
 			if errNxt != nil {
 				err := models.NewAPIError(http.StatusInternalServerError, fmt.Sprintf("failed to get the next run time err: %v", errNxt))
-				return []fdk.APIError{err}
+				return nil, []fdk.APIError{err}
 			}
 
 			if req.Schedule.End == "" {
@@ -175,18 +331,54 @@ func (h *UpsertJobHandler) decorateRequest(ctx context.Context, isDraft bool, id
 
 		req.TotalRecurrences = recurrences
 
-		workflowIDs, errs := provisionWorkflowWithAct(ctx, req, h.conf, client)
+		req.Target.Platforms = req.Target.TargetPlatforms()
+		waves, errs := targetWaves(ctx, req.Target, client)
 		if len(errs) != 0 {
-			return errs
+			return nil, errs
+		}
+		req.Waves = 1
+		if len(waves) > 1 {
+			req.Waves = len(waves)
 		}
 
-		executionWorkflowID, errs := provisionWorkflowForExec(ctx, req, h.conf, workflowIDs, client)
+		workflowIDs, onDemandRuns, errs := provisionWorkflowWithAct(ctx, req, id, waves, h.conf, client)
 		if len(errs) != 0 {
-			return errs
+			return nil, errs
+		}
+
+		// the workflows provisioned before a failure are deprovisioned rather than left running. The executions of
+		// the on demand workflows of the app are reported by the Run now notifier workflow rather than by a notifier
+		// of the job.
+		provisioned := &models.WorkflowsInfo{ScheduleWorkflow: workflowIDs}
+		if len(workflowIDs) != 0 {
+			executionWorkflowID, errs := provisionWorkflowForExec(ctx, req, h.conf, workflowIDs, client)
+			if len(errs) != 0 {
+				return nil, append(errs, deprovisionWorkflows(ctx, provisioned, client)...)
+			}
+			provisioned.NotifierWorkflow = executionWorkflowID
 		}
 
-		req.Workflows = &models.WorkflowsInfo{ScheduleWorkflow: workflowIDs, NotifierWorkflow: executionWorkflowID}
+		req.Launch, errs = jobLaunch(req, h.conf)
+		if len(errs) != 0 {
+			return nil, append(errs, deprovisionWorkflows(ctx, provisioned, client)...)
+		}
+
+		if errs := indexWorkflows(ctx, id, provisioned, h.conf, client); len(errs) != 0 {
+			errs = append(errs, deprovisionWorkflows(ctx, provisioned, client)...)
+			return nil, append(errs, unindexWorkflows(ctx, provisioned, h.conf, client)...)
+		}
+		req.Workflows = provisioned
 		req.NextRun = &nextRun
+		if req.ProvisionedAt == nil {
+			now := time.Now()
+			req.ProvisionedAt = &now
+		}
+
+		// the executions of a run now job are saved by runNow once the job is saved
+		req.RunNowExecutionIDs = nil
+		runs = onDemandRuns
+	} else {
+		req.ProvisionedAt = nil
 	}
 
 	currTime := time.Now()
@@ -199,15 +391,23 @@ func (h *UpsertJobHandler) decorateRequest(ctx context.Context, isDraft bool, id
 	req.UpdatedAt = &currTime
 	req.Draft = isDraft
 
-	var errs []fdk.APIError
-	req.HostCount = len(req.Target.Hosts)
-	if len(req.Target.HostGroups) != 0 {
-		req.HostCount, errs = getDeviceCountForHostGroup(ctx, req.Target.HostGroups, client)
-		if len(errs) != 0 {
-			return errs
-		}
-	}
+	return runs, errs
+}
 
+// runNow starts a saved run now job and saves the IDs of its executions with it. The executions started before a
+// failure are saved as well, so that they are attributed to the job.
+func runNow(ctx context.Context, job *models.Job, runs []models.OnDemandRun, conf *models.Config, client *client.CrowdStrikeAPISpecification) []fdk.APIError {
+	if len(runs) == 0 {
+		return nil
+	}
+	executionIDs, errs := executeOnDemandRuns(ctx, runs, client)
+	if len(executionIDs) == 0 {
+		return errs
+	}
+	job.RunNowExecutionIDs = executionIDs
+	if _, putErrs := putJob(ctx, job, conf, client); len(putErrs) != 0 {
+		errs = append(errs, putErrs...)
+	}
 	return errs
 }
 
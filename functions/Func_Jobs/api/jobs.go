@@ -20,6 +20,8 @@ const (
 	queryNextOffset  = "next"
 	queryPrevOffset  = "prev"
 	queryParamFilter = "filter"
+	queryLifecycle   = "lifecycle"
+	queryArchived    = "include_archived"
 
 	nextPage = 1
 	prevPage = -1
@@ -116,6 +118,13 @@ func (h *JobsHandler) jobDetails(ctx context.Context, request *fdk.Request, clie
 		Value: "0",
 		Op:    models.GTE,
 	})
+	stateFilter, errs := lifecycleFilter(request.Queries.Get(queryLifecycle), request.Queries.Get(queryArchived))
+	if len(errs) != 0 {
+		return &response, errs
+	}
+	if stateFilter != nil {
+		filters = append(filters, *stateFilter)
+	}
 
 	fqlFilter, err := models.NewFQLQuery(filters)
 	if err != nil {
@@ -177,6 +186,7 @@ func (h *JobsHandler) jobDetails(ctx context.Context, request *fdk.Request, clie
 				errChan <- jobGetErr
 				return
 			}
+			job.RedactSecrets()
 			jobsDetail[count] = job
 		}(id, idx)
 	}
@@ -245,3 +255,25 @@ func getOffsetMeta(marker string) (int, int) {
 	offset, _ := strconv.Atoi(offsetMeta[0])
 	return offset, page
 }
+
+// lifecycleFilter returns the filter of the jobs on their lifecycle. Archived jobs are left out unless they are
+// asked for, by their lifecycle or by including them.
+func lifecycleFilter(lifecycle, includeArchived string) (*models.Filter, []fdk.APIError) {
+	if lifecycle != "" {
+		state, err := models.ParseLifecycleState(lifecycle)
+		if err != nil {
+			return nil, []fdk.APIError{{Code: http.StatusBadRequest, Message: err.Error()}}
+		}
+		return &models.Filter{Field: "lifecycle", Value: string(state)}, nil
+	}
+	if includeArchived != "" {
+		include, err := strconv.ParseBool(includeArchived)
+		if err != nil {
+			return nil, []fdk.APIError{{Code: http.StatusBadRequest, Message: fmt.Sprintf("include_archived is not a boolean: %v", err)}}
+		}
+		if include {
+			return nil, nil
+		}
+	}
+	return &models.Filter{Field: "lifecycle", Value: string(models.LifecycleArchived), Op: models.NEQ}, nil
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+	"github.com/Crowdstrike/foundry-sample-scalable-rtr/functions/Func_Jobs/api/models"
+	"github.com/crowdstrike/gofalcon/falcon/client"
+)
+
+// LifecycleHandler saves the lifecycle of every job whose lifecycle changed since it was saved, and archives the
+// jobs which completed or expired longer ago than the retention of the policy. It is run daily by the
+// Archive expired jobs workflow.
+type LifecycleHandler struct {
+	conf *models.Config
+}
+
+func NewLifecycleHandler(conf *models.Config) *LifecycleHandler {
+	return &LifecycleHandler{
+		conf: conf,
+	}
+}
+
+func (h *LifecycleHandler) Handle(ctx context.Context, request fdk.Request) fdk.Response {
+	response := fdk.Response{}
+
+	client, err := models.FalconClient(ctx, h.conf, request)
+	if err != nil {
+		response.Code = http.StatusInternalServerError
+		response.Errors = append(response.Errors, fdk.APIError{Code: http.StatusBadRequest, Message: "fail to initialize client"})
+		return response
+	}
+
+	result, errs := h.updateLifecycles(ctx, time.Now().UTC(), client)
+	if len(errs) != 0 {
+		response.Code = errorCode(errs, http.StatusInternalServerError)
+		response.Errors = errs
+		return response
+	}
+
+	body, err := json.Marshal(result)
+	if err != nil {
+		response.Code = http.StatusInternalServerError
+		response.Errors = append(response.Errors, models.NewAPIError(http.StatusInternalServerError, fmt.Sprintf("failed to marshal the response body with err: %v", err)))
+		return response
+	}
+
+	response.Body = json.RawMessage(body)
+	response.Code = http.StatusOK
+	return response
+}
+
+// updateLifecycles goes through every job, a job which cannot be read, saved or archived is reported with its
+// change and does not stop the others.
+func (h *LifecycleHandler) updateLifecycles(ctx context.Context, now time.Time, client *client.CrowdStrikeAPISpecification) (*models.LifecycleResponse, []fdk.APIError) {
+	ids, errs := allJobIDs(ctx, h.conf, client)
+	if len(errs) != 0 {
+		return nil, errs
+	}
+
+	result := &models.LifecycleResponse{Resources: make([]models.LifecycleChange, 0)}
+	for _, id := range ids {
+		job, errs := fetchJob(ctx, id, h.conf, client)
+		if len(errs) != 0 {
+			if errs[0].Code != http.StatusNotFound {
+				result.Resources = append(result.Resources, models.LifecycleChange{ID: id, Errors: errs})
+			}
+			continue
+		}
+		if job.DeletedAt != nil {
+			continue
+		}
+
+		change := models.LifecycleChange{
+			ID:   id,
+			Name: job.Name,
+			From: job.Lifecycle,
+			To:   job.LifecycleAt(now),
+		}
+		if h.conf.Policy.ArchiveDue(job, now) {
+			change.To = models.LifecycleArchived
+			change.Errors = archiveJob(ctx, job, now, h.conf, client)
+		} else if change.To != change.From {
+			_, change.Errors = putJob(ctx, job, h.conf, client)
+		} else {
+			continue
+		}
+		result.Resources = append(result.Resources, change)
+	}
+	return result, nil
+}
+
+// archiveJob deprovisions the workflows of a job, along with its pending runs downstream of other jobs, and saves it
+// as archived. The launch is cleared so that job_history no longer starts it downstream of other jobs.
+func archiveJob(ctx context.Context, job *models.Job, now time.Time, conf *models.Config, client *client.CrowdStrikeAPISpecification) []fdk.APIError {
+	if errs := deprovisionChainedRuns(ctx, job, conf, client); len(errs) != 0 {
+		return errs
+	}
+	if errs := deprovisionWorkflows(ctx, job.Workflows, client); len(errs) != 0 {
+		return errs
+	}
+	if errs := unindexWorkflows(ctx, job.Workflows, conf, client); len(errs) != 0 {
+		return errs
+	}
+
+	job.Workflows = nil
+	job.Launch = nil
+	job.ProvisionedAt = nil
+	job.NextRun = nil
+	job.ArchivedAt = &now
+	if _, errs := putJob(ctx, job, conf, client); len(errs) != 0 {
+		return errs
+	}
+
+	// the job is archived by the retention of the policy rather than by a user
+	audited := *job
+	audited.UpdatedAt = &now
+	audited.ModifiedBy = &models.Identity{}
+	return auditLogProducer(ctx, JobArchived, &audited, conf, client)
+}
@@ -0,0 +1,95 @@
+package models
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+)
+
+// JobAccess lists the users and roles allowed to modify a job besides its owner. Any user of the app can view
+// every job.
+type JobAccess struct {
+	Editors     []string `json:"editors,omitempty" description:"Editors is the list of UUIDs of the users who can modify the job."`
+	EditorRoles []string `json:"editor_roles,omitempty" description:"EditorRoles is the list of IDs or names of the roles whose users can modify the job."`
+}
+
+func (a *JobAccess) validate() []fdk.APIError {
+	var errs []fdk.APIError
+	for _, e := range append(append([]string{}, a.Editors...), a.EditorRoles...) {
+		if strings.TrimSpace(e) == "" {
+			errs = append(errs, NewValidationError(InvalidJobAccess, "editors and editor roles cannot be empty"))
+			break
+		}
+	}
+	return errs
+}
+
+// IsOwner reports whether the user owns the job. Jobs saved without an owner are owned by no user.
+func (j *Job) IsOwner(user Identity) bool {
+	return j.UserID != "" && j.UserID == user.UserID
+}
+
+// Unowned reports whether the job was saved before jobs had an owner. Any user can modify it, while its editors
+// cannot be changed.
+func (j *Job) Unowned() bool {
+	return j.UserID == ""
+}
+
+// IsEditor reports whether the user is one of the editors of the job.
+func (j *Job) IsEditor(user Identity) bool {
+	if j.Access == nil {
+		return false
+	}
+	for _, e := range j.Access.Editors {
+		if e == user.UserID {
+			return true
+		}
+	}
+	return false
+}
+
+// HasEditorRole reports whether any of the roles, given by ID or name, is an editor role of the job.
+func (j *Job) HasEditorRole(roles []string) bool {
+	if j.Access == nil {
+		return false
+	}
+	for _, r := range j.Access.EditorRoles {
+		for _, role := range roles {
+			if strings.EqualFold(r, role) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// AccessChanged reports whether the job changes the access of the previous version, which only its owner can do.
+// A job without access keeps the access of the previous version.
+func (j *Job) AccessChanged(previous *Job) bool {
+	if j.Access == nil {
+		return false
+	}
+	var current JobAccess
+	if previous.Access != nil {
+		current = *previous.Access
+	}
+	return !reflect.DeepEqual(normalizeAccess(*j.Access), normalizeAccess(current))
+}
+
+func normalizeAccess(a JobAccess) JobAccess {
+	if len(a.Editors) == 0 {
+		a.Editors = nil
+	}
+	if len(a.EditorRoles) == 0 {
+		a.EditorRoles = nil
+	}
+	return a
+}
+
+// AccessDeniedError is returned when the user is not allowed to modify the job.
+func AccessDeniedError(user Identity, j *Job, reason string) fdk.APIError {
+	return NewAPIError(http.StatusForbidden, fmt.Sprintf("user %s is not allowed to modify job %s: %s", user.UserName, j.Name, reason))
+}
@@ -0,0 +1,262 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+)
+
+// ActionTemplate is a workflow template configured for the action of a job on a single platform.
+type ActionTemplate struct {
+	// Platform is the platform targeted by the workflow.
+	Platform Platform
+	// Name is the name of the workflow template.
+	Name string
+	// ConditionNodeID is the condition node filtering the targeted hosts.
+	ConditionNodeID string
+	// ActivityNodeID is the node running the RTR script.
+	ActivityNodeID string
+	// Properties are the parameters of the node running the RTR script.
+	Properties interface{}
+}
+
+// OnDemandRun is a run of the on demand workflow of an action template, started by a run now job.
+type OnDemandRun struct {
+	// Name is the name of the on demand workflow.
+	Name string
+	// Inputs are the inputs of the trigger of the workflow.
+	Inputs map[string]interface{}
+}
+
+// NewOnDemandRun returns the run of the on demand twin of the template for the given 1-based wave of a job, which
+// targets the given devices.
+func NewOnDemandRun(jobID string, wave int, t ActionTemplate, deviceIDs []string) (OnDemandRun, error) {
+	inputs := make(map[string]interface{})
+	b, err := json.Marshal(t.Properties)
+	if err != nil {
+		return OnDemandRun{}, err
+	}
+	if err := json.Unmarshal(b, &inputs); err != nil {
+		return OnDemandRun{}, fmt.Errorf("properties of template %s are not an object: %w", t.Name, err)
+	}
+	inputs["job_id"] = jobID
+	inputs["wave"] = wave
+	inputs["platform"] = string(t.Platform)
+	inputs["device_ids"] = deviceIDs
+	return OnDemandRun{Name: OnDemandTemplateName(t.Name), Inputs: inputs}, nil
+}
+
+// ActionKind implements a type of job action. Adding an action type means registering an implementation
+// with RegisterAction rather than editing the validation and provisioning of jobs.
+type ActionKind interface {
+	// Validate checks the configuration of the action of a job targeting the given platforms.
+	Validate(action *RTRAction, platforms []Platform) []fdk.APIError
+	// Templates returns the workflow templates provisioned for the job, one per targeted platform.
+	Templates(job *Job, conf *Config) ([]ActionTemplate, []fdk.APIError)
+	// Paths returns the file paths and the registry keys on hosts the action reads, writes or removes, which the
+	// job policy restricts.
+	Paths(action *RTRAction, conf *Config) (filePaths []string, registryKeys []string)
+}
+
+var actionKinds = make(map[ActionType]ActionKind)
+
+func init() {
+	RegisterAction(BuildQuery, buildQueryKind{})
+	RegisterAction(RunScript, runScriptKind{})
+	RegisterAction(Steps, stepsKind{})
+	RegisterAction(HashFile, fileKind{actionType: HashFile, operations: []string{OperationHashFile}})
+	RegisterAction(RemoveFile, fileKind{actionType: RemoveFile, operations: []string{OperationRemoveFile, OperationVerifyRemoved}, disruptive: true})
+}
+
+// RegisterAction registers the implementation of an action type, replacing any previous implementation.
+func RegisterAction(actionType ActionType, kind ActionKind) {
+	actionKinds[actionType] = kind
+}
+
+// LookupAction returns the implementation of an action type.
+func LookupAction(actionType ActionType) (ActionKind, bool) {
+	kind, ok := actionKinds[actionType]
+	return kind, ok
+}
+
+// buildQueryKind checks for files, registry keys, processes or services.
+type buildQueryKind struct{}
+
+func (buildQueryKind) Validate(action *RTRAction, platforms []Platform) []fdk.APIError {
+	return action.BuildQueryAction.validate(platforms)
+}
+
+func (buildQueryKind) Templates(job *Job, conf *Config) ([]ActionTemplate, []fdk.APIError) {
+	action := job.Action.BuildQueryAction
+	switch action.QueryType {
+	case RegistryKey:
+		var keys, values, valueNames, valueTypes, operators, data []string
+		for _, registryKeyVal := range action.RegistryKeys {
+			keys = append(keys, registryKeyVal.Key)
+			values = append(values, registryKeyVal.Value)
+			valueNames = append(valueNames, registryKeyVal.ValueName)
+			valueTypes = append(valueTypes, string(registryKeyVal.ValueType))
+			operators = append(operators, string(registryKeyVal.Operator))
+			data = append(data, registryKeyVal.NormalizedData())
+		}
+		return []ActionTemplate{{
+			Platform:        Windows,
+			Name:            conf.Templates.RegistryQuery.Name,
+			ConditionNodeID: conf.Templates.RegistryQuery.ConditionNodeID,
+			ActivityNodeID:  conf.Templates.RegistryQuery.ActivityNodeID,
+			Properties: map[string][]string{
+				"keys":        keys,
+				"values":      values,
+				"value_names": valueNames,
+				"value_types": valueTypes,
+				"operators":   operators,
+				"data":        data,
+			},
+		}}, nil
+	case Process, Service:
+		var names, paths, states []string
+		for _, ps := range action.PresenceSearches() {
+			names = append(names, ps.Name)
+			paths = append(paths, ps.Path)
+			states = append(states, string(ps.State))
+		}
+		t := conf.Templates.ProcessServiceQuery
+		return []ActionTemplate{{
+			Platform:        Windows,
+			Name:            t.Name,
+			ConditionNodeID: t.ConditionNodeID,
+			ActivityNodeID:  t.ActivityNodeID,
+			Properties: map[string]interface{}{
+				"kind":   action.QueryType.String(),
+				"names":  names,
+				"paths":  paths,
+				"states": states,
+			},
+		}}, nil
+	}
+
+	var templates []ActionTemplate
+	hashes, sizes, versions := action.ExpectedFileAttributes()
+	for _, platform := range job.Target.TargetPlatforms() {
+		t, ok := conf.FileExistTemplate(platform)
+		if !ok {
+			return nil, []fdk.APIError{{
+				Code:    http.StatusInternalServerError,
+				Message: fmt.Sprintf("no file query workflow template configured for platform %s", platform),
+			}}
+		}
+		properties := map[string]interface{}{
+			"keys": action.QueryFilePaths,
+		}
+		if len(action.FileAttributes) != 0 {
+			properties["sha256"] = hashes
+			properties["size"] = sizes
+			// PE file versions are only matched on windows
+			if platform == Windows {
+				properties["version"] = versions
+			}
+		}
+		templates = append(templates, ActionTemplate{
+			Platform:        platform,
+			Name:            t.Name,
+			ConditionNodeID: t.ConditionNodeID,
+			ActivityNodeID:  t.ActivityNodeID,
+			Properties:      properties,
+		})
+	}
+	return templates, nil
+}
+
+func (buildQueryKind) Paths(action *RTRAction, _ *Config) ([]string, []string) {
+	filePaths := append([]string{}, action.QueryFilePaths...)
+	for _, fa := range action.FileAttributes {
+		filePaths = append(filePaths, fa.Path)
+	}
+	for _, ps := range action.PresenceSearches() {
+		if ps.Path != "" {
+			filePaths = append(filePaths, ps.Path)
+		}
+	}
+	var registryKeys []string
+	for _, k := range action.RegistryKeys {
+		registryKeys = append(registryKeys, k.Key)
+	}
+	return filePaths, registryKeys
+}
+
+// runScriptKind runs any RTR script of the app which has a workflow template.
+type runScriptKind struct{}
+
+func (runScriptKind) Validate(action *RTRAction, _ []Platform) []fdk.APIError {
+	return action.RunScriptAction.validate()
+}
+
+func (runScriptKind) Templates(job *Job, conf *Config) ([]ActionTemplate, []fdk.APIError) {
+	action := job.Action.RunScriptAction
+	t, ok := conf.ScriptTemplate(action.ScriptName)
+	if !ok {
+		return nil, []fdk.APIError{NewValidationError(InvalidScriptParameters, fmt.Sprintf("no workflow template runs script %s", action.ScriptName))}
+	}
+	for _, platform := range job.Target.TargetPlatforms() {
+		if platform != t.Platform {
+			return nil, []fdk.APIError{NewValidationError(InvalidJobTarget, fmt.Sprintf("script %s only runs on %s hosts: %s", action.ScriptName, t.Platform, platform))}
+		}
+	}
+	params, err := action.ParameterMap()
+	if err != nil {
+		return nil, []fdk.APIError{NewValidationError(InvalidScriptParameters, err.Error())}
+	}
+	return []ActionTemplate{{
+		Platform:        t.Platform,
+		Name:            t.Name,
+		ConditionNodeID: t.ConditionNodeID,
+		ActivityNodeID:  t.ActivityNodeID,
+		Properties:      params,
+	}}, nil
+}
+
+// Paths returns the values of the path parameters of the script, the values starting with a registry hive are
+// registry keys.
+func (runScriptKind) Paths(action *RTRAction, conf *Config) ([]string, []string) {
+	t, ok := conf.ScriptTemplate(action.RunScriptAction.ScriptName)
+	if !ok {
+		return nil, nil
+	}
+	// invalid parameters are reported by the validation of the action
+	params, err := action.ParameterMap()
+	if err != nil {
+		return nil, nil
+	}
+	var filePaths, registryKeys []string
+	for _, name := range t.PathParameters {
+		var values []interface{}
+		switch v := params[name].(type) {
+		case string:
+			values = []interface{}{v}
+		case []interface{}:
+			values = v
+		}
+		for _, v := range values {
+			s, ok := v.(string)
+			if !ok || strings.TrimSpace(s) == "" {
+				continue
+			}
+			if isRegistryKey(s) {
+				registryKeys = append(registryKeys, s)
+			} else {
+				filePaths = append(filePaths, s)
+			}
+		}
+	}
+	return filePaths, registryKeys
+}
+
+// Disruptive reports whether the script may change the hosts, scripts are disruptive unless the manifest of the app
+// declares them read-only.
+func (runScriptKind) Disruptive(action *RTRAction, conf *Config) bool {
+	t, ok := conf.ScriptTemplate(action.RunScriptAction.ScriptName)
+	return !ok || !t.ReadOnly()
+}
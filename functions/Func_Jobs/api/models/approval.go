@@ -0,0 +1,80 @@
+package models
+
+import (
+	"net/http"
+	"time"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+)
+
+// ApprovalStatus is the state of the review of a job which requires approval before it is provisioned.
+type ApprovalStatus string
+
+const (
+	// ApprovalPending jobs are stored but not provisioned until a second user approves them.
+	ApprovalPending ApprovalStatus = "pending"
+	// ApprovalApproved jobs were provisioned once approved.
+	ApprovalApproved ApprovalStatus = "approved"
+	// ApprovalRejected jobs are not provisioned, they go back to pending when updated.
+	ApprovalRejected ApprovalStatus = "rejected"
+)
+
+// DisruptiveAction is implemented by the action kinds which change hosts. Jobs of a disruptive action are
+// approved by a second user before they are provisioned.
+type DisruptiveAction interface {
+	// Disruptive reports whether the action changes the hosts it runs on.
+	Disruptive(action *RTRAction, conf *Config) bool
+}
+
+// Approval records the request to provision a job and its review.
+type Approval struct {
+	Status      ApprovalStatus `json:"status" description:"Status is pending, approved or rejected."`
+	RequestedBy Identity       `json:"requested_by" description:"RequestedBy is the user who submitted the job for approval."`
+	RequestedAt *time.Time     `json:"requested_at,omitempty" description:"RequestedAt is the time at which the job was submitted for approval."`
+	ReviewedBy  *Identity      `json:"reviewed_by,omitempty" description:"ReviewedBy is the user who approved or rejected the job."`
+	ReviewedAt  *time.Time     `json:"reviewed_at,omitempty" description:"ReviewedAt is the time at which the job was approved or rejected."`
+	Comment     string         `json:"comment,omitempty" description:"Comment is the comment of the reviewer."`
+}
+
+// RequiresApproval reports whether the job must be approved by a second user before it is provisioned, either
+// because its action is disruptive or because the job policy requires it for the type of its action.
+func RequiresApproval(j *Job, conf *Config) bool {
+	if j.Action == nil {
+		return false
+	}
+	if kind, ok := LookupAction(j.Action.Type); ok {
+		if d, ok := kind.(DisruptiveAction); ok && d.Disruptive(j.Action, conf) {
+			return true
+		}
+	}
+	for _, t := range conf.Policy.ApprovalRequiredActions {
+		if t == j.Action.Type {
+			return true
+		}
+	}
+	return false
+}
+
+// AwaitingApproval reports whether the job is waiting to be approved or was rejected, it is not provisioned.
+func (j *Job) AwaitingApproval() bool {
+	return j.Approval != nil && j.Approval.Status != ApprovalApproved
+}
+
+// ReviewJobRequest approves or rejects a job pending approval.
+type ReviewJobRequest struct {
+	ID      string `json:"id" description:"ID identifies the job to review."`
+	Comment string `json:"comment,omitempty" description:"Comment is the comment of the reviewer."`
+}
+
+func (r *ReviewJobRequest) Validate() []fdk.APIError {
+	var errs []fdk.APIError
+	if r.ID == "" {
+		errs = append(errs, NewAPIError(http.StatusBadRequest, "job id cannot be empty"))
+	}
+	return errs
+}
+
+// ReviewJobResponse holds the id of the reviewed job.
+type ReviewJobResponse struct {
+	Resource string `json:"resource" description:"Resource is the id of the reviewed job."`
+}
@@ -0,0 +1,143 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+)
+
+// BundleVersion is the version of the job bundle format written by the export.
+const BundleVersion = 1
+
+// ConflictPolicy determines what an import does with a job whose name already exists.
+type ConflictPolicy string
+
+const (
+	// ConflictSkip leaves the existing job untouched.
+	ConflictSkip ConflictPolicy = "skip"
+	// ConflictOverwrite updates the existing job with the imported definition.
+	ConflictOverwrite ConflictPolicy = "overwrite"
+	// ConflictRename creates the imported job under a new name.
+	ConflictRename ConflictPolicy = "rename"
+)
+
+// ImportStatus is the outcome of importing a single job.
+type ImportStatus string
+
+const (
+	ImportCreated ImportStatus = "created"
+	ImportUpdated ImportStatus = "updated"
+	ImportRenamed ImportStatus = "renamed"
+	ImportSkipped ImportStatus = "skipped"
+	ImportFailed  ImportStatus = "failed"
+)
+
+// JobBundle is a versioned set of job definitions, exported from one tenant and imported into another.
+type JobBundle struct {
+	Version    int             `json:"version" description:"Version is the version of the bundle format."`
+	ExportedAt *time.Time      `json:"exported_at,omitempty" description:"ExportedAt indicates the time at which the bundle was exported."`
+	Jobs       []JobDefinition `json:"jobs" description:"Jobs is the list of exported job definitions."`
+}
+
+// JobDefinition holds the portable fields of a job. Runtime fields like the provisioned workflows, the run
+// count and the next run, as well as the identity and history of the job, are left out.
+type JobDefinition struct {
+	Name                string               `json:"name" description:"Name is the name of the job."`
+	Description         string               `json:"description,omitempty" description:"Description is the description of the job."`
+	Draft               bool                 `json:"draft" description:"Draft indicates if the the job provisioned or not."`
+	Notifications       []string             `json:"notifications" description:"Notifications is a list of email addresses to notify regarding this job."`
+	NotificationTargets []NotificationTarget `json:"notification_targets,omitempty" description:"NotificationTargets is a list of email and webhook targets, webhook secrets are not exported."`
+	NotificationRules   []NotificationRule   `json:"notification_rules,omitempty" description:"NotificationRules restricts notifications to the executions matching any of the rules."`
+	HostTagging         *HostTagging         `json:"host_tagging,omitempty" description:"HostTagging tags the hosts by their result once an execution completes."`
+	Tags                []string             `json:"tags" description:"Tags is a list of tags to assign to this job."`
+	Action              *RTRAction           `json:"action" description:"Action contains information about the RTR activity of the job."`
+	Schedule            *Schedule            `json:"schedule" description:"Schedule defines when this job should execute."`
+	Target              *TargetHost          `json:"target" description:"Target defines the systems against which the action should be performed."`
+	RunNow              bool                 `json:"run_now" description:"Indicates if we need to run the workflow now."`
+	OutputFormat        []string             `json:"output_format" description:"OutputFormat determines the user expecting the output format to be in."`
+}
+
+// NewJobDefinition returns the portable definition of a job.
+func NewJobDefinition(job *Job) JobDefinition {
+	return JobDefinition{
+		Name:                job.Name,
+		Description:         job.Description,
+		Draft:               job.Draft,
+		Notifications:       job.Notifications,
+		NotificationTargets: RedactTargets(job.NotificationTargets),
+		NotificationRules:   job.NotificationRules,
+		HostTagging:         job.HostTagging,
+		Tags:                job.Tags,
+		Action:              job.Action,
+		Schedule:            job.Schedule,
+		Target:              job.Target,
+		RunNow:              job.RunNow,
+		OutputFormat:        job.OutputFormat,
+	}
+}
+
+// Job returns a new job from the definition, to be saved through the upsert.
+func (d JobDefinition) Job() Job {
+	return Job{
+		Name:                d.Name,
+		Description:         d.Description,
+		Draft:               d.Draft,
+		Notifications:       d.Notifications,
+		NotificationTargets: d.NotificationTargets,
+		NotificationRules:   d.NotificationRules,
+		HostTagging:         d.HostTagging,
+		Tags:                d.Tags,
+		Action:              d.Action,
+		Schedule:            d.Schedule,
+		Target:              d.Target,
+		RunNow:              d.RunNow,
+		OutputFormat:        d.OutputFormat,
+	}
+}
+
+// ImportJobsRequest holds a bundle of jobs to create or update.
+type ImportJobsRequest struct {
+	Conflict ConflictPolicy `json:"conflict,omitempty" description:"Conflict is skip, overwrite or rename, defaults to skip."`
+	Bundle   JobBundle      `json:"bundle" description:"Bundle is the exported bundle of jobs."`
+}
+
+// ImportJobsResponse holds the outcome of every job of an imported bundle, in the order of the bundle.
+type ImportJobsResponse struct {
+	Resources []ImportResult `json:"resources" description:"Resources is the outcome of every imported job."`
+}
+
+// ImportResult is the outcome of importing a single job.
+type ImportResult struct {
+	Name    string         `json:"name" description:"Name is the name of the job in the bundle."`
+	ID      string         `json:"id,omitempty" description:"ID identifies the created or updated job."`
+	NewName string         `json:"new_name,omitempty" description:"NewName is the name the job was created under when renamed."`
+	Status  ImportStatus   `json:"status" description:"Status is created, updated, renamed, skipped or failed."`
+	Errors  []fdk.APIError `json:"errors,omitempty" description:"Errors explains why the job failed to import."`
+}
+
+// Validate checks the bundle version and conflict policy of the request.
+func (r *ImportJobsRequest) Validate() []fdk.APIError {
+	var errs []fdk.APIError
+	if r.Bundle.Version != BundleVersion {
+		errs = append(errs, NewValidationError(InvalidJobBundle, fmt.Sprintf("unsupported bundle version: %d", r.Bundle.Version)))
+	}
+	if len(r.Bundle.Jobs) == 0 {
+		errs = append(errs, NewValidationError(InvalidJobBundle, "bundle has no jobs"))
+	}
+	names := make(map[string]bool, len(r.Bundle.Jobs))
+	for _, d := range r.Bundle.Jobs {
+		if names[d.Name] {
+			errs = append(errs, NewValidationError(InvalidJobBundle, fmt.Sprintf("job %q appears more than once in the bundle", d.Name)))
+		}
+		names[d.Name] = true
+	}
+	switch r.Conflict {
+	case "":
+		r.Conflict = ConflictSkip
+	case ConflictSkip, ConflictOverwrite, ConflictRename:
+	default:
+		errs = append(errs, NewValidationError(InvalidJobBundle, fmt.Sprintf("invalid conflict policy: %s", r.Conflict)))
+	}
+	return errs
+}
@@ -0,0 +1,149 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	// DefaultCalendarDays is the length of the calendar window when no end is given.
+	DefaultCalendarDays = 7
+	// MaxCalendarDays is the longest calendar window.
+	MaxCalendarDays = 31
+	// DefaultCalendarIntervalMinutes is the length of the intervals hosts are counted in for hot spots.
+	DefaultCalendarIntervalMinutes = 60
+	// MaxCalendarIntervalMinutes is the longest interval, the longest calendar window.
+	MaxCalendarIntervalMinutes = MaxCalendarDays * 24 * 60
+	// DefaultHotSpotHosts is the number of hosts above which an interval is a hot spot, when the policy does not
+	// restrict the hosts of a job.
+	DefaultHotSpotHosts = 1000
+	// MaxCalendarOccurrencesPerJob bounds the occurrences of a single job in the calendar.
+	MaxCalendarOccurrencesPerJob = 500
+
+	// jobLinkFormat is the path of the page of a job in the app.
+	jobLinkFormat = "/job/%s"
+)
+
+// CalendarResponse lists the scheduled runs of every job within a time window.
+type CalendarResponse struct {
+	From            time.Time            `json:"from" description:"From is the start of the window."`
+	To              time.Time            `json:"to" description:"To is the end of the window, runs at this time are left out."`
+	IntervalMinutes int                  `json:"interval_minutes" description:"IntervalMinutes is the length of the intervals hosts are counted in."`
+	MaxHosts        int                  `json:"max_hosts" description:"MaxHosts is the number of hosts above which an interval is a hot spot."`
+	Occurrences     []CalendarOccurrence `json:"occurrences" description:"Occurrences are the scheduled runs of the jobs in chronological order."`
+	HotSpots        []CalendarHotSpot    `json:"hot_spots" description:"HotSpots are the intervals in which the runs target more than MaxHosts hosts."`
+}
+
+// CalendarOccurrence is a single scheduled run of a job.
+type CalendarOccurrence struct {
+	JobID     string    `json:"job_id" description:"JobID identifies the job."`
+	JobName   string    `json:"job_name" description:"JobName is the name of the job."`
+	Time      time.Time `json:"time" description:"Time is the time the run is scheduled at."`
+	HostCount int       `json:"host_count" description:"HostCount is the estimated number of hosts targeted by the run."`
+	Link      string    `json:"link" description:"Link is the path of the page of the job in the app."`
+	Truncated bool      `json:"truncated,omitempty" description:"Truncated is set on the last listed run of a job with more runs in the window than are listed."`
+}
+
+// CalendarHotSpot is an interval in which the scheduled runs target too many hosts.
+type CalendarHotSpot struct {
+	Start     time.Time `json:"start" description:"Start is the start of the interval."`
+	End       time.Time `json:"end" description:"End is the end of the interval."`
+	HostCount int       `json:"host_count" description:"HostCount is the estimated number of hosts targeted by the runs of the interval."`
+	Jobs      []string  `json:"jobs" description:"Jobs are the names of the jobs run in the interval."`
+}
+
+// JobLink returns the path of the page of a job in the app.
+func JobLink(id string) string {
+	return fmt.Sprintf(jobLinkFormat, id)
+}
+
+// ScheduledRuns returns the runs of the schedule of a job from the given time, included, up to the given time,
+// excluded, at most limit of them. Truncated is set when the window holds more runs.
+func (j *Job) ScheduledRuns(from, to time.Time, limit int) (runs []time.Time, truncated bool, err error) {
+	s := j.Schedule
+	if s == nil {
+		return nil, false, nil
+	}
+	if s.Once() {
+		at, err := s.RunAtTime()
+		if err != nil {
+			return nil, false, err
+		}
+		if !at.Before(from) && at.Before(to) {
+			runs = append(runs, at)
+		}
+		return runs, false, nil
+	}
+	if s.TimeCycle == "" {
+		return nil, false, nil
+	}
+
+	// NextRun returns the runs strictly after the given time
+	after := from.Add(-time.Second)
+	if s.Start != "" {
+		start, err := time.Parse(time.RFC3339, s.Start)
+		if err != nil {
+			return nil, false, fmt.Errorf("invalid start date: %w", err)
+		}
+		if start.After(after) {
+			after = start.Add(-time.Second)
+		}
+	}
+	var end time.Time
+	if s.End != "" {
+		if end, err = time.Parse(time.RFC3339, s.End); err != nil {
+			return nil, false, fmt.Errorf("invalid end date: %w", err)
+		}
+	}
+
+	for t, err := NextRun(s, after); ; t, err = NextRun(s, t) {
+		if err != nil {
+			return nil, false, err
+		}
+		if t.IsZero() || !t.Before(to) || (!end.IsZero() && t.After(end)) {
+			return runs, false, nil
+		}
+		if len(runs) == limit {
+			return runs, true, nil
+		}
+		runs = append(runs, t)
+	}
+}
+
+// HotSpots counts the hosts targeted by the occurrences in consecutive intervals from the given time, returning
+// the intervals in which more than maxHosts hosts are targeted.
+func HotSpots(occurrences []CalendarOccurrence, from time.Time, interval time.Duration, maxHosts int) []CalendarHotSpot {
+	hotSpots := make([]CalendarHotSpot, 0)
+	if interval <= 0 {
+		return hotSpots
+	}
+	spots := make(map[int64]*CalendarHotSpot)
+	jobs := make(map[int64]map[string]bool)
+	for _, o := range occurrences {
+		i := int64(o.Time.Sub(from) / interval)
+		spot, ok := spots[i]
+		if !ok {
+			start := from.Add(time.Duration(i) * interval)
+			spot = &CalendarHotSpot{Start: start, End: start.Add(interval)}
+			spots[i] = spot
+			jobs[i] = make(map[string]bool)
+		}
+		spot.HostCount += o.HostCount
+		if !jobs[i][o.JobName] {
+			jobs[i][o.JobName] = true
+			spot.Jobs = append(spot.Jobs, o.JobName)
+		}
+	}
+
+	for _, spot := range spots {
+		if spot.HostCount > maxHosts {
+			sort.Strings(spot.Jobs)
+			hotSpots = append(hotSpots, *spot)
+		}
+	}
+	sort.Slice(hotSpots, func(i, k int) bool {
+		return hotSpots[i].Start.Before(hotSpots[k].Start)
+	})
+	return hotSpots
+}
@@ -0,0 +1,101 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+)
+
+// MaxChainDepth is the maximum number of jobs a chain of downstream jobs can run one after another.
+const MaxChainDepth = 4
+
+// DownstreamJob is a job started on the hosts of an execution of the job once the execution finishes.
+type DownstreamJob struct {
+	JobID            string `json:"job_id" description:"JobID identifies the downstream job."`
+	OnlyOnCompleted  bool   `json:"only_on_completed,omitempty" description:"OnlyOnCompleted starts the downstream job only when the execution completed."`
+	OnlyMatchedHosts bool   `json:"only_matched_hosts,omitempty" description:"OnlyMatchedHosts targets only the hosts on which the query of the execution matched."`
+}
+
+// JobLaunch describes how to provision a run of a job on any list of hosts. It is saved with every provisioned
+// job, so that job_history can start the job when it is downstream of another one.
+type JobLaunch struct {
+	HostsField      string           `json:"hosts_field" description:"HostsField is the condition field matching the targeted hosts."`
+	HostGroupsField string           `json:"host_groups_field" description:"HostGroupsField is the condition field matching the targeted host groups."`
+	Workflows       []LaunchWorkflow `json:"workflows" description:"Workflows are the workflow templates provisioned for a run, one per platform."`
+	Notifier        LaunchNotifier   `json:"notifier" description:"Notifier is the workflow template notifying of the completion of a run."`
+}
+
+// LaunchWorkflow is a workflow template provisioned for a run of a job on a single platform.
+type LaunchWorkflow struct {
+	TemplateName    string      `json:"template_name" description:"TemplateName is the name of the workflow template."`
+	NameSuffix      string      `json:"name_suffix,omitempty" description:"NameSuffix is the platform suffix of the name of the workflow."`
+	ConditionNodeID string      `json:"condition_node_id" description:"ConditionNodeID is the condition node filtering the targeted hosts."`
+	ActivityNodeID  string      `json:"activity_node_id" description:"ActivityNodeID is the node running the RTR script."`
+	Properties      interface{} `json:"properties" description:"Properties are the parameters of the node running the RTR script."`
+}
+
+// LaunchNotifier is the workflow template notifying of the completion of a run of a job.
+type LaunchNotifier struct {
+	TemplateName      string   `json:"template_name" description:"TemplateName is the name of the workflow template."`
+	ConditionNodeID   string   `json:"condition_node_id" description:"ConditionNodeID is the condition node filtering the workflow definitions."`
+	DefinitionIDField string   `json:"definition_id_field" description:"DefinitionIDField is the condition field matching the workflow definitions."`
+	EmailNodeID       string   `json:"email_node_id" description:"EmailNodeID is the node sending the notification email."`
+	Recipients        []string `json:"recipients" description:"Recipients are the email addresses notified."`
+}
+
+func validateDownstream(downstream []DownstreamJob) []fdk.APIError {
+	var errs []fdk.APIError
+	seen := make(map[string]bool)
+	for _, d := range downstream {
+		if strings.TrimSpace(d.JobID) == "" {
+			errs = append(errs, NewValidationError(InvalidDownstreamJob, "downstream job id cannot be empty"))
+			continue
+		}
+		if seen[d.JobID] {
+			errs = append(errs, NewValidationError(InvalidDownstreamJob, fmt.Sprintf("downstream job %s is listed more than once", d.JobID)))
+		}
+		seen[d.JobID] = true
+	}
+	return errs
+}
+
+// NewJobLaunch returns the launch of the job, provisioning the given action templates.
+func NewJobLaunch(j *Job, templates []ActionTemplate, conf *Config) *JobLaunch {
+	notifier := conf.Templates.ExecutionNotifier
+	launch := &JobLaunch{
+		HostsField:      conf.Templates.HostsField,
+		HostGroupsField: conf.Templates.HostGroupsField,
+		Notifier: LaunchNotifier{
+			TemplateName:      notifier.Name,
+			ConditionNodeID:   notifier.ConditionNodeID,
+			DefinitionIDField: notifier.DefinitionIDField,
+			EmailNodeID:       notifier.EmailNodeID,
+			Recipients:        j.EmailRecipients(),
+		},
+	}
+	for _, t := range templates {
+		launch.Workflows = append(launch.Workflows, LaunchWorkflow{
+			TemplateName:    t.Name,
+			NameSuffix:      PlatformSuffix(t.Platform),
+			ConditionNodeID: t.ConditionNodeID,
+			ActivityNodeID:  t.ActivityNodeID,
+			Properties:      t.Properties,
+		})
+	}
+	return launch
+}
+
+// PlatformSuffix returns the suffix of the names of the workflows targeting the platform. Windows workflows keep
+// their name so existing jobs are still recognized by job_history.
+func PlatformSuffix(platform Platform) string {
+	if platform == Windows {
+		return ""
+	}
+	return " " + platform.Title()
+}
+
+// ChainCycleError is returned when the downstream jobs of a job lead back to it.
+func ChainCycleError(path []string) fdk.APIError {
+	return NewValidationError(InvalidDownstreamJob, fmt.Sprintf("downstream jobs cannot lead back to the job: %s", strings.Join(path, " -> ")))
+}
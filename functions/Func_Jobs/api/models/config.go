@@ -9,16 +9,97 @@ import (
 )
 
 type Config struct {
-	Cloud                                   falcon.CloudType
-	CID                                     string
-	JobsCollection                          string
-	AuditLogsCollection                     string
-	BuildQFileExistTemplateName             string
-	BuildQRegistryKeyValueExistTemplateName string
-	ExecutionNotifierWorkflow               string
-	ExecutionNotifierWorkflowVersion        string
-	RegistryKeyValueConditionNodeID         string
-	FileExistConditionNodeID                string
+	Cloud               falcon.CloudType
+	CID                 string
+	JobsCollection      string
+	AuditLogsCollection string
+	// WorkflowsCollection indexes the workflow definitions provisioned for jobs by definition ID.
+	WorkflowsCollection string
+	Templates           Templates
+	Policy              Policy
+}
+
+// Templates lists the workflow templates provisioned by jobs and the IDs of their parameterized nodes.
+// They are loaded from templates.yml and verified against the workflow definitions of the app on startup.
+type Templates struct {
+	// HostsField is the condition field matching the targeted hosts in every action template.
+	HostsField string `yaml:"hosts_field"`
+	// HostGroupsField is the condition field matching the targeted host groups in every action template.
+	HostGroupsField string `yaml:"host_groups_field"`
+	// RegistryQuery checks registry keys and values on windows hosts.
+	RegistryQuery WorkflowTemplate `yaml:"registry_query"`
+	// FileQueries check for files, one template per platform.
+	FileQueries map[Platform]WorkflowTemplate `yaml:"file_queries"`
+	// ProcessServiceQuery checks for processes and services on windows hosts.
+	ProcessServiceQuery WorkflowTemplate `yaml:"process_service_query"`
+	// Scripts run the RTR scripts of the app, keyed by script name.
+	Scripts map[string]ScriptTemplate `yaml:"scripts"`
+	// Steps runs the steps of multi-step jobs on windows hosts.
+	Steps WorkflowTemplate `yaml:"steps"`
+	// ExecutionNotifier notifies of the completion of the workflows of a job.
+	ExecutionNotifier NotifierTemplate `yaml:"execution_notifier"`
+}
+
+// WorkflowTemplate identifies a workflow template and the nodes configured when provisioning it.
+type WorkflowTemplate struct {
+	// Name is the name of the workflow template.
+	Name string `yaml:"name"`
+	// ConditionNodeID is the condition node filtering the targeted hosts.
+	ConditionNodeID string `yaml:"condition_node_id"`
+	// ActivityNodeID is the node running the RTR script.
+	ActivityNodeID string `yaml:"activity_node_id"`
+}
+
+// OnDemandTemplateName returns the name of the on demand workflow of the app started by run now jobs. Every action
+// template has an on demand twin running the same activity node, which takes the job, the targeted hosts and the
+// properties of the activity as the inputs of its trigger rather than being provisioned for every job.
+func OnDemandTemplateName(name string) string {
+	return name + " on demand"
+}
+
+// OnDemandInputs are the trigger inputs of every on demand workflow besides the properties of its activity.
+var OnDemandInputs = []string{"job_id", "wave", "platform", "device_ids"}
+
+// ScriptTemplate is a workflow template running a single RTR script of the app, used by run script jobs.
+type ScriptTemplate struct {
+	WorkflowTemplate `yaml:",inline"`
+	// Platform is the platform the script runs on.
+	Platform Platform `yaml:"platform"`
+	// Disruptive is the workflow_integration.disruptive flag of the script in the manifest, verified on startup.
+	Disruptive *bool `yaml:"disruptive"`
+	// PathParameters are the parameters of the script holding file paths or registry keys, which the job policy
+	// restricts.
+	PathParameters []string `yaml:"path_parameters"`
+}
+
+// ReadOnly reports whether the script is known not to change the hosts it runs on. Scripts whose flag is not set
+// are deemed disruptive.
+func (t ScriptTemplate) ReadOnly() bool {
+	return t.Disruptive != nil && !*t.Disruptive
+}
+
+// NotifierTemplate identifies the workflow template notifying of the completion of the workflows of a job.
+type NotifierTemplate struct {
+	// Name is the name of the workflow template.
+	Name string `yaml:"name"`
+	// ConditionNodeID is the condition node filtering the workflow definitions.
+	ConditionNodeID string `yaml:"condition_node_id"`
+	// DefinitionIDField is the condition field matching the workflow definitions.
+	DefinitionIDField string `yaml:"definition_id_field"`
+	// EmailNodeID is the node sending the notification email.
+	EmailNodeID string `yaml:"email_node_id"`
+}
+
+// FileExistTemplate returns the workflow template which checks for files on hosts of the given platform.
+func (c *Config) FileExistTemplate(platform Platform) (WorkflowTemplate, bool) {
+	t, ok := c.Templates.FileQueries[platform]
+	return t, ok
+}
+
+// ScriptTemplate returns the workflow template which runs the named RTR script.
+func (c *Config) ScriptTemplate(name string) (ScriptTemplate, bool) {
+	t, ok := c.Templates.Scripts[name]
+	return t, ok
 }
 
 // FalconClient returns a new instance of the GoFalcon client.
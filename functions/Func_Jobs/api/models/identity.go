@@ -0,0 +1,52 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Identity is the Falcon user a job is created or modified by, resolved from the access token of the request.
+type Identity struct {
+	UserID   string `json:"user_id" description:"UserID is the UUID of the user."`
+	UserName string `json:"user_name" description:"UserName is the username or email of the user."`
+	Source   string `json:"source,omitempty" description:"Source is how the user made the change when it was not made from the job itself, such as plan/apply."`
+}
+
+// WorkflowSource is the source of the changes made by callers which are not Falcon users, such as the workflows
+// running the upsert job action.
+const WorkflowSource = "workflow"
+
+// WorkflowIdentity is the identity of the callers which are not Falcon users. It owns no job and is not checked
+// against the owner and the editors of the jobs it modifies.
+var WorkflowIdentity = Identity{Source: WorkflowSource}
+
+// System reports whether the identity is a caller which is not a Falcon user.
+func (i Identity) System() bool {
+	return i.UserID == ""
+}
+
+// TokenSubject returns the subject of a JWT access token. The signature is not verified, the token is verified
+// by the Falcon API when it is used to look up the subject.
+func TokenSubject(token string) (string, error) {
+	parts := strings.Split(strings.TrimSpace(token), ".")
+	if len(parts) != 3 {
+		return "", errors.New("access token is not a JWT")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return "", fmt.Errorf("failed to decode access token claims: %w", err)
+	}
+	var claims struct {
+		Subject string `json:"sub"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return "", fmt.Errorf("failed to decode access token claims: %w", err)
+	}
+	if claims.Subject == "" {
+		return "", errors.New("access token has no subject")
+	}
+	return claims.Subject, nil
+}
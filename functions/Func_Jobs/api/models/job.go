@@ -1,22 +1,71 @@
 package models
 
 import (
+	"crypto/rand"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	fdk "github.com/CrowdStrike/foundry-fn-go"
+	"github.com/Crowdstrike/foundry-sample-scalable-rtr/functions/Func_Jobs/api/scripts"
+	oaerrors "github.com/go-openapi/errors"
+	"github.com/go-openapi/spec"
+	"github.com/go-openapi/strfmt"
+	"github.com/go-openapi/validate"
 	"github.com/robfig/cron/v3"
-	"github.com/spaolacci/murmur3"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 )
 
 const (
-	RunNowTimeCyclesFormat            = "%d %d */1 * *"
-	DateFormat                        = "%02d-%02d-%d" // 8-28-2023
-	BuildQuery             ActionType = "buildQuery"
-	File                   SearchType = "file"
-	RegistryKey            SearchType = "registryKey"
+	OnceTimeCyclesFormat            = "%d %d %d %d *"
+	DateFormat                      = "%02d-%02d-%d" // 8-28-2023
+	BuildQuery           ActionType = "buildQuery"
+	RunScript            ActionType = "runScript"
+	Steps                ActionType = "steps"
+	HashFile             ActionType = "hashFile"
+	RemoveFile           ActionType = "removeFile"
+	File                 SearchType = "file"
+	RegistryKey          SearchType = "registryKey"
+	Process              SearchType = "process"
+	Service              SearchType = "service"
+
+	// WaveNameFormat is appended to the workflow name of every wave when a job runs in multiple waves.
+	WaveNameFormat = " Wave %d"
+	// MaxWaves is the maximum number of waves a job can be split into.
+	MaxWaves = 50
+
+	minutesInDay = 24 * 60
 )
 
+var (
+	sha256RE  = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+	versionRE = regexp.MustCompile(`^\d+(\.\d+){0,3}$`)
+)
+
+// Platform is the operating system of the hosts targeted by a job.
+type Platform string
+
+const (
+	Windows Platform = "windows"
+	Linux   Platform = "linux"
+	Mac     Platform = "mac"
+)
+
+var platformTitles = map[Platform]string{
+	Windows: "Windows",
+	Linux:   "Linux",
+	Mac:     "Mac",
+}
+
+// Title returns the platform name as reported by the Falcon sensor.
+func (p Platform) Title() string {
+	return platformTitles[p]
+}
+
 // ActionType determines the type of activity the job needs to do
 type ActionType string
 
@@ -56,13 +105,15 @@ type AuditResponse struct {
 
 // Audit log for the job been created and modified
 type Audit struct {
-	JobName    string     `json:"job_name,omitempty" description:"JobName is name of the job created/updated."`
-	ModifiedAt *time.Time `json:"modified_at,omitempty" description:"ModifiedAt time of the job modified at."`
-	Version    int        `json:"version" description:"Version of the job."`
-	ModifiedBy string     `json:"modified_by,omitempty" description:"ModifiedBy is username of the person modified the job"`
-	Action     string     `json:"action" description:"Handle indicates if the job was created or edited."`
-	ID         string     `json:"id" description:"ID of the audit log."`
-	JobID      string     `json:"job_id" description:"JobID is id of the job."`
+	JobName      string     `json:"job_name,omitempty" description:"JobName is name of the job created/updated."`
+	ModifiedAt   *time.Time `json:"modified_at,omitempty" description:"ModifiedAt time of the job modified at."`
+	Version      int        `json:"version" description:"Version of the job."`
+	ModifiedBy   string     `json:"modified_by,omitempty" description:"ModifiedBy is username of the person modified the job"`
+	ModifiedByID string     `json:"modified_by_id,omitempty" description:"ModifiedByID is the user id of the person modified the job"`
+	Source       string     `json:"source,omitempty" description:"Source is how the job was modified when not from the job itself, such as plan/apply."`
+	Action       string     `json:"action" description:"Handle indicates if the job was created or edited."`
+	ID           string     `json:"id" description:"ID of the audit log."`
+	JobID        string     `json:"job_id" description:"JobID is id of the job."`
 }
 
 // JobResponse holds the job info.
@@ -72,31 +123,44 @@ type JobResponse struct {
 
 // Job holds the information regarding the job
 type Job struct {
-	UserID           string         `json:"user_id" description:"UserID is the ID of the user who submitted the request."`
-	UserName         string         `json:"user_name" description:"UserName is the username or email of the user who submitted the request."`
-	ID               string         `json:"id,omitempty" description:"ID identifies a job"`
-	Name             string         `json:"name" description:"Name is the name of the job."`
-	Description      string         `json:"description,omitempty" description:"Description is the description of the job."`
-	Version          int            `json:"version" description:"Version of the job"`
-	Draft            bool           `json:"draft" description:"Draft indicates if the the job provisioned or not."`
-	Notifications    []string       `json:"notifications" description:"Notifications is a list of email addresses to notify regarding this job."`
-	Tags             []string       `json:"tags" description:"Tags is a list of tags to assign to this job."`
-	HostCount        int            `json:"host_count" description:"HostCount gives estimates number of host targeted for this job."`
-	Action           *RTRAction     `json:"action" description:"Handle contains information about the RTR put file or command."`
-	Schedule         *Schedule      `json:"schedule" description:"Schedule defines when this job should execute."`
-	WSchedule        *Schedule      `json:"wschedule" description:"Schedule defines when this job should execute in workflow format."`
-	RunNowSchedule   *Schedule      `json:"run_now_schedule" description:"Schedule defines when this job should execute in workflow format."`
-	Target           *TargetHost    `json:"target" description:"Target defines the systems against which the action should be performed."`
-	Workflows        *WorkflowsInfo `json:"workflows" description:"Workflows created for this job"`
-	RunNow           bool           `json:"run_now" description:"Indicates if we need to run the workflow now."`
-	TotalRecurrences int            `json:"total_recurrences" description:"TotalRecurrences is number of times job needs to be run."`
-	RunCount         int            `json:"run_count" description:"RunCount is number of time job has ran."`
-	NextRun          *time.Time     `json:"next_run,omitempty" description:"NextRun indicates the next time the job will run."`
-	LastRun          *time.Time     `json:"last_run,omitempty" description:"LastRun indicates the last time the job ran."`
-	OutputFormat     []string       `json:"output_format" description:"OutputFormat determines the user expecting the output format to be in."`
-	CreatedAt        *time.Time     `json:"created_at,omitempty" description:"CreatedAt indicates the time at which job was created."`
-	UpdatedAt        *time.Time     `json:"updated_at,omitempty" description:"UpdatedAt indicates the time at which jon was updated last."`
-	DeletedAt        *time.Time     `json:"deleted_at,omitempty" description:"DeletedAt indicates the time at which job was deleted"`
+	UserID              string               `json:"user_id" description:"UserID is the ID of the user who created the job, it is set from the access token of the request."`
+	UserName            string               `json:"user_name" description:"UserName is the username or email of the user who created the job, it is set from the access token of the request."`
+	ModifiedBy          *Identity            `json:"modified_by,omitempty" description:"ModifiedBy is the user who last modified the job, it is set from the access token of the request."`
+	Access              *JobAccess           `json:"access,omitempty" description:"Access lists the users and roles allowed to modify the job besides its owner, the stored access is kept when left out."`
+	Approval            *Approval            `json:"approval,omitempty" description:"Approval is the review of a job which must be approved before it is provisioned."`
+	Downstream          []DownstreamJob      `json:"downstream_jobs,omitempty" description:"Downstream is the list of jobs started on the hosts of an execution once it finishes, the stored list is kept when left out."`
+	Launch              *JobLaunch           `json:"launch,omitempty" description:"Launch describes how to start a run of the provisioned job when it is downstream of another job."`
+	ID                  string               `json:"id,omitempty" description:"ID identifies a job"`
+	Name                string               `json:"name" description:"Name is the name of the job."`
+	Description         string               `json:"description,omitempty" description:"Description is the description of the job."`
+	Version             int                  `json:"version" description:"Version of the job"`
+	Draft               bool                 `json:"draft" description:"Draft indicates if the the job provisioned or not."`
+	Notifications       []string             `json:"notifications" description:"Notifications is a list of email addresses to notify regarding this job."`
+	NotificationTargets []NotificationTarget `json:"notification_targets,omitempty" description:"NotificationTargets is a list of email and webhook targets to notify regarding this job."`
+	NotificationRules   []NotificationRule   `json:"notification_rules,omitempty" description:"NotificationRules restricts notifications to the executions matching any of the rules."`
+	HostTagging         *HostTagging         `json:"host_tagging,omitempty" description:"HostTagging tags the hosts by their result once an execution completes."`
+	Tags                []string             `json:"tags" description:"Tags is a list of tags to assign to this job."`
+	HostCount           int                  `json:"host_count" description:"HostCount gives estimates number of host targeted for this job."`
+	Action              *RTRAction           `json:"action" description:"Handle contains information about the RTR put file or command."`
+	Schedule            *Schedule            `json:"schedule" description:"Schedule defines when this job should execute."`
+	WSchedule           *Schedule            `json:"wschedule" description:"Schedule defines when this job should execute in workflow format."`
+	Target              *TargetHost          `json:"target" description:"Target defines the systems against which the action should be performed."`
+	Workflows           *WorkflowsInfo       `json:"workflows" description:"Workflows created for this job"`
+	Waves               int                  `json:"waves,omitempty" description:"Waves is the number of batches the targeted hosts are split into for each run."`
+	RunNow              bool                 `json:"run_now" description:"Indicates if we need to run the workflow now."`
+	RunNowExecutionIDs  []string             `json:"run_now_execution_ids,omitempty" description:"RunNowExecutionIDs are the workflow executions started when the job was last run now."`
+	TotalRecurrences    int                  `json:"total_recurrences" description:"TotalRecurrences is number of times job needs to be run."`
+	RunCount            int                  `json:"run_count" description:"RunCount is number of time job has ran."`
+	NextRun             *time.Time           `json:"next_run,omitempty" description:"NextRun indicates the next time the job will run."`
+	LastRun             *time.Time           `json:"last_run,omitempty" description:"LastRun indicates the last time the job ran."`
+	MissedRuns          *MissedRuns          `json:"missed_runs,omitempty" description:"MissedRuns flags the scheduled runs of the job which did not start."`
+	OutputFormat        []string             `json:"output_format" description:"OutputFormat determines the user expecting the output format to be in."`
+	CreatedAt           *time.Time           `json:"created_at,omitempty" description:"CreatedAt indicates the time at which job was created."`
+	UpdatedAt           *time.Time           `json:"updated_at,omitempty" description:"UpdatedAt indicates the time at which jon was updated last."`
+	DeletedAt           *time.Time           `json:"deleted_at,omitempty" description:"DeletedAt indicates the time at which job was deleted"`
+	ArchivedAt          *time.Time           `json:"archived_at,omitempty" description:"ArchivedAt is the time the job was archived by the retention of the policy, saving the job restores it."`
+	ProvisionedAt       *time.Time           `json:"provisioned_at,omitempty" description:"ProvisionedAt is the time the workflows of the job were provisioned after it was last not provisioned, its runs are expected from then on."`
+	Lifecycle           LifecycleState       `json:"lifecycle,omitempty" description:"Lifecycle is active, completed, expired or archived, it is computed from the schedule and the runs of the job."`
 }
 
 // RTRAction indicates the RTR action the job needs to do.
@@ -105,6 +169,60 @@ type RTRAction struct {
 	InstallSoftwareAction
 	RemoveFileAction
 	BuildQueryAction
+	RunScriptAction
+	FileAction
+	Steps []JobStep `json:"steps,omitempty" description:"Steps is the ordered list of steps of a steps action."`
+}
+
+// RunScriptAction runs an RTR script declared in the app with the given parameters.
+type RunScriptAction struct {
+	ScriptName string          `json:"script_name,omitempty" description:"ScriptName is the name of an RTR script declared in the app."`
+	Parameters json.RawMessage `json:"parameters,omitempty" description:"Parameters is the input of the script, validated against its input schema."`
+}
+
+func (action RunScriptAction) validate() []fdk.APIError {
+	var errs []fdk.APIError
+	rawSchema, err := scripts.InputSchema(action.ScriptName)
+	if err != nil {
+		errs = append(errs, NewValidationError(InvalidScriptParameters, fmt.Sprintf("invalid script: %q is not declared in the app", action.ScriptName)))
+		return errs
+	}
+	schema := new(spec.Schema)
+	if err := json.Unmarshal(rawSchema, schema); err != nil {
+		errs = append(errs, NewAPIError(http.StatusInternalServerError, fmt.Sprintf("failed to load input schema of script %s: %v", action.ScriptName, err)))
+		return errs
+	}
+
+	params, err := action.ParameterMap()
+	if err != nil {
+		errs = append(errs, NewValidationError(InvalidScriptParameters, err.Error()))
+		return errs
+	}
+	err = validate.AgainstSchema(schema, params, strfmt.Default)
+	if err == nil {
+		return errs
+	}
+	var composite *oaerrors.CompositeError
+	if !errors.As(err, &composite) {
+		errs = append(errs, NewValidationError(InvalidScriptParameters, err.Error()))
+		return errs
+	}
+	for _, e := range composite.Errors {
+		errs = append(errs, NewValidationError(InvalidScriptParameters, fmt.Sprintf("invalid parameters for script %s: %v", action.ScriptName, e)))
+	}
+	return errs
+}
+
+// ParameterMap decodes the parameters of the script, which must be a JSON object.
+func (action RunScriptAction) ParameterMap() (map[string]interface{}, error) {
+	params := make(map[string]interface{})
+	if len(action.Parameters) == 0 {
+		return params, nil
+	}
+	if err := json.Unmarshal(action.Parameters, &params); err != nil || params == nil {
+		return nil, fmt.Errorf("script parameters must be a JSON object: %s", action.Parameters)
+	}
+	return params, nil
 }
 
 // InstallSoftwareAction contains the file path to be install on a sensor.
@@ -146,9 +264,113 @@ type BuildQueryAction struct {
 	QueryType      SearchType          `json:"query_type" description:"QueryType indicates the type of query action used."`
 	QueryFilePaths []string            `json:"query_file_paths" description:"QueryFilePaths is the list of file ids"`
 	RegistryKeys   []RegistryKeySearch `json:"registry_keys" description:"RegistryKeys is the list of registry keys."`
+	FileAttributes []FileAttributes    `json:"file_attributes,omitempty" description:"FileAttributes is the list of attributes expected of the queried files."`
+	Processes      []PresenceSearch    `json:"processes,omitempty" description:"Processes is the list of running processes to look for."`
+	Services       []PresenceSearch    `json:"services,omitempty" description:"Services is the list of installed or running windows services to look for."`
 }
 
-func (action BuildQueryAction) validate() []fdk.APIError {
+// ServiceState is the state a service is expected to be in.
+type ServiceState string
+
+const (
+	Installed ServiceState = "installed"
+	Running   ServiceState = "running"
+)
+
+// PresenceSearch looks for processes or services by name or executable path. Patterns support the * and ? wildcards.
+type PresenceSearch struct {
+	Name  string       `json:"name,omitempty" description:"Name is the pattern matched against the process name or the service name and display name."`
+	Path  string       `json:"path,omitempty" description:"Path is the pattern matched against the path of the executable."`
+	State ServiceState `json:"state,omitempty" description:"State is installed or running, defaults to installed. Services only."`
+}
+
+func (ps PresenceSearch) validate(searchType SearchType) []fdk.APIError {
+	var errs []fdk.APIError
+	if strings.TrimSpace(ps.Name) == "" && strings.TrimSpace(ps.Path) == "" {
+		errs = append(errs, NewValidationError(InvalidPresenceSearch, fmt.Sprintf("name or path pattern is required to search for a %s", searchType)))
+	} else if strings.Trim(ps.Name, "*?") == "" && strings.Trim(ps.Path, "*?") == "" {
+		errs = append(errs, NewValidationError(InvalidPresenceSearch, fmt.Sprintf("pattern matches every %s: name %q, path %q", searchType, ps.Name, ps.Path)))
+	}
+	switch {
+	case searchType == Process && ps.State != "":
+		errs = append(errs, NewValidationError(InvalidPresenceSearch, fmt.Sprintf("state can only be set for services: %s", ps.State)))
+	case searchType == Service && ps.State != "" && ps.State != Installed && ps.State != Running:
+		errs = append(errs, NewValidationError(InvalidPresenceSearch, fmt.Sprintf("invalid service state: %s", ps.State)))
+	}
+	return errs
+}
+
+// PresenceSearches returns the process or service searches of the query.
+func (action BuildQueryAction) PresenceSearches() []PresenceSearch {
+	if action.QueryType == Service {
+		return action.Services
+	}
+	return action.Processes
+}
+
+// FileAttributes are the attributes a queried file is expected to match.
+type FileAttributes struct {
+	Path    string `json:"path" description:"Path is one of the queried file paths."`
+	SHA256  string `json:"sha256,omitempty" description:"SHA256 is the expected hex encoded SHA-256 hash of the file."`
+	Size    *int64 `json:"size,omitempty" description:"Size is the expected size of the file in bytes."`
+	Version string `json:"version,omitempty" description:"Version is the expected PE file version, for example 10.0.19041.1. Windows only."`
+}
+
+func (fa FileAttributes) validate(platforms []Platform) []fdk.APIError {
+	var errs []fdk.APIError
+	if fa.SHA256 == "" && fa.Size == nil && fa.Version == "" {
+		errs = append(errs, NewValidationError(InvalidFileAttributes, fmt.Sprintf("no attributes expected of file: %s", fa.Path)))
+	}
+	if fa.SHA256 != "" && !sha256RE.MatchString(fa.SHA256) {
+		errs = append(errs, NewValidationError(InvalidFileAttributes, fmt.Sprintf("invalid SHA-256 hash for file %s: %s", fa.Path, fa.SHA256)))
+	}
+	if fa.Size != nil && *fa.Size < 0 {
+		errs = append(errs, NewValidationError(InvalidFileAttributes, fmt.Sprintf("invalid size for file %s: %d", fa.Path, *fa.Size)))
+	}
+	if fa.Version != "" {
+		if !versionRE.MatchString(fa.Version) {
+			errs = append(errs, NewValidationError(InvalidFileAttributes, fmt.Sprintf("invalid file version for file %s: %s", fa.Path, fa.Version)))
+		}
+		for _, p := range platforms {
+			if p != Windows {
+				errs = append(errs, NewValidationError(InvalidFileAttributes, fmt.Sprintf("file versions can only be matched on windows hosts: %s", p)))
+			}
+		}
+	}
+	return errs
+}
+
+// ExpectedFileAttributes returns the expected hash, size and version of every queried file, aligned with
+// QueryFilePaths. Attributes which are not expected are left empty, versions are padded to four parts.
+func (action BuildQueryAction) ExpectedFileAttributes() (hashes, sizes, versions []string) {
+	byPath := make(map[string]FileAttributes, len(action.FileAttributes))
+	for _, fa := range action.FileAttributes {
+		byPath[fa.Path] = fa
+	}
+	hashes = make([]string, len(action.QueryFilePaths))
+	sizes = make([]string, len(action.QueryFilePaths))
+	versions = make([]string, len(action.QueryFilePaths))
+	for i, path := range action.QueryFilePaths {
+		fa, ok := byPath[path]
+		if !ok {
+			continue
+		}
+		hashes[i] = strings.ToLower(fa.SHA256)
+		if fa.Size != nil {
+			sizes[i] = strconv.FormatInt(*fa.Size, 10)
+		}
+		if fa.Version != "" {
+			parts := strings.Split(fa.Version, ".")
+			for len(parts) < 4 {
+				parts = append(parts, "0")
+			}
+			versions[i] = strings.Join(parts, ".")
+		}
+	}
+	return hashes, sizes, versions
+}
+
+func (action BuildQueryAction) validate(platforms []Platform) []fdk.APIError {
 	var errs []fdk.APIError
 	queryActionType := action.QueryType.String()
 	if queryActionType == File.String() {
@@ -156,6 +378,23 @@ func (action BuildQueryAction) validate() []fdk.APIError {
 			errs = append(errs, NewValidationError(InvalidActionConfig, fmt.Sprintf("invalid file : %v", action.QueryFilePaths)))
 			return errs
 		}
+		queried := make(map[string]bool, len(action.QueryFilePaths))
+		for _, path := range action.QueryFilePaths {
+			queried[path] = true
+		}
+		seen := make(map[string]bool, len(action.FileAttributes))
+		for _, fa := range action.FileAttributes {
+			if !queried[fa.Path] {
+				errs = append(errs, NewValidationError(InvalidFileAttributes, fmt.Sprintf("attributes expected of a file which is not queried: %s", fa.Path)))
+				continue
+			}
+			if seen[fa.Path] {
+				errs = append(errs, NewValidationError(InvalidFileAttributes, fmt.Sprintf("duplicate attributes for file: %s", fa.Path)))
+				continue
+			}
+			seen[fa.Path] = true
+			errs = append(errs, fa.validate(platforms)...)
+		}
 		return errs
 	}
 
@@ -164,6 +403,34 @@ func (action BuildQueryAction) validate() []fdk.APIError {
 			errs = append(errs, NewValidationError(InvalidActionConfig, fmt.Sprintf("invalid registry: %v", action.RegistryKeys)))
 			return errs
 		}
+		if len(action.FileAttributes) != 0 {
+			errs = append(errs, NewValidationError(InvalidFileAttributes, "file attributes can only be expected by file queries"))
+		}
+		for _, r := range action.RegistryKeys {
+			errs = append(errs, r.validate()...)
+		}
+		for _, p := range platforms {
+			if p != Windows {
+				errs = append(errs, NewValidationError(InvalidActionConfig, fmt.Sprintf("registry queries can only target windows hosts: %s", p)))
+			}
+		}
+		return errs
+	}
+
+	if queryActionType == Process.String() || queryActionType == Service.String() {
+		searches := action.PresenceSearches()
+		if len(searches) == 0 {
+			errs = append(errs, NewValidationError(InvalidActionConfig, fmt.Sprintf("no %s to search for", queryActionType)))
+			return errs
+		}
+		for _, ps := range searches {
+			errs = append(errs, ps.validate(action.QueryType)...)
+		}
+		for _, p := range platforms {
+			if p != Windows {
+				errs = append(errs, NewValidationError(InvalidActionConfig, fmt.Sprintf("%s queries can only target windows hosts: %s", queryActionType, p)))
+			}
+		}
 		return errs
 	}
 
@@ -171,17 +438,155 @@ func (action BuildQueryAction) validate() []fdk.APIError {
 	return errs
 }
 
+// RegistryValueType is the type of the data of a registry value.
+type RegistryValueType string
+
+const (
+	RegSZ      RegistryValueType = "REG_SZ"
+	RegDWORD   RegistryValueType = "REG_DWORD"
+	RegQWORD   RegistryValueType = "REG_QWORD"
+	RegMultiSZ RegistryValueType = "REG_MULTI_SZ"
+)
+
+// ComparisonOperator compares the data of a registry value with the expected data.
+type ComparisonOperator string
+
+const (
+	Equals         ComparisonOperator = "eq"
+	NotEquals      ComparisonOperator = "ne"
+	GreaterThan    ComparisonOperator = "gt"
+	GreaterOrEqual ComparisonOperator = "ge"
+	LessThan       ComparisonOperator = "lt"
+	LessOrEqual    ComparisonOperator = "le"
+	Contains       ComparisonOperator = "contains"
+)
+
+// registryOperators lists the operators supported by every value type. Ordering operators compare REG_SZ data as
+// dotted versions, for example 10.2 < 10.10, and REG_MULTI_SZ contains matches a single string of the list.
+var registryOperators = map[RegistryValueType][]ComparisonOperator{
+	RegSZ:      {Equals, NotEquals, GreaterThan, GreaterOrEqual, LessThan, LessOrEqual, Contains},
+	RegDWORD:   {Equals, NotEquals, GreaterThan, GreaterOrEqual, LessThan, LessOrEqual},
+	RegQWORD:   {Equals, NotEquals, GreaterThan, GreaterOrEqual, LessThan, LessOrEqual},
+	RegMultiSZ: {Equals, NotEquals, Contains},
+}
+
 // RegistryKeySearch key and the value for the registry
 type RegistryKeySearch struct {
-	Key   string `json:"key" description:"Key for the registry."`
-	Value string `json:"value" description:"Value for the registry."`
+	Key       string             `json:"key" description:"Key for the registry."`
+	Value     string             `json:"value" description:"Value for the registry."`
+	ValueName string             `json:"value_name,omitempty" description:"ValueName is the name of the registry value to compare, for example EnableLUA."`
+	ValueType RegistryValueType  `json:"value_type,omitempty" description:"ValueType is one of REG_SZ, REG_DWORD, REG_QWORD or REG_MULTI_SZ."`
+	Operator  ComparisonOperator `json:"operator,omitempty" description:"Operator is one of eq, ne, gt, ge, lt, le or contains."`
+	Data      string             `json:"data,omitempty" description:"Data is the expected data. REG_MULTI_SZ strings are separated by new lines."`
+}
+
+func (r RegistryKeySearch) validate() []fdk.APIError {
+	var errs []fdk.APIError
+	if strings.TrimSpace(r.Key) == "" {
+		errs = append(errs, NewValidationError(InvalidRegistryComparison, "registry key is required"))
+	}
+	if r.ValueName == "" {
+		if r.ValueType != "" || r.Operator != "" || r.Data != "" {
+			errs = append(errs, NewValidationError(InvalidRegistryComparison, fmt.Sprintf("value name is required to compare data of registry key: %s", r.Key)))
+		}
+		return errs
+	}
+
+	operators, ok := registryOperators[r.ValueType]
+	if !ok {
+		errs = append(errs, NewValidationError(InvalidRegistryComparison, fmt.Sprintf("invalid registry value type for %s: %s", r.ValueName, r.ValueType)))
+		return errs
+	}
+	supported := false
+	for _, op := range operators {
+		supported = supported || op == r.Operator
+	}
+	if !supported {
+		errs = append(errs, NewValidationError(InvalidRegistryComparison, fmt.Sprintf("invalid operator for %s value %s: %s", r.ValueType, r.ValueName, r.Operator)))
+		return errs
+	}
+
+	switch r.ValueType {
+	case RegDWORD, RegQWORD:
+		bitSize := 32
+		if r.ValueType == RegQWORD {
+			bitSize = 64
+		}
+		if _, err := parseRegistryInt(r.Data, bitSize); err != nil {
+			errs = append(errs, NewValidationError(InvalidRegistryComparison, fmt.Sprintf("invalid %s data for %s: %s", r.ValueType, r.ValueName, r.Data)))
+		}
+	case RegSZ:
+		if r.Operator != Equals && r.Operator != NotEquals && r.Operator != Contains && !versionRE.MatchString(r.Data) {
+			errs = append(errs, NewValidationError(InvalidRegistryComparison, fmt.Sprintf("%s data must be a version to use operator %s: %s", r.ValueName, r.Operator, r.Data)))
+		}
+	}
+	return errs
+}
+
+// NormalizedData returns the expected data as passed to the RTR script, DWORD and QWORD data is converted to decimal.
+func (r RegistryKeySearch) NormalizedData() string {
+	switch r.ValueType {
+	case RegDWORD:
+		if v, err := parseRegistryInt(r.Data, 32); err == nil {
+			return strconv.FormatUint(v, 10)
+		}
+	case RegQWORD:
+		if v, err := parseRegistryInt(r.Data, 64); err == nil {
+			return strconv.FormatUint(v, 10)
+		}
+	}
+	return r.Data
+}
+
+// parseRegistryInt parses decimal or 0x prefixed hexadecimal DWORD and QWORD data.
+func parseRegistryInt(s string, bitSize int) (uint64, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(strings.ToLower(s), "0x") {
+		return strconv.ParseUint(s[2:], 16, bitSize)
+	}
+	return strconv.ParseUint(s, 10, bitSize)
 }
 
 // TargetHost is the list of hostgroups/host the job needs to run against.
 type TargetHost struct {
-	HostGroups      []string `json:"host_groups" description:"HostGroups indicates the list of host groups."`
-	Hosts           []string `json:"hosts" description:"Hosts indicates the list of host."`
-	OfflineQueueing bool     `json:"offline_queueing" description:"OfflineQueueing indicates if need to target host which are offline."`
+	HostGroups      []string   `json:"host_groups" description:"HostGroups indicates the list of host groups."`
+	Hosts           []string   `json:"hosts" description:"Hosts indicates the list of host."`
+	OfflineQueueing bool       `json:"offline_queueing" description:"OfflineQueueing indicates if need to target host which are offline."`
+	Batching        *Batching  `json:"batching,omitempty" description:"Batching splits the targeted hosts into waves which run one after another."`
+	Platforms       []Platform `json:"platforms,omitempty" description:"Platforms is the list of operating systems targeted. Defaults to windows."`
+}
+
+// TargetPlatforms returns the platforms targeted, defaulting to windows.
+func (t TargetHost) TargetPlatforms() []Platform {
+	if len(t.Platforms) == 0 {
+		return []Platform{Windows}
+	}
+	return t.Platforms
+}
+
+// Batching limits the number of hosts targeted at once by splitting the resolved hosts into waves.
+type Batching struct {
+	MaxHostsPerWave  int `json:"max_hosts_per_wave" description:"MaxHostsPerWave is the maximum number of hosts targeted by a single wave."`
+	WaveDelayMinutes int `json:"wave_delay_minutes" description:"WaveDelayMinutes is the delay between the start of two consecutive waves."`
+}
+
+func (b Batching) validate() []fdk.APIError {
+	var errs []fdk.APIError
+	if b.MaxHostsPerWave <= 0 {
+		errs = append(errs, NewValidationError(InvalidBatchConfig, fmt.Sprintf("invalid max hosts per wave: %d", b.MaxHostsPerWave)))
+	}
+	if b.WaveDelayMinutes < 0 {
+		errs = append(errs, NewValidationError(InvalidBatchConfig, fmt.Sprintf("invalid wave delay: %d", b.WaveDelayMinutes)))
+	}
+	return errs
+}
+
+// LastWaveDelayMinutes returns the delay of the last of the given number of waves, the most delayed one.
+func (b Batching) LastWaveDelayMinutes(waves int) int {
+	if waves <= 1 {
+		return 0
+	}
+	return (waves - 1) * b.WaveDelayMinutes
 }
 
 // Schedule contains the cron job expression along with start and end date for the job.
@@ -191,6 +596,46 @@ type Schedule struct {
 	End            string `json:"end_date,omitempty" description:"End date in mm-dd-yyyy format"`
 	Timezone       string `json:"-" description:"Timezone label from IANA timezone database, for example, America/Los_Angeles"`
 	SkipConcurrent bool   `json:"skip_concurrent" description:"Flag indicating if concurrent execution of scheduled workflow should be skipped or not"`
+	RunAt          string `json:"run_at,omitempty" description:"RunAt is the RFC3339 time of a one-time schedule, which runs exactly once and has no time cycle."`
+	RunAtTimezone  string `json:"run_at_timezone,omitempty" description:"RunAtTimezone is the IANA timezone of the one-time run, UTC when empty."`
+}
+
+// Once reports whether the schedule runs a single time, at RunAt.
+func (s *Schedule) Once() bool {
+	return s != nil && s.RunAt != ""
+}
+
+// RunAtTime returns the time of a one-time run in its timezone.
+func (s *Schedule) RunAtTime() (time.Time, error) {
+	loc, err := time.LoadLocation(s.RunAtTimezone)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timezone: %w", err)
+	}
+	t, err := time.Parse(time.RFC3339, s.RunAt)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t.In(loc), nil
+}
+
+// normalize turns the one-time schedules of older clients, a start date without time cycle, into a one-time run.
+func (s *Schedule) normalize() {
+	if s.TimeCycle == "" && s.RunAt == "" && s.Start != "" {
+		s.RunAt = s.Start
+	}
+}
+
+// OnceSchedule returns the workflow schedule firing exactly once at the given time. Its time cycle only matches the
+// day of the year of the run, and the schedule ends before the next year.
+func OnceSchedule(at time.Time) *Schedule {
+	end := at.AddDate(0, 0, 1)
+	return &Schedule{
+		TimeCycle: fmt.Sprintf(OnceTimeCyclesFormat, at.Minute(), at.Hour(), at.Day(), int(at.Month())),
+		Start:     fmt.Sprintf(DateFormat, at.Month(), at.Day(), at.Year()),
+		End:       fmt.Sprintf(DateFormat, end.Month(), end.Day(), end.Year()),
+		Timezone:  at.Location().String(),
+		RunAt:     at.Format(time.RFC3339),
+	}
 }
 
 // SearchObjectsRequest is a request to locate objects matching the provided filter.
@@ -223,6 +668,21 @@ type WorkflowsInfo struct {
 	ScheduleWorkflow []string `json:"scheduled_workflow" description:"ScheduleWorkflow is the main workflow which runs the activity on an sensor"`
 }
 
+// Definitions returns the IDs of the workflow definitions running the job, leaving out the notifier.
+func (w *WorkflowsInfo) Definitions() []string {
+	if w == nil {
+		return nil
+	}
+	return w.ScheduleWorkflow
+}
+
+// WorkflowIndexEntry maps a workflow definition to the job it runs, so that its executions are attributed to the
+// job whatever the name of the definition.
+type WorkflowIndexEntry struct {
+	DefinitionID string `json:"definition_id"`
+	JobID        string `json:"job_id"`
+}
+
 // UpsertJobRequest holds info of the job.
 type UpsertJobRequest struct {
 	Job
@@ -245,7 +705,7 @@ const (
 	UserNameIsRequired
 	// NotificationEmailsRequired error code if emails are absent.
 	NotificationEmailsRequired
-	// JobNameChangedError error code if the name of the job changed.
+	// JobNameChangedError is no longer returned, jobs are identified by an opaque ID and can be renamed.
 	JobNameChangedError
 	// JobIDGenerationFailure error code for the ID generation failure.
 	JobIDGenerationFailure
@@ -254,9 +714,46 @@ const (
 	InvalidJobTarget
 	InvalidActionType
 	InvalidActionConfig
+	// InvalidBatchConfig error code if the host batching settings are incorrect.
+	InvalidBatchConfig
+	// InvalidFileAttributes error code if the attributes expected of queried files are incorrect.
+	InvalidFileAttributes
+	// InvalidRegistryComparison error code if a registry value comparison is incorrect.
+	InvalidRegistryComparison
+	// InvalidPresenceSearch error code if a process or service search is incorrect.
+	InvalidPresenceSearch
+	// InvalidScriptParameters error code if the script of a run script action is unknown or its parameters are incorrect.
+	InvalidScriptParameters
+	// InvalidJobBundle error code if an imported job bundle or its conflict policy is incorrect.
+	InvalidJobBundle
+	// InvalidNotificationTarget error code if an email or webhook notification target is incorrect.
+	InvalidNotificationTarget
+	// InvalidNotificationRule error code if a notification rule is incorrect.
+	InvalidNotificationRule
+	// PolicyMaxHostsExceeded error code if a job targets more hosts than the job policy allows.
+	PolicyMaxHostsExceeded
+	// PolicyScheduleIntervalTooShort error code if a job runs more often than the job policy allows.
+	PolicyScheduleIntervalTooShort
+	// PolicyFilePathNotAllowed error code if a file path of a job is not allowed by the job policy.
+	PolicyFilePathNotAllowed
+	// PolicyRegistryKeyNotAllowed error code if a registry key of a job is not allowed by the job policy.
+	PolicyRegistryKeyNotAllowed
+	// PolicyEmailDomainNotAllowed error code if a notification email is not in a domain allowed by the job policy.
+	PolicyEmailDomainNotAllowed
+	// PolicyMaxActiveJobsExceeded error code if a user owns more active jobs than the job policy allows.
+	PolicyMaxActiveJobsExceeded
+	// InvalidJobAccess error code if the editors of a job are incorrect.
+	InvalidJobAccess
+	// InvalidDownstreamJob error code if a downstream job is unknown or the downstream jobs form a cycle.
+	InvalidDownstreamJob
+	// InvalidJobStep error code if a step of a multi-step job is incorrect.
+	InvalidJobStep
+	// InvalidHostTagging error code if the grouping tags applied to hosts are incorrect.
+	InvalidHostTagging
 )
 
-func (ujr *UpsertJobRequest) Validate() []fdk.APIError {
+// Validate checks the job and evaluates it against the job policy of the configuration.
+func (ujr *UpsertJobRequest) Validate(conf *Config) []fdk.APIError {
 	var errs []fdk.APIError
 
 	if ujr.Name == "" {
@@ -275,21 +772,39 @@ func (ujr *UpsertJobRequest) Validate() []fdk.APIError {
 		errs = append(errs, NewValidationError(UserNameIsRequired, "user name cannot be empty"))
 	}*/
 
-	if len(ujr.Notifications) == 0 {
+	// webhooks are notified in addition to the notification emails
+	if len(ujr.EmailRecipients()) == 0 {
 		errs = append(errs, NewValidationError(NotificationEmailsRequired, "notication emails cannot be empty"))
 	}
-
-	if ujr.ID != "" {
-		id, err := GenerateID(ujr.Name)
-		if err != nil {
-			errs = append(errs, NewValidationError(JobIDGenerationFailure, fmt.Sprintf("failed to generate id for job: %v", err)))
-		}
-		if id != ujr.ID {
-			errs = append(errs, NewValidationError(JobNameChangedError, "job name cannot be changed"))
-		}
+	for _, t := range ujr.NotificationTargets {
+		errs = append(errs, t.validate(ujr.ID != "")...)
+	}
+	for _, r := range ujr.NotificationRules {
+		errs = append(errs, r.validate(ujr.Action)...)
+	}
+	if ujr.Access != nil {
+		errs = append(errs, ujr.Access.validate()...)
 	}
+	if ujr.HostTagging != nil {
+		ujr.HostTagging.Normalize()
+		errs = append(errs, ujr.HostTagging.validate(ujr.Action)...)
+	}
+	errs = append(errs, validateDownstream(ujr.Downstream)...)
 
 	if ujr.Schedule != nil {
+		ujr.Schedule.normalize()
+		if ujr.Schedule.Once() {
+			runAt, err := ujr.Schedule.RunAtTime()
+			if err != nil {
+				errs = append(errs, NewValidationError(JobScheduleIsIncorrect, fmt.Sprintf("invalid one-time run: %v", err)))
+			} else if runAt.Before(time.Now()) {
+				// the workflow of a past run never fires
+				errs = append(errs, NewValidationError(JobScheduleIsIncorrect, "invalid one-time run should be in the future."))
+			}
+			if ujr.Schedule.TimeCycle != "" {
+				errs = append(errs, NewValidationError(JobScheduleIsIncorrect, "a one-time schedule cannot have a time cycle"))
+			}
+		}
 		// Time cycle is empty for schedule once
 		if ujr.Schedule.TimeCycle != "" {
 			_, err := cron.ParseStandard(ujr.Schedule.TimeCycle)
@@ -328,6 +843,22 @@ func (ujr *UpsertJobRequest) Validate() []fdk.APIError {
 		if len(ujr.Target.Hosts) == 0 && len(ujr.Target.HostGroups) == 0 {
 			errs = append(errs, NewValidationError(InvalidJobTarget, "must have target host or groups"))
 		}
+		for _, p := range ujr.Target.Platforms {
+			if p.Title() == "" {
+				errs = append(errs, NewValidationError(InvalidJobTarget, fmt.Sprintf("invalid target platform: %s", p)))
+			}
+		}
+		if ujr.Target.Batching != nil {
+			errs = append(errs, ujr.Target.Batching.validate()...)
+			// waves of a schedule are staggered by shifting its cron expression, the hosts of host groups are only
+			// split into waves when the job is provisioned
+			if b := ujr.Target.Batching; b.WaveDelayMinutes > 0 && b.MaxHostsPerWave > 0 && ujr.Schedule != nil && ujr.Schedule.TimeCycle != "" {
+				waves := (len(ujr.Target.Hosts) + b.MaxHostsPerWave - 1) / b.MaxHostsPerWave
+				if _, err := ShiftTimeCycle(ujr.Schedule.TimeCycle, b.LastWaveDelayMinutes(waves)); err != nil {
+					errs = append(errs, NewValidationError(InvalidBatchConfig, fmt.Sprintf("wave delay cannot be applied to schedule: %v", err)))
+				}
+			}
+		}
 	}
 
 	if ujr.Action == nil {
@@ -335,14 +866,20 @@ func (ujr *UpsertJobRequest) Validate() []fdk.APIError {
 	}
 
 	if ujr.Action != nil {
-		switch ujr.Action.Type.String() {
-		case BuildQuery.String():
-			errs = append(errs, ujr.Action.BuildQueryAction.validate()...)
-		default:
+		kind, ok := LookupAction(ujr.Action.Type)
+		if !ok {
 			errs = append(errs, NewValidationError(InvalidActionType, fmt.Sprintf("invalid action type: %s", ujr.Action.Type.String())))
+		} else {
+			var platforms []Platform
+			if ujr.Target != nil {
+				platforms = ujr.Target.TargetPlatforms()
+			}
+			errs = append(errs, kind.Validate(ujr.Action, platforms)...)
 		}
 	}
 
+	errs = append(errs, conf.Policy.Evaluate(&ujr.Job, conf)...)
+
 	return errs
 }
 
@@ -358,14 +895,42 @@ func NewAPIError(code int, msg string) fdk.APIError {
 	}
 }
 
-// GenerateID creates a consistent value when writing or retrieving targets
-func GenerateID(key string) (string, error) {
-	b := murmur3.New128()
-	_, err := b.Write([]byte(key))
-	if err != nil {
+// NewJobID creates the opaque ID of a new job. The ID does not depend on the name of the job, which can be changed.
+func NewJobID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
 		return "", err
 	}
-	return hex.EncodeToString(b.Sum(nil)), nil
+	return hex.EncodeToString(b), nil
+}
+
+// ShiftTimeCycle delays a cron expression with a fixed minute and hour by the given number of minutes.
+// Shifting past midnight is only supported when the expression runs every day.
+func ShiftTimeCycle(timeCycle string, minutes int) (string, error) {
+	fields := strings.Fields(timeCycle)
+	if len(fields) != 5 {
+		return "", fmt.Errorf("time cycle %q must have 5 fields", timeCycle)
+	}
+	minute, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return "", fmt.Errorf("time cycle %q must have a fixed minute", timeCycle)
+	}
+	hour, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return "", fmt.Errorf("time cycle %q must have a fixed hour", timeCycle)
+	}
+
+	total := hour*60 + minute + minutes
+	if total >= minutesInDay {
+		for _, f := range fields[2:] {
+			if f != "*" && f != "*/1" {
+				return "", fmt.Errorf("time cycle %q cannot be shifted past midnight", timeCycle)
+			}
+		}
+		total %= minutesInDay
+	}
+	fields[0], fields[1] = strconv.Itoa(total%60), strconv.Itoa(total/60)
+	return strings.Join(fields, " "), nil
 }
 
 func NextRun(schedule *Schedule, startTime time.Time) (time.Time, error) {
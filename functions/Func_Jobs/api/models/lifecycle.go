@@ -0,0 +1,106 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+)
+
+// LifecycleState is the stage of the life of a job, computed from its schedule and its runs.
+type LifecycleState string
+
+const (
+	// LifecycleActive jobs have runs left, drafts are always active.
+	LifecycleActive LifecycleState = "active"
+	// LifecycleCompleted jobs ran all of their runs.
+	LifecycleCompleted LifecycleState = "completed"
+	// LifecycleExpired jobs are past the end of their schedule with runs left.
+	LifecycleExpired LifecycleState = "expired"
+	// LifecycleArchived jobs were completed or expired for longer than the retention of the policy. Their workflows
+	// are deprovisioned and they are left out of the jobs unless asked for.
+	LifecycleArchived LifecycleState = "archived"
+)
+
+// LifecycleStates are the lifecycle states of jobs.
+var LifecycleStates = []LifecycleState{LifecycleActive, LifecycleCompleted, LifecycleExpired, LifecycleArchived}
+
+// ParseLifecycleState returns the lifecycle state with the given name.
+func ParseLifecycleState(s string) (LifecycleState, error) {
+	for _, state := range LifecycleStates {
+		if strings.EqualFold(s, string(state)) {
+			return state, nil
+		}
+	}
+	return "", fmt.Errorf("invalid lifecycle %q, it must be one of active, completed, expired or archived", s)
+}
+
+// LifecycleAt returns the lifecycle state of the job at the given time.
+func (j *Job) LifecycleAt(now time.Time) LifecycleState {
+	switch {
+	case j.ArchivedAt != nil:
+		return LifecycleArchived
+	case j.Draft:
+		return LifecycleActive
+	case j.TotalRecurrences > 0 && j.RunCount >= j.TotalRecurrences:
+		return LifecycleCompleted
+	}
+	if end, ok := j.scheduleEnd(); ok && end.Before(now) {
+		return LifecycleExpired
+	}
+	return LifecycleActive
+}
+
+// EndedAt returns the time a completed or expired job ended, the time of its last run or the end of its schedule.
+func (j *Job) EndedAt(now time.Time) (time.Time, bool) {
+	switch j.LifecycleAt(now) {
+	case LifecycleCompleted:
+		if j.LastRun != nil {
+			return *j.LastRun, true
+		}
+		if j.UpdatedAt != nil {
+			return *j.UpdatedAt, true
+		}
+	case LifecycleExpired:
+		return j.scheduleEnd()
+	}
+	return time.Time{}, false
+}
+
+// scheduleEnd returns the end of the schedule of the job. A one-time run is over once the day it was scheduled in
+// has passed, like the workflow running it.
+func (j *Job) scheduleEnd() (time.Time, bool) {
+	if j.Schedule == nil {
+		return time.Time{}, false
+	}
+	if j.Schedule.Once() {
+		at, err := j.Schedule.RunAtTime()
+		if err != nil {
+			return time.Time{}, false
+		}
+		return at.AddDate(0, 0, 1), true
+	}
+	if j.Schedule.End == "" {
+		return time.Time{}, false
+	}
+	end, err := time.Parse(time.RFC3339, j.Schedule.End)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return end, true
+}
+
+// LifecycleResponse lists the jobs whose lifecycle changed.
+type LifecycleResponse struct {
+	Resources []LifecycleChange `json:"resources" description:"Resources is the list of jobs whose lifecycle changed."`
+}
+
+// LifecycleChange is the change of the lifecycle of a single job.
+type LifecycleChange struct {
+	ID     string         `json:"id" description:"ID identifies the job."`
+	Name   string         `json:"name" description:"Name is the name of the job."`
+	From   LifecycleState `json:"from,omitempty" description:"From is the lifecycle saved with the job, empty for jobs saved before lifecycles."`
+	To     LifecycleState `json:"to,omitempty" description:"To is the lifecycle of the job, empty when the job could not be read."`
+	Errors []fdk.APIError `json:"errors,omitempty" description:"Errors explains why the change failed."`
+}
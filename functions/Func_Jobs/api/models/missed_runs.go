@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// MissedRuns flags the scheduled runs of a job which did not start. It is set by the missed runs check of
+// job_history, which compares the schedule of the job with its executions, and is never set by clients.
+type MissedRuns struct {
+	CheckedThrough *time.Time  `json:"checked_through,omitempty" description:"CheckedThrough is the time up to which the schedule of the job was checked."`
+	Count          int         `json:"count" description:"Count is the number of scheduled runs of the job which did not start."`
+	LastMissed     *time.Time  `json:"last_missed,omitempty" description:"LastMissed is the time of the latest scheduled run which did not start."`
+	Recent         []time.Time `json:"recent,omitempty" description:"Recent lists the times of the latest scheduled runs which did not start."`
+}
@@ -0,0 +1,165 @@
+package models
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+)
+
+// MinWebhookSecretLength is the minimum length of the shared secret webhook payloads are signed with.
+const MinWebhookSecretLength = 16
+
+// NotificationType is the channel a notification target is notified through.
+type NotificationType string
+
+const (
+	EmailNotification   NotificationType = "email"
+	WebhookNotification NotificationType = "webhook"
+)
+
+// NotificationTarget is notified when an execution of the job completes or fails.
+type NotificationTarget struct {
+	Type   NotificationType `json:"type" description:"Type is email or webhook."`
+	Email  string           `json:"email,omitempty" description:"Email is the email address of an email target."`
+	URL    string           `json:"url,omitempty" description:"URL is the https endpoint a webhook target is posted to."`
+	Secret string           `json:"secret,omitempty" description:"Secret is the HMAC shared secret a webhook payload is signed with. It is never returned."`
+}
+
+// validate checks a notification target, the secret of a webhook can be left out when updating a job to keep
+// the secret it was saved with.
+func (t NotificationTarget) validate(update bool) []fdk.APIError {
+	var errs []fdk.APIError
+	switch t.Type {
+	case EmailNotification:
+		if _, err := mail.ParseAddress(t.Email); err != nil {
+			errs = append(errs, NewValidationError(InvalidNotificationTarget, fmt.Sprintf("invalid notification email %q: %v", t.Email, err)))
+		}
+		if t.URL != "" || t.Secret != "" {
+			errs = append(errs, NewValidationError(InvalidNotificationTarget, fmt.Sprintf("url and secret can only be set for webhooks: %s", t.Email)))
+		}
+	case WebhookNotification:
+		u, err := url.Parse(t.URL)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			errs = append(errs, NewValidationError(InvalidNotificationTarget, fmt.Sprintf("invalid webhook url, an absolute https url is required: %s", t.URL)))
+		}
+		if t.Email != "" {
+			errs = append(errs, NewValidationError(InvalidNotificationTarget, fmt.Sprintf("email can only be set for email targets: %s", t.Email)))
+		}
+		if (t.Secret != "" || !update) && len(t.Secret) < MinWebhookSecretLength {
+			errs = append(errs, NewValidationError(InvalidNotificationTarget, fmt.Sprintf("webhook secret must be at least %d characters: %s", MinWebhookSecretLength, t.URL)))
+		}
+	default:
+		errs = append(errs, NewValidationError(InvalidNotificationTarget, fmt.Sprintf("invalid notification type: %s", t.Type)))
+	}
+	return errs
+}
+
+// EmailRecipients returns the email addresses of the notifications and of the email targets of the job.
+func (j *Job) EmailRecipients() []string {
+	seen := make(map[string]bool)
+	var recipients []string
+	add := func(email string) {
+		if email != "" && !seen[email] {
+			seen[email] = true
+			recipients = append(recipients, email)
+		}
+	}
+	for _, email := range j.Notifications {
+		add(email)
+	}
+	for _, t := range j.NotificationTargets {
+		if t.Type == EmailNotification {
+			add(t.Email)
+		}
+	}
+	return recipients
+}
+
+// KeepWebhookSecrets sets the secret of the webhooks left without one to the secret of the same webhook of the
+// previous version of the job. It returns the urls of the webhooks for which no secret is known.
+func (j *Job) KeepWebhookSecrets(previous *Job) []string {
+	secrets := make(map[string]string)
+	if previous != nil {
+		for _, t := range previous.NotificationTargets {
+			if t.Type == WebhookNotification {
+				secrets[t.URL] = t.Secret
+			}
+		}
+	}
+
+	var missing []string
+	for i, t := range j.NotificationTargets {
+		if t.Type != WebhookNotification || t.Secret != "" {
+			continue
+		}
+		if secret := secrets[t.URL]; secret != "" {
+			j.NotificationTargets[i].Secret = secret
+			continue
+		}
+		missing = append(missing, t.URL)
+	}
+	return missing
+}
+
+// RedactSecrets removes the webhook secrets of the job before it is returned.
+func (j *Job) RedactSecrets() {
+	j.NotificationTargets = RedactTargets(j.NotificationTargets)
+}
+
+// RedactTargets returns a copy of the notification targets without their secrets.
+func RedactTargets(targets []NotificationTarget) []NotificationTarget {
+	if targets == nil {
+		return nil
+	}
+	redacted := make([]NotificationTarget, len(targets))
+	for i, t := range targets {
+		t.Secret = ""
+		redacted[i] = t
+	}
+	return redacted
+}
+
+// NotificationRuleType is the condition under which a finished execution notifies the targets of its job.
+type NotificationRuleType string
+
+const (
+	// NotifyOnFailure notifies when the execution or any of its hosts failed.
+	NotifyOnFailure NotificationRuleType = "on_failure"
+	// NotifyOnAnyHostMatched notifies when a query matched on any host.
+	NotifyOnAnyHostMatched NotificationRuleType = "any_host_matched"
+	// NotifyOnFailedPercentage notifies when the percentage of failed hosts exceeds the threshold.
+	NotifyOnFailedPercentage NotificationRuleType = "failed_percentage_above"
+	// NotifyOnResultChanged notifies when the per host results differ from the previous execution.
+	NotifyOnResultChanged NotificationRuleType = "result_changed"
+)
+
+// NotificationRule restricts the notifications of a job. A job with rules only notifies when one of them
+// matches, a job without rules notifies of every execution.
+type NotificationRule struct {
+	Type      NotificationRuleType `json:"type" description:"Type is on_failure, any_host_matched, failed_percentage_above or result_changed."`
+	Threshold *float64             `json:"threshold,omitempty" description:"Threshold is the failed host percentage to exceed, failed_percentage_above only."`
+}
+
+func (r NotificationRule) validate(action *RTRAction) []fdk.APIError {
+	var errs []fdk.APIError
+	switch r.Type {
+	case NotifyOnFailure, NotifyOnResultChanged:
+	case NotifyOnAnyHostMatched:
+		if action != nil && action.Type != BuildQuery {
+			errs = append(errs, NewValidationError(InvalidNotificationRule, fmt.Sprintf("%s can only be used by %s actions", r.Type, BuildQuery)))
+		}
+	case NotifyOnFailedPercentage:
+		if r.Threshold == nil || *r.Threshold < 0 || *r.Threshold >= 100 {
+			errs = append(errs, NewValidationError(InvalidNotificationRule, fmt.Sprintf("%s requires a threshold from 0 to 100", r.Type)))
+		}
+		return errs
+	default:
+		errs = append(errs, NewValidationError(InvalidNotificationRule, fmt.Sprintf("invalid notification rule: %s", r.Type)))
+	}
+	if r.Threshold != nil {
+		errs = append(errs, NewValidationError(InvalidNotificationRule, fmt.Sprintf("threshold can only be set for %s", NotifyOnFailedPercentage)))
+	}
+	return errs
+}
@@ -0,0 +1,178 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+)
+
+// PlanApplySource is the source every change applied from a plan is attributed to, along with the caller.
+const PlanApplySource = "plan/apply"
+
+// PlanRequest holds the desired set of jobs. Jobs missing from the set are deleted when the plan is applied.
+type PlanRequest struct {
+	Jobs []JobDefinition `json:"jobs" description:"Jobs is the desired set of job definitions."`
+}
+
+// ApplyRequest applies the plan of the desired set of jobs. The plan is recomputed and only applied when it
+// still matches the plan the caller reviewed.
+type ApplyRequest struct {
+	PlanRequest
+	PlanID string `json:"plan_id" description:"PlanID identifies the reviewed plan."`
+}
+
+// Plan lists the changes needed for the jobs to match the desired set.
+type Plan struct {
+	ID      string       `json:"id" description:"ID identifies the plan, it changes whenever the desired or the current jobs change."`
+	Creates []PlanChange `json:"creates" description:"Creates is the list of jobs to create."`
+	Updates []PlanChange `json:"updates" description:"Updates is the list of jobs to update."`
+	Deletes []PlanChange `json:"deletes" description:"Deletes is the list of jobs to delete."`
+}
+
+// PlanChange is the change planned for a single job.
+type PlanChange struct {
+	Name  string      `json:"name" description:"Name is the name of the job."`
+	ID    string      `json:"id,omitempty" description:"ID identifies the existing job."`
+	Diffs []FieldDiff `json:"diffs,omitempty" description:"Diffs is the list of fields to update."`
+}
+
+// FieldDiff is the current and desired value of a field of a job.
+type FieldDiff struct {
+	Field   string      `json:"field" description:"Field is the name of the field."`
+	Current interface{} `json:"current" description:"Current is the value of the field of the existing job."`
+	Desired interface{} `json:"desired" description:"Desired is the value of the field in the desired set."`
+}
+
+// PlanResponse holds a plan.
+type PlanResponse struct {
+	Resource Plan `json:"resource" description:"Resource is the plan."`
+}
+
+// ApplyResponse holds the applied plan and the outcome of every change.
+type ApplyResponse struct {
+	Resource Plan          `json:"resource" description:"Resource is the applied plan."`
+	Results  []ApplyResult `json:"results" description:"Results is the outcome of every change of the plan."`
+}
+
+// ApplyResult is the outcome of a single change.
+type ApplyResult struct {
+	Name   string         `json:"name" description:"Name is the name of the job."`
+	ID     string         `json:"id,omitempty" description:"ID identifies the job."`
+	Action string         `json:"action" description:"Action is create, update or delete."`
+	Errors []fdk.APIError `json:"errors,omitempty" description:"Errors explains why the change failed."`
+}
+
+// Validate checks that every job of the desired set has a unique name.
+func (r *PlanRequest) Validate() []fdk.APIError {
+	var errs []fdk.APIError
+	names := make(map[string]bool, len(r.Jobs))
+	for _, d := range r.Jobs {
+		if d.Name == "" {
+			errs = append(errs, NewValidationError(JobNameIsRequired, "job name cannot be empty"))
+			continue
+		}
+		if names[d.Name] {
+			errs = append(errs, NewValidationError(InvalidJobBundle, fmt.Sprintf("job %q appears more than once in the desired set", d.Name)))
+		}
+		names[d.Name] = true
+	}
+	return errs
+}
+
+// DiffDefinitions compares the fields of two job definitions. Empty values are considered equal, so that a
+// field left out of the desired definition matches an empty field of the current job.
+func DiffDefinitions(current, desired JobDefinition) ([]FieldDiff, error) {
+	c, err := definitionFields(current)
+	if err != nil {
+		return nil, err
+	}
+	d, err := definitionFields(desired)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make(map[string]bool, len(c)+len(d))
+	for f := range c {
+		fields[f] = true
+	}
+	for f := range d {
+		fields[f] = true
+	}
+
+	var diffs []FieldDiff
+	for _, f := range sortedKeys(fields) {
+		if reflect.DeepEqual(c[f], d[f]) {
+			continue
+		}
+		diffs = append(diffs, FieldDiff{Field: f, Current: c[f], Desired: d[f]})
+	}
+	return diffs, nil
+}
+
+// definitionFields returns the non-empty fields of a definition by their json name.
+func definitionFields(d JobDefinition) (map[string]interface{}, error) {
+	b, err := json.Marshal(d)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+	pruned, _ := pruneEmpty(fields).(map[string]interface{})
+	return pruned, nil
+}
+
+// pruneEmpty drops the empty values of decoded json, returning nil when nothing is left.
+func pruneEmpty(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, e := range t {
+			if p := pruneEmpty(e); p != nil {
+				t[k] = p
+			} else {
+				delete(t, k)
+			}
+		}
+		if len(t) == 0 {
+			return nil
+		}
+	case []interface{}:
+		if len(t) == 0 {
+			return nil
+		}
+	case string:
+		if t == "" {
+			return nil
+		}
+	case bool:
+		if !t {
+			return nil
+		}
+	case float64:
+		if t == 0 {
+			return nil
+		}
+	}
+	return v
+}
+
+// Seal sorts the changes of the plan and sets its ID from its content.
+func (p *Plan) Seal() error {
+	for _, changes := range [][]PlanChange{p.Creates, p.Updates, p.Deletes} {
+		sort.Slice(changes, func(i, j int) bool { return changes[i].Name < changes[j].Name })
+	}
+	p.ID = ""
+	b, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(b)
+	p.ID = hex.EncodeToString(sum[:])
+	return nil
+}
@@ -0,0 +1,329 @@
+package models
+
+import (
+	"fmt"
+	"net/mail"
+	"path"
+	"strings"
+	"time"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+	"github.com/robfig/cron/v3"
+	"gopkg.in/yaml.v3"
+)
+
+// scheduleIntervalSamples is the number of consecutive runs of a schedule inspected for its shortest interval.
+const scheduleIntervalSamples = 100
+
+// registryHives maps the names of the registry hives to their abbreviations, which policy prefixes are compared with.
+var registryHives = map[string]string{
+	"hkey_classes_root":   "hkcr",
+	"hkey_current_user":   "hkcu",
+	"hkey_local_machine":  "hklm",
+	"hkey_users":          "hku",
+	"hkey_current_config": "hkcc",
+}
+
+// Policy is the organization wide policy every job must comply with, whoever creates it. It is loaded from
+// policy.yml on startup, the zero value of a setting does not restrict jobs.
+type Policy struct {
+	// MaxHostsPerJob is the maximum number of hosts a job can target.
+	MaxHostsPerJob int `yaml:"max_hosts_per_job"`
+	// MinScheduleIntervalMinutes is the minimum number of minutes between two runs of a scheduled job.
+	MinScheduleIntervalMinutes int `yaml:"min_schedule_interval_minutes"`
+	// FilePaths restricts the file paths queried, installed to or removed from hosts.
+	FilePaths PrefixRule `yaml:"file_paths"`
+	// RegistryKeys restricts the registry keys queried on hosts, by hive and key prefix.
+	RegistryKeys PrefixRule `yaml:"registry_keys"`
+	// NotificationEmailDomains are the only domains notification emails can be sent to.
+	NotificationEmailDomains []string `yaml:"notification_email_domains"`
+	// MaxActiveJobsPerUser is the maximum number of provisioned jobs with runs left a user can own.
+	MaxActiveJobsPerUser int `yaml:"max_active_jobs_per_user"`
+	// ApprovalRequiredActions are the action types approved by a second user before jobs are provisioned, in
+	// addition to the disruptive actions.
+	ApprovalRequiredActions []ActionType `yaml:"approval_required_actions"`
+	// ArchiveAfterDays is the number of days completed and expired jobs are kept before they are archived.
+	ArchiveAfterDays int `yaml:"archive_after_days"`
+}
+
+// PrefixRule allows and forbids paths by prefix. Prefixes match whole path segments, case-insensitively.
+type PrefixRule struct {
+	// Allowed are the only prefixes paths can start with, any path is allowed when empty.
+	Allowed []string `yaml:"allowed"`
+	// Forbidden are the prefixes paths cannot start with, they take precedence over the allowed prefixes.
+	Forbidden []string `yaml:"forbidden"`
+}
+
+// ParsePolicy decodes and checks the job policy from a policy.yml document.
+func ParsePolicy(b []byte) (Policy, error) {
+	var p Policy
+	if err := yaml.Unmarshal(b, &p); err != nil {
+		return p, fmt.Errorf("failed to parse job policy: %w", err)
+	}
+
+	var invalid []string
+	for name, v := range map[string]int{
+		"max_hosts_per_job":             p.MaxHostsPerJob,
+		"min_schedule_interval_minutes": p.MinScheduleIntervalMinutes,
+		"max_active_jobs_per_user":      p.MaxActiveJobsPerUser,
+		"archive_after_days":            p.ArchiveAfterDays,
+	} {
+		if v < 0 {
+			invalid = append(invalid, fmt.Sprintf("%s cannot be negative", name))
+		}
+	}
+	for name, prefixes := range map[string][]string{
+		"file_paths.allowed":         p.FilePaths.Allowed,
+		"file_paths.forbidden":       p.FilePaths.Forbidden,
+		"registry_keys.allowed":      p.RegistryKeys.Allowed,
+		"registry_keys.forbidden":    p.RegistryKeys.Forbidden,
+		"notification_email_domains": p.NotificationEmailDomains,
+	} {
+		for _, prefix := range prefixes {
+			if strings.TrimSpace(prefix) == "" {
+				invalid = append(invalid, fmt.Sprintf("%s cannot contain empty values", name))
+				break
+			}
+		}
+	}
+	for _, t := range p.ApprovalRequiredActions {
+		if _, ok := LookupAction(t); !ok {
+			invalid = append(invalid, fmt.Sprintf("approval_required_actions contains unknown action type %q", t))
+		}
+	}
+	if len(invalid) != 0 {
+		return p, fmt.Errorf("invalid job policy: %s", strings.Join(invalid, ", "))
+	}
+	return p, nil
+}
+
+// Evaluate checks the settings of a job against the policy, along with the paths and keys its action kind reports
+// in the given configuration. The targeted hosts and the jobs of the user are checked with CheckHostCount and
+// CheckActiveJobs, once they are known.
+func (p *Policy) Evaluate(j *Job, conf *Config) []fdk.APIError {
+	if p == nil {
+		return nil
+	}
+	var errs []fdk.APIError
+
+	if p.MinScheduleIntervalMinutes > 0 && j.Schedule != nil && j.Schedule.TimeCycle != "" {
+		interval, err := scheduleInterval(j.Schedule, time.Now().UTC())
+		// an incorrect schedule is reported by the validation of the job
+		if err == nil && interval > 0 && interval < time.Duration(p.MinScheduleIntervalMinutes)*time.Minute {
+			errs = append(errs, NewValidationError(PolicyScheduleIntervalTooShort,
+				fmt.Sprintf("schedule %q runs every %s, the policy requires at least %d minutes between runs", j.Schedule.TimeCycle, interval, p.MinScheduleIntervalMinutes)))
+		}
+	}
+
+	if j.Action != nil {
+		// an unknown action type is reported by the validation of the job
+		if kind, ok := LookupAction(j.Action.Type); ok {
+			filePaths, registryKeys := kind.Paths(j.Action, conf)
+			for _, fp := range dedupePaths(filePaths) {
+				if ok, reason := p.FilePaths.permits(splitFilePath(fp)); !ok {
+					errs = append(errs, NewValidationError(PolicyFilePathNotAllowed, fmt.Sprintf("file path %s is %s", fp, reason)))
+				}
+			}
+			for _, k := range dedupePaths(registryKeys) {
+				if ok, reason := p.RegistryKeys.permits(splitRegistryKey(k)); !ok {
+					errs = append(errs, NewValidationError(PolicyRegistryKeyNotAllowed, fmt.Sprintf("registry key %s is %s", k, reason)))
+				}
+			}
+		}
+	}
+
+	if len(p.NotificationEmailDomains) != 0 {
+		for _, email := range j.EmailRecipients() {
+			if !p.allowsEmail(email) {
+				errs = append(errs, NewValidationError(PolicyEmailDomainNotAllowed,
+					fmt.Sprintf("notification email %s is not in the allowed domains: %s", email, strings.Join(p.NotificationEmailDomains, ", "))))
+			}
+		}
+	}
+
+	return errs
+}
+
+// CheckHostCount checks the number of hosts targeted by a job against the policy.
+func (p *Policy) CheckHostCount(hostCount int) []fdk.APIError {
+	if p == nil || p.MaxHostsPerJob == 0 || hostCount <= p.MaxHostsPerJob {
+		return nil
+	}
+	return []fdk.APIError{NewValidationError(PolicyMaxHostsExceeded,
+		fmt.Sprintf("job targets %d hosts, the policy allows at most %d", hostCount, p.MaxHostsPerJob))}
+}
+
+// CheckActiveJobs checks the number of other active jobs of a user against the policy, before the user provisions
+// one more job.
+func (p *Policy) CheckActiveJobs(userID string, activeJobs int) []fdk.APIError {
+	if p == nil || p.MaxActiveJobsPerUser == 0 || activeJobs < p.MaxActiveJobsPerUser {
+		return nil
+	}
+	return []fdk.APIError{NewValidationError(PolicyMaxActiveJobsExceeded,
+		fmt.Sprintf("user %s already has %d active jobs, the policy allows at most %d", userID, activeJobs, p.MaxActiveJobsPerUser))}
+}
+
+// ArchiveDue reports whether a completed or expired job ended longer ago than the retention of the policy.
+func (p *Policy) ArchiveDue(j *Job, now time.Time) bool {
+	if p == nil || p.ArchiveAfterDays == 0 {
+		return false
+	}
+	ended, ok := j.EndedAt(now)
+	return ok && !now.Before(ended.AddDate(0, 0, p.ArchiveAfterDays))
+}
+
+func (p *Policy) allowsEmail(email string) bool {
+	addr, err := mail.ParseAddress(email)
+	if err != nil {
+		return false
+	}
+	at := strings.LastIndex(addr.Address, "@")
+	if at < 0 {
+		return false
+	}
+	domain := addr.Address[at+1:]
+	for _, d := range p.NotificationEmailDomains {
+		if strings.EqualFold(domain, strings.TrimPrefix(strings.TrimSpace(d), "@")) {
+			return true
+		}
+	}
+	return false
+}
+
+// Active reports whether a job is provisioned and has runs left.
+func (j *Job) Active(now time.Time) bool {
+	if j.Draft || j.Workflows == nil || j.DeletedAt != nil {
+		return false
+	}
+	if j.TotalRecurrences > 0 && j.RunCount >= j.TotalRecurrences {
+		return false
+	}
+	if j.Schedule != nil && j.Schedule.End != "" {
+		if end, err := time.Parse(time.RFC3339, j.Schedule.End); err == nil && end.Before(now) {
+			return false
+		}
+	}
+	return true
+}
+
+func dedupePaths(paths []string) []string {
+	seen := make(map[string]bool)
+	var unique []string
+	for _, p := range paths {
+		if !seen[p] {
+			seen[p] = true
+			unique = append(unique, p)
+		}
+	}
+	return unique
+}
+
+// permits reports whether the segments of a path are allowed by the rule, and why not if they are not.
+// Wildcards of the path match forbidden prefixes but never satisfy an allowed prefix.
+func (r PrefixRule) permits(segments []string, split func(string) []string) (bool, string) {
+	for _, prefix := range r.Forbidden {
+		if hasPrefixSegments(segments, split(prefix), true) {
+			return false, fmt.Sprintf("forbidden by the policy prefix %s", prefix)
+		}
+	}
+	if len(r.Allowed) == 0 {
+		return true, ""
+	}
+	for _, prefix := range r.Allowed {
+		if hasPrefixSegments(segments, split(prefix), false) {
+			return true, ""
+		}
+	}
+	return false, "not allowed by the policy"
+}
+
+func hasPrefixSegments(segments, prefix []string, wildcards bool) bool {
+	if len(prefix) == 0 || len(segments) < len(prefix) {
+		return false
+	}
+	for i, p := range prefix {
+		if segments[i] == p {
+			continue
+		}
+		if wildcards {
+			if ok, err := path.Match(segments[i], p); err == nil && ok {
+				continue
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// splitFilePath returns the lower case segments of a cleaned windows or unix path, along with the function
+// splitting policy prefixes the same way.
+func splitFilePath(p string) ([]string, func(string) []string) {
+	split := func(p string) []string {
+		p = path.Clean(strings.ReplaceAll(strings.ToLower(strings.TrimSpace(p)), `\`, "/"))
+		return strings.FieldsFunc(p, func(r rune) bool { return r == '/' })
+	}
+	return split(p), split
+}
+
+// isRegistryKey reports whether a path parameter of a script is a registry key rather than a file path, registry
+// keys start with a registry hive or with the registry provider.
+func isRegistryKey(p string) bool {
+	p = strings.ToLower(strings.TrimSpace(p))
+	if strings.HasPrefix(p, "registry::") {
+		return true
+	}
+	segments, _ := splitFilePath(p)
+	if len(segments) == 0 {
+		return false
+	}
+	hive := strings.TrimSuffix(segments[0], ":")
+	for name, abbr := range registryHives {
+		if hive == name || hive == abbr {
+			return true
+		}
+	}
+	return false
+}
+
+// splitRegistryKey returns the lower case segments of a registry key with its hive abbreviated, along with the
+// function splitting policy prefixes the same way.
+func splitRegistryKey(k string) ([]string, func(string) []string) {
+	split := func(k string) []string {
+		k = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(k)), "registry::")
+		segments, _ := splitFilePath(k)
+		if len(segments) != 0 {
+			hive := strings.TrimSuffix(segments[0], ":")
+			if abbr, ok := registryHives[hive]; ok {
+				hive = abbr
+			}
+			segments[0] = hive
+		}
+		return segments
+	}
+	return split(k), split
+}
+
+// scheduleInterval returns the shortest interval between the upcoming runs of a schedule.
+func scheduleInterval(schedule *Schedule, from time.Time) (time.Duration, error) {
+	expr := schedule.TimeCycle
+	if schedule.Timezone != "" {
+		expr = fmt.Sprintf("TZ=%s %s", schedule.Timezone, schedule.TimeCycle)
+	}
+	s, err := cron.ParseStandard(expr)
+	if err != nil {
+		return 0, err
+	}
+	prev := s.Next(from)
+	var shortest time.Duration
+	for i := 0; i < scheduleIntervalSamples; i++ {
+		next := s.Next(prev)
+		if next.IsZero() {
+			break
+		}
+		if interval := next.Sub(prev); shortest == 0 || interval < shortest {
+			shortest = interval
+		}
+		prev = next
+	}
+	return shortest, nil
+}
@@ -0,0 +1,305 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+)
+
+// MaxJobSteps is the maximum number of steps of a multi-step job.
+const MaxJobSteps = 10
+
+// Operations of the step runner script, every step runs as one or more of them.
+const (
+	// OperationCheckFile fails when the file does not exist.
+	OperationCheckFile = "check_file"
+	// OperationHashFile outputs the SHA256 of the file, it fails when the file does not exist.
+	OperationHashFile = "hash_file"
+	// OperationRemoveFile removes the file, it fails when the file cannot be removed.
+	OperationRemoveFile = "remove_file"
+	// OperationVerifyRemoved fails when the file still exists.
+	OperationVerifyRemoved = "verify_removed"
+	// OperationCheckRegistry outputs the data of the registry value, it fails when the key or value does not exist.
+	OperationCheckRegistry = "check_registry"
+	// OperationCheckProcess fails when no process with the name is running.
+	OperationCheckProcess = "check_process"
+)
+
+// JobStep is a single step of a multi-step job. Steps run in order on every host, a step which fails stops the
+// steps left unless it continues on failure.
+type JobStep struct {
+	Name              string          `json:"name,omitempty" description:"Name describes the step in the run history."`
+	Type              ActionType      `json:"type" description:"Type is the action type of the step, any action type which can run as a step."`
+	Parameters        json.RawMessage `json:"parameters,omitempty" description:"Parameters is the configuration of the action of the step, as in the action of a job of that type."`
+	ContinueOnFailure bool            `json:"continue_on_failure,omitempty" description:"ContinueOnFailure runs the next steps even if this step fails."`
+}
+
+// RunnerOperation is an operation of the step runner script.
+type RunnerOperation struct {
+	// Operation is one of the operations of the step runner script.
+	Operation string
+	// Target is the file, registry key or process the operation runs against.
+	Target string
+	// ValueName is the registry value of check_registry operations, the default value when empty.
+	ValueName string
+}
+
+// StepAction is implemented by the action kinds which can run as a step of a multi-step job. The step runner
+// script runs the operations the action translates to, in order.
+type StepAction interface {
+	// RunnerOperations returns the operations running the action, or why the action cannot run as a step.
+	RunnerOperations(action *RTRAction) ([]RunnerOperation, []fdk.APIError)
+}
+
+// action decodes the parameters of the step into the action of its type.
+func (s JobStep) action() (*RTRAction, error) {
+	action := &RTRAction{}
+	if len(s.Parameters) != 0 {
+		if err := json.Unmarshal(s.Parameters, action); err != nil {
+			return nil, fmt.Errorf("parameters must be the configuration of a %s action: %v", s.Type, err)
+		}
+	}
+	action.Type = s.Type
+	return action, nil
+}
+
+// resolve returns the action of the step along with its kind, which must be able to run as a step.
+func (s JobStep) resolve(i int) (*RTRAction, ActionKind, []fdk.APIError) {
+	kind, ok := LookupAction(s.Type)
+	if !ok {
+		return nil, nil, []fdk.APIError{NewValidationError(InvalidJobStep, fmt.Sprintf("step %d: invalid action type: %s", i+1, s.Type))}
+	}
+	if _, ok := kind.(StepAction); !ok {
+		return nil, nil, []fdk.APIError{NewValidationError(InvalidJobStep, fmt.Sprintf("step %d: %s actions cannot run as a step", i+1, s.Type))}
+	}
+	action, err := s.action()
+	if err != nil {
+		return nil, nil, []fdk.APIError{NewValidationError(InvalidJobStep, fmt.Sprintf("step %d: %v", i+1, err))}
+	}
+	return action, kind, nil
+}
+
+// operations returns the runner operations of the step, along with the errors of its action.
+func (s JobStep) operations(i int, platforms []Platform) ([]RunnerOperation, []fdk.APIError) {
+	action, kind, errs := s.resolve(i)
+	if len(errs) != 0 {
+		return nil, errs
+	}
+	for _, e := range kind.Validate(action, platforms) {
+		e.Message = fmt.Sprintf("step %d: %s", i+1, e.Message)
+		errs = append(errs, e)
+	}
+	if len(errs) != 0 {
+		return nil, errs
+	}
+	ops, errs := kind.(StepAction).RunnerOperations(action)
+	for j := range errs {
+		errs[j].Message = fmt.Sprintf("step %d: %s", i+1, errs[j].Message)
+	}
+	return ops, errs
+}
+
+// stepsKind runs an ordered list of steps with the step runner script, in a single workflow.
+type stepsKind struct{}
+
+func (stepsKind) Validate(action *RTRAction, platforms []Platform) []fdk.APIError {
+	var errs []fdk.APIError
+	if len(action.Steps) == 0 || len(action.Steps) > MaxJobSteps {
+		errs = append(errs, NewValidationError(InvalidJobStep, fmt.Sprintf("a job runs from 1 to %d steps: %d", MaxJobSteps, len(action.Steps))))
+	}
+	// the steps run on the windows hosts the job is restricted to
+	for i, s := range action.Steps {
+		_, stepErrs := s.operations(i, []Platform{Windows})
+		errs = append(errs, stepErrs...)
+	}
+	errs = append(errs, windowsOnly(Steps, platforms)...)
+	return errs
+}
+
+func (stepsKind) Templates(job *Job, conf *Config) ([]ActionTemplate, []fdk.APIError) {
+	var steps []runnerStep
+	for i, s := range job.Action.Steps {
+		ops, errs := s.operations(i, []Platform{Windows})
+		if len(errs) != 0 {
+			return nil, errs
+		}
+		name := s.Name
+		if name == "" {
+			name = fmt.Sprintf("%d. %s", i+1, s.Type)
+		}
+		steps = append(steps, runnerStep{name: name, operations: ops, continueOnFailure: s.ContinueOnFailure})
+	}
+	return []ActionTemplate{runnerTemplate(conf, steps)}, nil
+}
+
+// runnerStep is a step run by the step runner script as one or more operations.
+type runnerStep struct {
+	name              string
+	operations        []RunnerOperation
+	continueOnFailure bool
+}
+
+// runnerTemplate returns the template of the step runner script running the operations of the steps in order.
+// The operations of a step are named after the step, along with their target when there are several.
+func runnerTemplate(conf *Config, steps []runnerStep) ActionTemplate {
+	var names, types, targets, valueNames, continueOnFailure []string
+	for _, s := range steps {
+		for _, op := range s.operations {
+			name := s.name
+			if len(s.operations) > 1 {
+				name = fmt.Sprintf("%s: %s %s", s.name, op.Operation, op.Target)
+			}
+			names = append(names, name)
+			types = append(types, op.Operation)
+			targets = append(targets, op.Target)
+			valueNames = append(valueNames, op.ValueName)
+			continueOnFailure = append(continueOnFailure, strconv.FormatBool(s.continueOnFailure))
+		}
+	}
+	t := conf.Templates.Steps
+	return ActionTemplate{
+		Platform:        Windows,
+		Name:            t.Name,
+		ConditionNodeID: t.ConditionNodeID,
+		ActivityNodeID:  t.ActivityNodeID,
+		Properties: map[string][]string{
+			"names":               names,
+			"types":               types,
+			"targets":             targets,
+			"value_names":         valueNames,
+			"continue_on_failure": continueOnFailure,
+		},
+	}
+}
+
+// Paths returns the paths and keys reported by the kind of every step.
+func (stepsKind) Paths(action *RTRAction, conf *Config) ([]string, []string) {
+	var filePaths, registryKeys []string
+	for i, s := range action.Steps {
+		stepAction, kind, errs := s.resolve(i)
+		if len(errs) != 0 {
+			continue
+		}
+		f, r := kind.Paths(stepAction, conf)
+		filePaths = append(filePaths, f...)
+		registryKeys = append(registryKeys, r...)
+	}
+	return filePaths, registryKeys
+}
+
+// Disruptive reports whether the action of any of the steps is disruptive.
+func (stepsKind) Disruptive(action *RTRAction, conf *Config) bool {
+	for i, s := range action.Steps {
+		stepAction, kind, errs := s.resolve(i)
+		if len(errs) != 0 {
+			continue
+		}
+		if d, ok := kind.(DisruptiveAction); ok && d.Disruptive(stepAction, conf) {
+			return true
+		}
+	}
+	return false
+}
+
+// FileAction lists the files on hosts of the hashFile and removeFile actions.
+type FileAction struct {
+	FilePaths []string `json:"file_paths,omitempty" description:"FilePaths is the list of files to hash or remove."`
+}
+
+func (action FileAction) validate() []fdk.APIError {
+	var errs []fdk.APIError
+	if len(action.FilePaths) == 0 {
+		errs = append(errs, NewValidationError(InvalidActionConfig, "file paths cannot be empty"))
+	}
+	for _, p := range action.FilePaths {
+		if strings.TrimSpace(p) == "" {
+			errs = append(errs, NewValidationError(InvalidActionConfig, "file paths cannot contain empty paths"))
+			break
+		}
+	}
+	return errs
+}
+
+// fileKind runs the given operations on every file of the action with the step runner script, either as a step
+// or as the single step of a job.
+type fileKind struct {
+	actionType ActionType
+	operations []string
+	disruptive bool
+}
+
+func (k fileKind) Validate(action *RTRAction, platforms []Platform) []fdk.APIError {
+	return append(action.FileAction.validate(), windowsOnly(k.actionType, platforms)...)
+}
+
+func (k fileKind) Templates(job *Job, conf *Config) ([]ActionTemplate, []fdk.APIError) {
+	ops, errs := k.RunnerOperations(job.Action)
+	if len(errs) != 0 {
+		return nil, errs
+	}
+	return []ActionTemplate{runnerTemplate(conf, []runnerStep{{name: string(k.actionType), operations: ops}})}, nil
+}
+
+func (fileKind) Paths(action *RTRAction, _ *Config) ([]string, []string) {
+	return action.FilePaths, nil
+}
+
+func (k fileKind) Disruptive(*RTRAction, *Config) bool {
+	return k.disruptive
+}
+
+func (k fileKind) RunnerOperations(action *RTRAction) ([]RunnerOperation, []fdk.APIError) {
+	var ops []RunnerOperation
+	for _, p := range action.FilePaths {
+		for _, op := range k.operations {
+			ops = append(ops, RunnerOperation{Operation: op, Target: p})
+		}
+	}
+	return ops, nil
+}
+
+// RunnerOperations checks for the queried files, registry values or processes. The comparisons and attributes of
+// the query are not run by the step runner script.
+func (buildQueryKind) RunnerOperations(action *RTRAction) ([]RunnerOperation, []fdk.APIError) {
+	var ops []RunnerOperation
+	switch action.QueryType {
+	case File:
+		if len(action.FileAttributes) != 0 {
+			return nil, []fdk.APIError{NewValidationError(InvalidJobStep, "file attributes cannot be checked by a step")}
+		}
+		for _, p := range action.QueryFilePaths {
+			ops = append(ops, RunnerOperation{Operation: OperationCheckFile, Target: p})
+		}
+	case RegistryKey:
+		for _, r := range action.RegistryKeys {
+			if r.Operator != "" || r.Data != "" {
+				return nil, []fdk.APIError{NewValidationError(InvalidJobStep, fmt.Sprintf("registry data cannot be compared by a step: %s", r.Key))}
+			}
+			ops = append(ops, RunnerOperation{Operation: OperationCheckRegistry, Target: r.Key, ValueName: r.ValueName})
+		}
+	case Process:
+		for _, ps := range action.Processes {
+			if strings.TrimSpace(ps.Name) == "" || ps.Path != "" {
+				return nil, []fdk.APIError{NewValidationError(InvalidJobStep, "processes are only looked up by name by a step")}
+			}
+			ops = append(ops, RunnerOperation{Operation: OperationCheckProcess, Target: ps.Name})
+		}
+	default:
+		return nil, []fdk.APIError{NewValidationError(InvalidJobStep, fmt.Sprintf("%s queries cannot run as a step", action.QueryType))}
+	}
+	return ops, nil
+}
+
+// windowsOnly rejects the platforms other than windows, the step runner script only runs on windows hosts.
+func windowsOnly(actionType ActionType, platforms []Platform) []fdk.APIError {
+	var errs []fdk.APIError
+	for _, p := range platforms {
+		if p != Windows {
+			errs = append(errs, NewValidationError(InvalidJobTarget, fmt.Sprintf("%s jobs only run on %s hosts: %s", actionType, Windows, p)))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,59 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+)
+
+// GroupingTagPrefix prefixes the Falcon grouping tags of hosts, it is added by job_history when tagging hosts.
+const GroupingTagPrefix = "FalconGroupingTags/"
+
+// groupingTagRE matches the characters Falcon allows in grouping tags.
+var groupingTagRE = regexp.MustCompile(`^[A-Za-z0-9_/-]{1,256}$`)
+
+// HostTagging tags the hosts of a build query job with Falcon grouping tags by the result of each host, once an
+// execution completes. Hosts on which the query failed are left untouched.
+type HostTagging struct {
+	MatchTags   []string `json:"match_tags,omitempty" description:"MatchTags are applied to the hosts on which the query matched, such as SRTR/job/match."`
+	NoMatchTags []string `json:"no_match_tags,omitempty" description:"NoMatchTags are applied to the hosts on which the query did not match."`
+	RemoveStale bool     `json:"remove_stale,omitempty" description:"RemoveStale removes the tags of the other result from every host, so the tags follow the latest result."`
+}
+
+// Normalize strips the grouping tag prefix from the tags, job_history adds it back.
+func (t *HostTagging) Normalize() {
+	for _, tags := range [][]string{t.MatchTags, t.NoMatchTags} {
+		for i, tag := range tags {
+			tags[i] = strings.TrimPrefix(strings.TrimSpace(tag), GroupingTagPrefix)
+		}
+	}
+}
+
+func (t *HostTagging) validate(action *RTRAction) []fdk.APIError {
+	var errs []fdk.APIError
+	if action != nil && action.Type != BuildQuery {
+		errs = append(errs, NewValidationError(InvalidHostTagging, fmt.Sprintf("hosts can only be tagged by %s actions", BuildQuery)))
+	}
+	if len(t.MatchTags) == 0 && len(t.NoMatchTags) == 0 {
+		errs = append(errs, NewValidationError(InvalidHostTagging, "host tagging requires match or no match tags"))
+	}
+	match := make(map[string]bool)
+	for _, tag := range t.MatchTags {
+		match[strings.ToLower(tag)] = true
+	}
+	for _, tags := range [][]string{t.MatchTags, t.NoMatchTags} {
+		for _, tag := range tags {
+			if !groupingTagRE.MatchString(tag) {
+				errs = append(errs, NewValidationError(InvalidHostTagging, fmt.Sprintf("invalid grouping tag %q: only letters, digits, _, - and / are allowed", tag)))
+			}
+		}
+	}
+	for _, tag := range t.NoMatchTags {
+		if match[strings.ToLower(tag)] {
+			errs = append(errs, NewValidationError(InvalidHostTagging, fmt.Sprintf("grouping tag %s cannot be both a match and a no match tag", tag)))
+		}
+	}
+	return errs
+}
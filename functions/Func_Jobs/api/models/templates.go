@@ -0,0 +1,290 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Crowdstrike/foundry-sample-scalable-rtr/functions/Func_Jobs/api/scripts"
+	"gopkg.in/yaml.v3"
+)
+
+// ParseTemplates decodes the workflow templates from a templates.yml document.
+func ParseTemplates(b []byte) (Templates, error) {
+	var t Templates
+	if err := yaml.Unmarshal(b, &t); err != nil {
+		return t, fmt.Errorf("failed to parse workflow templates: %w", err)
+	}
+	return t, nil
+}
+
+// workflowDefinition is the part of a workflow definition under workflows/ describing its parameterized nodes, and
+// the inputs and loop actions of an on demand workflow.
+type workflowDefinition struct {
+	Name    string `yaml:"name"`
+	Trigger struct {
+		Parameters struct {
+			Properties map[string]any `yaml:"properties"`
+		} `yaml:"parameters"`
+	} `yaml:"trigger"`
+	Loops map[string]struct {
+		Actions map[string]any `yaml:"actions"`
+	} `yaml:"loops"`
+	Parameters struct {
+		Actions struct {
+			Configuration map[string]any `yaml:"configuration"`
+		} `yaml:"actions"`
+		Conditions map[string][]struct {
+			Fields map[string]any `yaml:"fields"`
+		} `yaml:"conditions"`
+	} `yaml:"parameters"`
+}
+
+func (d workflowDefinition) hasLoopAction(nodeID string) bool {
+	for _, l := range d.Loops {
+		if _, ok := l.Actions[nodeID]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (d workflowDefinition) hasConditionField(nodeID, field string) bool {
+	for _, c := range d.Parameters.Conditions[nodeID] {
+		if _, ok := c.Fields[field]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Verify checks every template against the workflow definitions in workflowsDir. Templates are looked up by the
+// workflow names of the manifest.yml next to workflowsDir, or by the name within the definitions. The disruptive
+// flags of the scripts are checked against the manifest when there is one. All the missing templates, nodes and
+// fields are reported at once.
+func (t Templates) Verify(workflowsDir string) error {
+	m, err := loadManifest(workflowsDir)
+	if err != nil {
+		return err
+	}
+	defs, err := loadWorkflowDefinitions(workflowsDir, m)
+	if err != nil {
+		return err
+	}
+
+	var missing []string
+	check := func(ref string, name string, verify func(d workflowDefinition) []string) {
+		if name == "" {
+			missing = append(missing, fmt.Sprintf("%s: template name is empty", ref))
+			return
+		}
+		d, ok := defs[name]
+		if !ok {
+			missing = append(missing, fmt.Sprintf("%s: workflow %q not found in %s", ref, name, workflowsDir))
+			return
+		}
+		for _, m := range verify(d) {
+			missing = append(missing, fmt.Sprintf("%s: workflow %q %s", ref, name, m))
+		}
+	}
+	actionTemplate := func(wt WorkflowTemplate) func(d workflowDefinition) []string {
+		return func(d workflowDefinition) []string {
+			var m []string
+			if _, ok := d.Parameters.Actions.Configuration[wt.ActivityNodeID]; !ok {
+				m = append(m, fmt.Sprintf("has no parameterized activity node %q", wt.ActivityNodeID))
+			}
+			if _, ok := d.Parameters.Conditions[wt.ConditionNodeID]; !ok {
+				m = append(m, fmt.Sprintf("has no parameterized condition node %q", wt.ConditionNodeID))
+				return m
+			}
+			for _, f := range []string{t.HostsField, t.HostGroupsField} {
+				if !d.hasConditionField(wt.ConditionNodeID, f) {
+					m = append(m, fmt.Sprintf("has no field %q in condition node %q", f, wt.ConditionNodeID))
+				}
+			}
+			return m
+		}
+	}
+
+	// on demand twins are not provisioned, they take the job and its targeted hosts as inputs and run the activity
+	// node for each of the hosts
+	onDemandTemplate := func(wt WorkflowTemplate) func(d workflowDefinition) []string {
+		return func(d workflowDefinition) []string {
+			var m []string
+			for _, in := range OnDemandInputs {
+				if _, ok := d.Trigger.Parameters.Properties[in]; !ok {
+					m = append(m, fmt.Sprintf("has no trigger input %q", in))
+				}
+			}
+			if !d.hasLoopAction(wt.ActivityNodeID) {
+				m = append(m, fmt.Sprintf("has no activity node %q looping over the targeted hosts", wt.ActivityNodeID))
+			}
+			return m
+		}
+	}
+
+	// action templates are checked along with their on demand twin
+	checkAction := func(ref string, wt WorkflowTemplate) {
+		check(ref, wt.Name, actionTemplate(wt))
+		if wt.Name != "" {
+			check(ref, OnDemandTemplateName(wt.Name), onDemandTemplate(wt))
+		}
+	}
+
+	checkAction("registry_query", t.RegistryQuery)
+	checkAction("process_service_query", t.ProcessServiceQuery)
+	checkAction("steps", t.Steps)
+	for _, p := range sortedKeys(t.FileQueries) {
+		checkAction(fmt.Sprintf("file_queries.%s", p), t.FileQueries[p])
+	}
+	for _, s := range sortedKeys(t.Scripts) {
+		checkAction(fmt.Sprintf("scripts.%s", s), t.Scripts[s].WorkflowTemplate)
+		for _, m := range missingScriptInputs(s, t.Scripts[s].PathParameters) {
+			missing = append(missing, fmt.Sprintf("scripts.%s: %s", s, m))
+		}
+		if m == nil {
+			continue
+		}
+		flag, ok := m.disruptive(s)
+		switch d := t.Scripts[s].Disruptive; {
+		case !ok:
+			missing = append(missing, fmt.Sprintf("scripts.%s: script not found in the manifest", s))
+		case d == nil:
+			missing = append(missing, fmt.Sprintf("scripts.%s: disruptive is not set, the manifest declares %t", s, flag))
+		case *d != flag:
+			missing = append(missing, fmt.Sprintf("scripts.%s: disruptive is %t, the manifest declares %t", s, *d, flag))
+		}
+	}
+	n := t.ExecutionNotifier
+	check("execution_notifier", n.Name, func(d workflowDefinition) []string {
+		var m []string
+		if _, ok := d.Parameters.Actions.Configuration[n.EmailNodeID]; !ok {
+			m = append(m, fmt.Sprintf("has no parameterized activity node %q", n.EmailNodeID))
+		}
+		if !d.hasConditionField(n.ConditionNodeID, n.DefinitionIDField) {
+			m = append(m, fmt.Sprintf("has no field %q in condition node %q", n.DefinitionIDField, n.ConditionNodeID))
+		}
+		return m
+	})
+
+	if len(missing) != 0 {
+		return errors.New("workflow templates are out of sync with the workflow definitions:\n  " + strings.Join(missing, "\n  "))
+	}
+	return nil
+}
+
+// missingScriptInputs returns the inputs which are not declared in the input schema of the script.
+func missingScriptInputs(script string, inputs []string) []string {
+	if len(inputs) == 0 {
+		return nil
+	}
+	b, err := scripts.InputSchema(script)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	var schema struct {
+		Properties map[string]any `json:"properties"`
+	}
+	if err := json.Unmarshal(b, &schema); err != nil {
+		return []string{fmt.Sprintf("failed to parse input schema: %v", err)}
+	}
+	var m []string
+	for _, in := range inputs {
+		if _, ok := schema.Properties[in]; !ok {
+			m = append(m, fmt.Sprintf("input %q not found in the input schema of the script", in))
+		}
+	}
+	return m
+}
+
+// manifest is the part of the manifest.yml of the app declaring its workflows and RTR scripts.
+type manifest struct {
+	Workflows []struct {
+		Name string `yaml:"name"`
+		Path string `yaml:"path"`
+	} `yaml:"workflows"`
+	RTRScripts []struct {
+		Name                string `yaml:"name"`
+		WorkflowIntegration struct {
+			Disruptive bool `yaml:"disruptive"`
+		} `yaml:"workflow_integration"`
+	} `yaml:"rtr_scripts"`
+}
+
+// disruptive returns the workflow_integration.disruptive flag of the named script.
+func (m *manifest) disruptive(script string) (bool, bool) {
+	for _, s := range m.RTRScripts {
+		if s.Name == script {
+			return s.WorkflowIntegration.Disruptive, true
+		}
+	}
+	return false, false
+}
+
+// loadManifest reads the manifest.yml next to the workflows dir, no manifest is returned when there is none.
+func loadManifest(workflowsDir string) (*manifest, error) {
+	b, err := os.ReadFile(filepath.Join(workflowsDir, "..", "manifest.yml"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var m manifest
+	if err := yaml.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	return &m, nil
+}
+
+// loadWorkflowDefinitions reads the definitions in dir keyed by their name in the manifest and in the definition.
+func loadWorkflowDefinitions(dir string, m *manifest) (map[string]workflowDefinition, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.yml"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no workflow definitions found in %s", dir)
+	}
+
+	defs := make(map[string]workflowDefinition)
+	byFile := make(map[string]workflowDefinition)
+	for _, f := range files {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		var d workflowDefinition
+		if err := yaml.Unmarshal(b, &d); err != nil {
+			return nil, fmt.Errorf("failed to parse workflow definition %s: %w", f, err)
+		}
+		defs[d.Name] = d
+		byFile[filepath.Base(f)] = d
+	}
+
+	// the templates are provisioned by the names declared in the manifest
+	if m == nil {
+		return defs, nil
+	}
+	for _, w := range m.Workflows {
+		if d, ok := byFile[filepath.Base(w.Path)]; ok {
+			defs[w.Name] = d
+		}
+	}
+	return defs, nil
+}
+
+func sortedKeys[K ~string, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i] < keys[j]
+	})
+	return keys
+}
@@ -0,0 +1,292 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+	"github.com/Crowdstrike/foundry-sample-scalable-rtr/functions/Func_Jobs/api/models"
+	"github.com/crowdstrike/gofalcon/falcon/client"
+)
+
+const (
+	planCreate = "create"
+	planUpdate = "update"
+	planDelete = "delete"
+)
+
+// PlanJobsHandler plans the changes needed for the jobs to match a desired set.
+type PlanJobsHandler struct {
+	conf *models.Config
+}
+
+func NewPlanJobsHandler(conf *models.Config) *PlanJobsHandler {
+	return &PlanJobsHandler{
+		conf: conf,
+	}
+}
+
+func (h *PlanJobsHandler) Handle(ctx context.Context, request fdk.Request) fdk.Response {
+	response := fdk.Response{}
+
+	var req models.PlanRequest
+	err := json.NewDecoder(request.Body).Decode(&req)
+	if err != nil {
+		response.Code = http.StatusBadRequest
+		response.Errors = append(response.Errors, models.NewAPIError(http.StatusBadRequest, fmt.Sprintf("Failed to unmarshal Request body err: %v.", err)))
+		return response
+	}
+
+	if errs := req.Validate(); len(errs) != 0 {
+		response.Code = http.StatusBadRequest
+		response.Errors = errs
+		return response
+	}
+
+	client, err := models.FalconClient(ctx, h.conf, request)
+	if err != nil {
+		response.Code = http.StatusInternalServerError
+		response.Errors = append(response.Errors, fdk.APIError{Code: http.StatusBadRequest, Message: "fail to initialize client"})
+		return response
+	}
+
+	plan, _, errs := planJobs(ctx, req.Jobs, h.conf, client)
+	if len(errs) != 0 {
+		response.Code = http.StatusInternalServerError
+		response.Errors = errs
+		return response
+	}
+
+	body, err := json.Marshal(models.PlanResponse{Resource: *plan})
+	if err != nil {
+		response.Code = http.StatusInternalServerError
+		response.Errors = append(response.Errors, models.NewAPIError(http.StatusInternalServerError, fmt.Sprintf("failed to marshal the response body with err: %v", err)))
+		return response
+	}
+
+	response.Body = json.RawMessage(body)
+	response.Code = http.StatusOK
+	return response
+}
+
+// ApplyJobsHandler applies a reviewed plan through the upsert and deletion of jobs.
+type ApplyJobsHandler struct {
+	conf   *models.Config
+	upsert *UpsertJobHandler
+}
+
+func NewApplyJobsHandler(conf *models.Config) *ApplyJobsHandler {
+	return &ApplyJobsHandler{
+		conf:   conf,
+		upsert: NewUpsertJobHandler(conf),
+	}
+}
+
+func (h *ApplyJobsHandler) Handle(ctx context.Context, request fdk.Request) fdk.Response {
+	response := fdk.Response{}
+
+	var req models.ApplyRequest
+	err := json.NewDecoder(request.Body).Decode(&req)
+	if err != nil {
+		response.Code = http.StatusBadRequest
+		response.Errors = append(response.Errors, models.NewAPIError(http.StatusBadRequest, fmt.Sprintf("Failed to unmarshal Request body err: %v.", err)))
+		return response
+	}
+
+	errs := req.Validate()
+	if req.PlanID == "" {
+		errs = append(errs, models.NewAPIError(http.StatusBadRequest, "plan id cannot be empty"))
+	}
+	if len(errs) != 0 {
+		response.Code = http.StatusBadRequest
+		response.Errors = errs
+		return response
+	}
+
+	client, err := models.FalconClient(ctx, h.conf, request)
+	if err != nil {
+		response.Code = http.StatusInternalServerError
+		response.Errors = append(response.Errors, fdk.APIError{Code: http.StatusBadRequest, Message: "fail to initialize client"})
+		return response
+	}
+
+	plan, current, errs := planJobs(ctx, req.Jobs, h.conf, client)
+	if len(errs) != 0 {
+		response.Code = http.StatusInternalServerError
+		response.Errors = errs
+		return response
+	}
+	if plan.ID != req.PlanID {
+		response.Code = http.StatusConflict
+		response.Errors = append(response.Errors, models.NewAPIError(http.StatusConflict, fmt.Sprintf("plan %s is out of date, the jobs changed since it was computed. Review the new plan %s", req.PlanID, plan.ID)))
+		return response
+	}
+
+	caller, errs := callerIdentity(ctx, request, client)
+	if len(errs) != 0 {
+		response.Code = errs[0].Code
+		response.Errors = errs
+		return response
+	}
+
+	result := h.apply(ctx, caller, plan, req.Jobs, current, client)
+
+	body, err := json.Marshal(result)
+	if err != nil {
+		response.Code = http.StatusInternalServerError
+		response.Errors = append(response.Errors, models.NewAPIError(http.StatusInternalServerError, fmt.Sprintf("failed to marshal the response body with err: %v", err)))
+		return response
+	}
+
+	response.Body = json.RawMessage(body)
+	response.Code = http.StatusOK
+	return response
+}
+
+// apply creates, updates and then deletes the jobs of the plan, a failing change does not stop the others. The
+// changes are attributed to the caller through plan/apply.
+func (h *ApplyJobsHandler) apply(ctx context.Context, caller models.Identity, plan *models.Plan, desired []models.JobDefinition, current map[string]*models.Job, client *client.CrowdStrikeAPISpecification) *models.ApplyResponse {
+	caller.Source = models.PlanApplySource
+	definitions := make(map[string]models.JobDefinition, len(desired))
+	for _, d := range desired {
+		definitions[d.Name] = d
+	}
+
+	response := models.ApplyResponse{Resource: *plan, Results: make([]models.ApplyResult, 0)}
+	for _, c := range plan.Creates {
+		response.Results = append(response.Results, h.upsertDefinition(ctx, caller, planCreate, definitions[c.Name], nil, client))
+	}
+	for _, c := range plan.Updates {
+		response.Results = append(response.Results, h.upsertDefinition(ctx, caller, planUpdate, definitions[c.Name], current[c.Name], client))
+	}
+	for _, c := range plan.Deletes {
+		result := models.ApplyResult{Name: c.Name, ID: c.ID, Action: planDelete}
+		result.Errors = h.delete(ctx, caller, current[c.Name], client)
+		response.Results = append(response.Results, result)
+	}
+	return &response
+}
+
+func (h *ApplyJobsHandler) upsertDefinition(ctx context.Context, caller models.Identity, action string, d models.JobDefinition, existing *models.Job, client *client.CrowdStrikeAPISpecification) models.ApplyResult {
+	result := models.ApplyResult{Name: d.Name, Action: action}
+
+	job := d.Job()
+	if existing != nil {
+		carryOver(&job, existing)
+		result.ID = existing.ID
+	}
+
+	upsertResult, errs := h.upsert.upsertJob(ctx, job.Draft, caller, &models.UpsertJobRequest{Job: job}, client)
+	if len(errs) != 0 {
+		result.Errors = errs
+		return result
+	}
+	result.ID = upsertResult.Resource
+	return result
+}
+
+func (h *ApplyJobsHandler) delete(ctx context.Context, caller models.Identity, job *models.Job, client *client.CrowdStrikeAPISpecification) []fdk.APIError {
+	if errs := authorizeEdit(ctx, caller, job, nil, h.conf, client); len(errs) != 0 {
+		return errs
+	}
+	if errs := deleteJob(ctx, job, h.conf, client); len(errs) != 0 {
+		return errs
+	}
+	now := time.Now()
+	job.ModifiedBy = &caller
+	job.UpdatedAt = &now
+	return auditLogProducer(ctx, JobDeleted, job, h.conf, client)
+}
+
+// planJobs compares the desired set of jobs with the jobs of the custom storage. It returns the plan along
+// with the current jobs by name.
+func planJobs(ctx context.Context, desired []models.JobDefinition, conf *models.Config, client *client.CrowdStrikeAPISpecification) (*models.Plan, map[string]*models.Job, []fdk.APIError) {
+	ids, errs := allJobIDs(ctx, conf, client)
+	if len(errs) != 0 {
+		return nil, nil, errs
+	}
+	current := make(map[string]*models.Job, len(ids))
+	for _, id := range ids {
+		job, errs := jobInfo(ctx, id, conf, client)
+		if len(errs) != 0 {
+			return nil, nil, errs
+		}
+		if job.DeletedAt != nil {
+			continue
+		}
+		current[job.Name] = job
+	}
+
+	plan := models.Plan{
+		Creates: make([]models.PlanChange, 0),
+		Updates: make([]models.PlanChange, 0),
+		Deletes: make([]models.PlanChange, 0),
+	}
+	wanted := make(map[string]bool, len(desired))
+	for _, d := range desired {
+		wanted[d.Name] = true
+		normalized, err := normalizeDefinition(d)
+		if err != nil {
+			return nil, nil, []fdk.APIError{models.NewAPIError(http.StatusInternalServerError, fmt.Sprintf("failed to normalize job: %s with err: %v", d.Name, err))}
+		}
+
+		existing, ok := current[d.Name]
+		var base models.JobDefinition
+		if ok {
+			base = models.NewJobDefinition(existing)
+		}
+		// secrets are never returned, a changed secret is applied without showing up in the plan
+		base.NotificationTargets = models.RedactTargets(base.NotificationTargets)
+		normalized.NotificationTargets = models.RedactTargets(normalized.NotificationTargets)
+		diffs, err := models.DiffDefinitions(base, normalized)
+		if err != nil {
+			return nil, nil, []fdk.APIError{models.NewAPIError(http.StatusInternalServerError, fmt.Sprintf("failed to compare job: %s with err: %v", d.Name, err))}
+		}
+
+		switch {
+		case !ok:
+			plan.Creates = append(plan.Creates, models.PlanChange{Name: d.Name, Diffs: diffs})
+		case len(diffs) != 0:
+			plan.Updates = append(plan.Updates, models.PlanChange{Name: d.Name, ID: existing.ID, Diffs: diffs})
+		}
+	}
+	for name, job := range current {
+		if !wanted[name] {
+			plan.Deletes = append(plan.Deletes, models.PlanChange{Name: name, ID: job.ID})
+		}
+	}
+
+	if err := plan.Seal(); err != nil {
+		return nil, nil, []fdk.APIError{models.NewAPIError(http.StatusInternalServerError, fmt.Sprintf("failed to seal the plan with err: %v", err))}
+	}
+	return &plan, current, nil
+}
+
+// normalizeDefinition applies the defaults the upsert stores a job with, so that an unchanged job does not
+// show up as an update.
+func normalizeDefinition(d models.JobDefinition) (models.JobDefinition, error) {
+	// deep copy, the schedule is updated in place
+	b, err := json.Marshal(d)
+	if err != nil {
+		return d, err
+	}
+	var job models.Job
+	if err := json.Unmarshal(b, &job); err != nil {
+		return d, err
+	}
+
+	if !job.Draft {
+		updateSchedule(&job)
+		if job.Target != nil {
+			job.Target.Platforms = job.Target.TargetPlatforms()
+		}
+	}
+	if job.OutputFormat == nil {
+		job.OutputFormat = append(job.OutputFormat, "logscale", "csv")
+	}
+	job = adjustRecurrence(job)
+	return models.NewJobDefinition(&job), nil
+}
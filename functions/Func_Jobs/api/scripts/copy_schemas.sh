@@ -0,0 +1,9 @@
+#!/bin/sh
+# Copies the input schema of every RTR script of the app next to the scripts package so it can be embedded.
+set -e
+cd "$(dirname "$0")"
+for d in ../../../../rtr-scripts/*/; do
+  n=$(basename "$d")
+  mkdir -p "$n"
+  cp "$d/input_schema.json" "$n/"
+done
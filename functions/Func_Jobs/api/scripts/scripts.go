@@ -0,0 +1,38 @@
+// Package scripts embeds the input schemas of the RTR scripts declared in the app, so the parameters of jobs
+// running a script can be validated at upsert time. The schemas are copied from the rtr-scripts directory of the
+// app, run go generate after adding or changing a script.
+package scripts
+
+//go:generate ./copy_schemas.sh
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+)
+
+//go:embed */input_schema.json
+var schemas embed.FS
+
+// InputSchema returns the input schema of the named RTR script.
+func InputSchema(name string) ([]byte, error) {
+	b, err := schemas.ReadFile(name + "/input_schema.json")
+	if err != nil {
+		return nil, fmt.Errorf("unknown rtr script %q: %w", name, err)
+	}
+	return b, nil
+}
+
+// Names returns the names of the RTR scripts declared in the app.
+func Names() []string {
+	entries, _ := fs.ReadDir(schemas, ".")
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -6,7 +6,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"math"
 	"net/http"
 	"strconv"
 	"strings"
@@ -25,10 +24,14 @@ import (
 const (
 	JobCreated       ActionTaken = "Created"
 	JobEdited        ActionTaken = "Updated"
+	JobDeleted       ActionTaken = "Deleted"
+	JobAccessDenied  ActionTaken = "Access Denied"
+	JobApproved      ActionTaken = "Approved"
+	JobRejected      ActionTaken = "Rejected"
+	JobArchived      ActionTaken = "Archived"
 	deviceHostGroups             = "groups"
 	staticMaxLimit               = 1000
-
-	secInDay = 86400
+	deviceQueryLimit             = 5000
 )
 
 const (
@@ -58,6 +61,11 @@ func auditLogProducer(ctx context.Context, event ActionTaken, req *models.Job, c
 		JobID:      req.ID,
 		ID:         logId,
 	}
+	if req.ModifiedBy != nil {
+		auditLogsBody.ModifiedBy = req.ModifiedBy.UserName
+		auditLogsBody.ModifiedByID = req.ModifiedBy.UserID
+		auditLogsBody.Source = req.ModifiedBy.Source
+	}
 
 	rawObject, err := json.Marshal(auditLogsBody)
 	if err != nil {
@@ -80,8 +88,10 @@ func auditLogProducer(ctx context.Context, event ActionTaken, req *models.Job, c
 	return errs
 }
 
+// putJob saves a job to custom storage along with its lifecycle, so that jobs can be searched by lifecycle.
 func putJob(ctx context.Context, req *models.Job, conf *models.Config, client *client.CrowdStrikeAPISpecification) (string, []fdk.APIError) {
 	var errs []fdk.APIError
+	req.Lifecycle = req.LifecycleAt(time.Now().UTC())
 	rawObject, err := json.Marshal(req)
 	if err != nil {
 		return "", []fdk.APIError{{
@@ -120,7 +130,123 @@ func putJob(ctx context.Context, req *models.Job, conf *models.Config, client *c
 	return *response.GetPayload().Resources[0].ObjectKey, errs
 }
 
+// deleteJob deprovisions the workflows of a job, along with its pending runs downstream of other jobs, before
+// removing it from the custom storage.
+func deleteJob(ctx context.Context, job *models.Job, conf *models.Config, client *client.CrowdStrikeAPISpecification) []fdk.APIError {
+	if errs := deprovisionChainedRuns(ctx, job, conf, client); len(errs) != 0 {
+		return errs
+	}
+	if errs := deprovisionWorkflows(ctx, job.Workflows, client); len(errs) != 0 {
+		return errs
+	}
+	if errs := unindexWorkflows(ctx, job.Workflows, conf, client); len(errs) != 0 {
+		return errs
+	}
+
+	customJobRequest := custom_storage.NewDeleteObjectParamsWithContext(ctx)
+	customJobRequest.SetObjectKey(job.ID)
+	customJobRequest.SetCollectionName(conf.JobsCollection)
+
+	response, err := client.CustomStorage.DeleteObject(customJobRequest)
+	if err != nil {
+		return []fdk.APIError{{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}}
+	}
+	if len(response.GetPayload().Errors) > 0 {
+		return convertMsaErrorsToAPIErrors(response.GetPayload().Errors)
+	}
+	return nil
+}
+
+// deprovisionWorkflows deprovisions the workflows provisioned for a job, the notifier first so that it does
+// not report on a partially deprovisioned job.
+func deprovisionWorkflows(ctx context.Context, info *models.WorkflowsInfo, client *client.CrowdStrikeAPISpecification) []fdk.APIError {
+	if info == nil {
+		return nil
+	}
+	definitionIDs := append([]string{info.NotifierWorkflow}, info.ScheduleWorkflow...)
+
+	var errs []fdk.APIError
+	deprovisionAll := false
+	for _, id := range definitionIDs {
+		if id == "" {
+			continue
+		}
+		definitionID := id
+		deprovisionReq := workflows.NewDeprovisionParamsWithContext(ctx)
+		deprovisionReq.SetBody(&model.ClientSystemDefinitionDeProvisionRequest{
+			DefinitionID:   &definitionID,
+			DeprovisionAll: &deprovisionAll,
+		})
+		resp, err := client.Workflows.Deprovision(deprovisionReq)
+		if err != nil {
+			errs = append(errs, models.NewAPIError(http.StatusInternalServerError, fmt.Sprintf("failed to deprovision workflow: %s with err: %v", id, err)))
+			continue
+		}
+		if len(resp.GetPayload().Errors) != 0 {
+			errs = append(errs, convertMsaErrorsToAPIErrors(resp.GetPayload().Errors)...)
+		}
+	}
+	return errs
+}
+
+// staleWorkflows returns the previous workflows of a job which are not part of its current workflows.
+func staleWorkflows(previous, current *models.WorkflowsInfo) *models.WorkflowsInfo {
+	if previous == nil {
+		return nil
+	}
+	inUse := make(map[string]bool)
+	if current != nil {
+		inUse[current.NotifierWorkflow] = true
+		for _, id := range current.ScheduleWorkflow {
+			inUse[id] = true
+		}
+	}
+
+	stale := &models.WorkflowsInfo{}
+	if !inUse[previous.NotifierWorkflow] {
+		stale.NotifierWorkflow = previous.NotifierWorkflow
+	}
+	for _, id := range previous.ScheduleWorkflow {
+		if !inUse[id] {
+			stale.ScheduleWorkflow = append(stale.ScheduleWorkflow, id)
+		}
+	}
+	return stale
+}
+
+// storedJob returns the job saved with the given id, nil if there is none.
+func storedJob(ctx context.Context, id string, conf *models.Config, client *client.CrowdStrikeAPISpecification) (*models.Job, []fdk.APIError) {
+	job, errs := jobInfo(ctx, id, conf, client)
+	if len(errs) != 0 {
+		if errs[0].Code == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, errs
+	}
+	return job, nil
+}
+
+// jobInfo returns the job saved with the given id, along with its next run and lifecycle as of now.
 func jobInfo(ctx context.Context, id string, conf *models.Config, client *client.CrowdStrikeAPISpecification) (*models.Job, []fdk.APIError) {
+	result, errs := fetchJob(ctx, id, conf, client)
+	if len(errs) != 0 {
+		return nil, errs
+	}
+
+	if result.OutputFormat == nil {
+		result.OutputFormat = append(result.OutputFormat, "logscale", "csv")
+	}
+	*result = adjustRecurrence(*result)
+	result.Lifecycle = result.LifecycleAt(time.Now().UTC())
+
+	return result, nil
+}
+
+// fetchJob returns the job saved with the given id as it is stored.
+func fetchJob(ctx context.Context, id string, conf *models.Config, client *client.CrowdStrikeAPISpecification) (*models.Job, []fdk.APIError) {
 	var errs []fdk.APIError
 
 	customJobRequest := custom_storage.NewGetObjectParamsWithContext(ctx)
@@ -153,61 +279,20 @@ func jobInfo(ctx context.Context, id string, conf *models.Config, client *client
 		}}
 	}
 
-	if result.OutputFormat == nil {
-		result.OutputFormat = append(result.OutputFormat, "logscale", "csv")
-	}
-	result = adjustRecurrence(result)
-
 	return &result, errs
 }
 
+// adjustRecurrence clears the next run of a job which ran all of its runs.
 func adjustRecurrence(j models.Job) models.Job {
 	if j.Draft {
 		return j
 	}
-	if j.RunNowSchedule != nil {
-		if j.TotalRecurrences > 0 && j.RunCount == j.TotalRecurrences {
-			j.NextRun = nil
-		}
-		if j.Schedule == nil {
-			return j
-		}
-	}
-	if j.Schedule == nil || j.Schedule.TimeCycle == "" || j.Schedule.End == "" || j.Schedule.Start == "" {
-		return j
-	}
-
-	// If end-start == 1 day AND time cycle is one day, then there is no recurrence.
-	start, _ := strToTime(j.Schedule.Start)
-	end, _ := strToTime(j.Schedule.End)
-	if math.Abs(end.Sub(start).Seconds()-secInDay) > 0.1 {
-		// start and end are one day apart
-		return j
-	}
-	nextRun, _ := models.NextRun(j.Schedule, start)
-	if math.Abs(nextRun.Sub(end).Seconds()) <= 0.1 {
-		// cron expression is one day
-		j.Schedule.TimeCycle = ""
-	}
-
-	if j.TotalRecurrences > 0 && j.RunCount == j.TotalRecurrences {
+	if j.TotalRecurrences > 0 && j.RunCount >= j.TotalRecurrences {
 		j.NextRun = nil
 	}
-
 	return j
 }
 
-func strToTime(s string) (time.Time, error) {
-	t, err := time.Parse(ISOTimeFormatOffset, s)
-	if err != nil {
-		t, err = time.Parse(ISOTimeFormat, s)
-		if err != nil {
-			return t, fmt.Errorf("failed to parse time: %s", err)
-		}
-	}
-	return t, nil
-}
-
 func search(ctx context.Context, req models.SearchObjectsRequest, client *client.CrowdStrikeAPISpecification) (models.SearchObjectsResponse, []fdk.APIError) {
 	limit := 100
 	if req.Limit > 0 {
@@ -377,13 +462,14 @@ func auditList(ctx context.Context, conf *models.Config, offset string, preDir b
 
 func provisionWorkflowForExec(ctx context.Context, req *models.Job, conf *models.Config, workflowIDs []string, client *client.CrowdStrikeAPISpecification) (string, []fdk.APIError) {
 	var errs []fdk.APIError
-	conditionNodeID := "definitionID_is_equal_to_parameterized_79b66807"
+	notifier := conf.Templates.ExecutionNotifier
+	conditionNodeID := notifier.ConditionNodeID
 	op := "IN"
-	propName := "Trigger.Category.WorkflowExecution.DefinitionID"
+	propName := notifier.DefinitionIDField
 
 	reqBody := &model.ClientSystemDefinitionProvisionRequest{}
 	reqBody.Name = &req.Name
-	reqBody.TemplateName = &conf.ExecutionNotifierWorkflow
+	reqBody.TemplateName = &notifier.Name
 	reqBody.Parameters = &model.ParameterTemplateProvisionParameters{}
 
 	reqBody.Parameters.Conditions = []*model.ParameterConditionProvisionParameter{
@@ -399,11 +485,11 @@ func provisionWorkflowForExec(ctx context.Context, req *models.Job, conf *models
 		},
 	}
 
-	emailNodeID := "send_email_1fddc95a"
+	emailNodeID := notifier.EmailNodeID
 	emailNotification := model.ParameterActivityConfigProvisionParameter{
 		NodeID: &emailNodeID,
 		Properties: map[string]interface{}{
-			"to": req.Notifications,
+			"to": req.EmailRecipients(),
 		},
 	}
 	reqBody.Parameters.Activities = &model.ParameterActivityProvisionParameters{}
@@ -429,60 +515,30 @@ func provisionWorkflowForExec(ctx context.Context, req *models.Job, conf *models
 	return resp.GetPayload().Resources[0], errs
 }
 
-func provisionWorkflowWithAct(ctx context.Context, req *models.Job, conf *models.Config, client *client.CrowdStrikeAPISpecification) ([]string, []fdk.APIError) {
+// provisionWorkflowWithAct provisions the workflows running the action of a job, for each template and wave. It
+// returns the IDs of the provisioned definitions, along with the runs of the on demand workflows of the app which
+// start a run now job once it is saved.
+func provisionWorkflowWithAct(ctx context.Context, req *models.Job, id string, waves [][]string, conf *models.Config, client *client.CrowdStrikeAPISpecification) ([]string, []models.OnDemandRun, []fdk.APIError) {
 	var errs []fdk.APIError
 	var workflowIDs []string
+	var runs []models.OnDemandRun
 
-	triggerNodeID := "trigger"
-	reqBody := &model.ClientSystemDefinitionProvisionRequest{}
-	reqBody.Parameters = &model.ParameterTemplateProvisionParameters{}
-	reqBody.Parameters.Trigger = &model.ParameterTriggerProvisionParameter{}
-	reqBody.Parameters.Activities = &model.ParameterActivityProvisionParameters{}
-	conditionForHostAndGroupsName := model.ParameterConditionProvisionParameter{
-		Fields: []*model.ParameterConditionFieldProvisionParameter{},
-	}
-
-	switch req.Action.Type {
-	case models.BuildQuery:
-		buildQueryNodeID := "check_file_or_registry_exist_abb289a5"
-		buildQuery := model.ParameterActivityConfigProvisionParameter{
-			NodeID: &buildQueryNodeID,
-		}
-		conditionForHostAndGroupsName.NodeID = &conf.FileExistConditionNodeID
-		templateName := &conf.BuildQFileExistTemplateName
-		if req.Action.BuildQueryAction.QueryType == models.RegistryKey {
-			conditionForHostAndGroupsName.NodeID = &conf.RegistryKeyValueConditionNodeID
-			buildQueryNodeID = "check_registry_exist_3e0e47d3"
-			templateName = &conf.BuildQRegistryKeyValueExistTemplateName
-			var keys, values []string
-			for _, registryKeyVal := range req.Action.BuildQueryAction.RegistryKeys {
-				keys = append(keys, registryKeyVal.Key)
-				values = append(values, registryKeyVal.Value)
-			}
-
-			buildQuery.Properties = map[string][]string{
-				"keys":   keys,
-				"values": values,
-			}
-		} else {
-			buildQuery.Properties = map[string]interface{}{
-				"keys": req.Action.BuildQueryAction.QueryFilePaths,
-			}
-		}
-
-		reqBody.Parameters.Activities.Configuration = append(reqBody.Parameters.Activities.Configuration, &buildQuery)
-		reqBody.TemplateName = templateName
-	default:
-		return nil, []fdk.APIError{{
+	kind, ok := models.LookupAction(req.Action.Type)
+	if !ok {
+		return nil, nil, []fdk.APIError{{
 			Code:    http.StatusInternalServerError,
 			Message: fmt.Sprintf("Handle type is incorrect %s", req.Action.Type.String()),
 		}}
 	}
+	templates, errs := kind.Templates(req, conf)
+	if len(errs) != 0 {
+		return nil, nil, errs
+	}
 
 	op := "IN"
 	opNotIN := "NOT_IN"
-	hostNameField := "device_query_78798221.Device.query.devices.#"
-	groupNameField := "get_device_details_d2e382bd.Device.GetDetails.Groups"
+	hostNameField := conf.Templates.HostsField
+	groupNameField := conf.Templates.HostGroupsField
 	hostNameCondition := &model.ParameterConditionFieldProvisionParameter{
 		Name:  &hostNameField,
 		Value: req.Target.Hosts,
@@ -502,82 +558,259 @@ func provisionWorkflowWithAct(ctx context.Context, req *models.Job, conf *models
 		hostNameCondition.Value = []string{"undefined"}
 	}
 
-	conditionForHostAndGroupsName.Fields = append(conditionForHostAndGroupsName.Fields, groupNameCondition, hostNameCondition)
-	reqBody.Parameters.Conditions = append(reqBody.Parameters.Conditions, &conditionForHostAndGroupsName)
-
-	if req.RunNowSchedule != nil {
-		schedule := map[string]interface{}{
-			"time_cycle":      req.RunNowSchedule.TimeCycle,
-			"tz":              req.RunNowSchedule.Timezone,
-			"skip_concurrent": false,
-		}
-		if len(req.RunNowSchedule.Start) > 0 {
-			schedule["start_date"] = req.RunNowSchedule.Start
+	// without batching a single wave targets the hosts and groups as requested
+	numWaves := len(waves)
+	if numWaves == 0 {
+		numWaves = 1
+	}
+	delay := 0
+	if req.Target.Batching != nil {
+		delay = req.Target.Batching.WaveDelayMinutes
+		// the last wave is delayed the most, a schedule which cannot be delayed that much is rejected before any
+		// workflow is provisioned
+		if req.WSchedule != nil {
+			if _, err := delaySchedule(req.WSchedule, req.Target.Batching.LastWaveDelayMinutes(numWaves)); err != nil {
+				return nil, nil, []fdk.APIError{models.NewValidationError(models.InvalidBatchConfig, err.Error())}
+			}
 		}
-		if len(req.RunNowSchedule.End) > 0 {
-			schedule["end_date"] = req.RunNowSchedule.End
+	}
+
+	// the on demand workflows of an unbatched run now job target every resolved device at once
+	var deviceIDs []string
+	if req.RunNow && len(waves) == 0 {
+		deviceIDs, errs = targetDeviceIDs(ctx, req.Target, client)
+		if len(errs) != 0 {
+			return nil, nil, errs
 		}
-		scheduleParams := model.ParameterTriggerFieldParameter{
-			Properties: schedule,
+	}
+
+	// the workflows provisioned before a failure are deprovisioned rather than left running
+	fail := func(errs []fdk.APIError) ([]string, []models.OnDemandRun, []fdk.APIError) {
+		return nil, nil, append(errs, deprovisionWorkflows(ctx, &models.WorkflowsInfo{ScheduleWorkflow: workflowIDs}, client)...)
+	}
+
+	for _, t := range templates {
+		activityNodeID := t.ActivityNodeID
+		reqBody := &model.ClientSystemDefinitionProvisionRequest{}
+		reqBody.TemplateName = &t.Name
+		reqBody.Parameters = &model.ParameterTemplateProvisionParameters{}
+		reqBody.Parameters.Trigger = &model.ParameterTriggerProvisionParameter{}
+		reqBody.Parameters.Activities = &model.ParameterActivityProvisionParameters{}
+		reqBody.Parameters.Activities.Configuration = append(reqBody.Parameters.Activities.Configuration, &model.ParameterActivityConfigProvisionParameter{
+			NodeID:     &activityNodeID,
+			Properties: t.Properties,
+		})
+		reqBody.Parameters.Conditions = append(reqBody.Parameters.Conditions, &model.ParameterConditionProvisionParameter{
+			NodeID: &t.ConditionNodeID,
+			Fields: []*model.ParameterConditionFieldProvisionParameter{groupNameCondition, hostNameCondition},
+		})
+
+		platformSuffix := models.PlatformSuffix(t.Platform)
+
+		for wave := 0; wave < numWaves; wave++ {
+			suffix := platformSuffix
+			if len(waves) != 0 {
+				// each wave targets its own batch of the resolved device ids
+				hostNameCondition.Operator = &op
+				hostNameCondition.Value = waves[wave]
+				groupNameCondition.Operator = &opNotIN
+				groupNameCondition.Value = []string{"undefined"}
+			}
+			if numWaves > 1 {
+				suffix = fmt.Sprintf(models.WaveNameFormat, wave+1) + platformSuffix
+			}
+
+			if req.RunNow {
+				if wave == 0 || delay == 0 {
+					targeted := deviceIDs
+					if len(waves) != 0 {
+						targeted = waves[wave]
+					}
+					run, err := models.NewOnDemandRun(id, wave+1, t, targeted)
+					if err != nil {
+						return fail([]fdk.APIError{models.NewAPIError(http.StatusInternalServerError, err.Error())})
+					}
+					runs = append(runs, run)
+				} else {
+					// on demand executions cannot be delayed, the later waves of a run now job start from a one-time timer
+					workflowID, errs := provisionScheduledWorkflow(ctx, reqBody, req.Name+" RunNow"+suffix, delayedRunSchedule(req, wave*delay), client)
+					if len(errs) != 0 {
+						return fail(errs)
+					}
+					workflowIDs = append(workflowIDs, workflowID)
+				}
+			}
+
+			if req.WSchedule != nil {
+				schedule, err := delaySchedule(req.WSchedule, wave*delay)
+				if err != nil {
+					return fail([]fdk.APIError{models.NewValidationError(models.InvalidBatchConfig, err.Error())})
+				}
+				workflowID, errs := provisionScheduledWorkflow(ctx, reqBody, req.Name+" Schedule"+suffix, schedule, client)
+				if len(errs) != 0 {
+					return fail(errs)
+				}
+				workflowIDs = append(workflowIDs, workflowID)
+			}
 		}
+	}
 
-		reqBody.Parameters.Trigger.NodeID = &triggerNodeID
-		reqBody.Parameters.Trigger.Fields = make(map[string]model.ParameterTriggerFieldParameter)
-		reqBody.Parameters.Trigger.Fields["timer_event_definition"] = scheduleParams
-		name := req.Name + " RunNow"
-		reqBody.Name = &name
+	return workflowIDs, runs, errs
+}
 
-		provisionReq := workflows.NewProvisionParams()
-		provisionReq.SetBody(reqBody)
-		provisionReq.SetContext(ctx)
-		resp, err := client.Workflows.Provision(provisionReq)
+// executeOnDemandRuns starts the on demand workflows of the app with their inputs and returns the IDs of their
+// executions. The executions started before a failure are returned along with the error.
+func executeOnDemandRuns(ctx context.Context, runs []models.OnDemandRun, client *client.CrowdStrikeAPISpecification) ([]string, []fdk.APIError) {
+	var executionIDs []string
+	for _, run := range runs {
+		executeReq := workflows.NewExecuteParamsWithContext(ctx)
+		executeReq.SetName(&run.Name)
+		executeReq.SetBody(run.Inputs)
+		resp, err := client.Workflows.Execute(executeReq)
 		if err != nil {
-			return nil, []fdk.APIError{{
-				Code:    http.StatusInternalServerError,
-				Message: err.Error(),
-			}}
+			return executionIDs, []fdk.APIError{models.NewAPIError(http.StatusInternalServerError, fmt.Sprintf("failed to execute workflow: %s with err: %v", run.Name, err))}
 		}
 		if len(resp.GetPayload().Errors) != 0 {
-			errs = convertMsaErrorsToAPIErrors(resp.GetPayload().Errors)
-			return nil, errs
-		}
-		if len(resp.GetPayload().Resources) == 0 {
-			return nil, []fdk.APIError{
-				{
-					Code:    2001,
-					Message: fmt.Sprintf("resources from workflow is 0 response:%v", resp),
-				},
-			}
+			return executionIDs, convertMsaErrorsToAPIErrors(resp.GetPayload().Errors)
 		}
-		workflowIDs = append(workflowIDs, resp.GetPayload().Resources[0])
+		executionIDs = append(executionIDs, resp.GetPayload().Resources...)
+	}
+	return executionIDs, nil
+}
+
+// provisionScheduledWorkflow provisions the template described by reqBody with a timer trigger for the schedule.
+func provisionScheduledWorkflow(ctx context.Context, reqBody *model.ClientSystemDefinitionProvisionRequest, name string, sch *models.Schedule, client *client.CrowdStrikeAPISpecification) (string, []fdk.APIError) {
+	triggerNodeID := "trigger"
+	schedule := map[string]interface{}{
+		"time_cycle":      sch.TimeCycle,
+		"tz":              sch.Timezone,
+		"skip_concurrent": false,
+	}
+	if len(sch.Start) > 0 {
+		schedule["start_date"] = sch.Start
+	}
+	if len(sch.End) > 0 {
+		schedule["end_date"] = sch.End
+	}
+	scheduleParams := model.ParameterTriggerFieldParameter{
+		Properties: schedule,
 	}
 
-	if req.WSchedule != nil {
-		schedule := map[string]interface{}{
-			"time_cycle":      req.WSchedule.TimeCycle,
-			"tz":              req.WSchedule.Timezone,
-			"skip_concurrent": false,
+	reqBody.Parameters.Trigger.NodeID = &triggerNodeID
+	reqBody.Parameters.Trigger.Fields = make(map[string]model.ParameterTriggerFieldParameter)
+	reqBody.Parameters.Trigger.Fields["timer_event_definition"] = scheduleParams
+	reqBody.Name = &name
+
+	provisionReq := workflows.NewProvisionParams()
+	provisionReq.SetBody(reqBody)
+	provisionReq.SetContext(ctx)
+	resp, err := client.Workflows.Provision(provisionReq)
+	if err != nil {
+		return "", []fdk.APIError{{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}}
+	}
+	if len(resp.GetPayload().Errors) != 0 {
+		return "", convertMsaErrorsToAPIErrors(resp.GetPayload().Errors)
+	}
+	if len(resp.GetPayload().Resources) == 0 {
+		return "", []fdk.APIError{
+			{
+				Code:    2001,
+				Message: fmt.Sprintf("resources from workflow is 0 response:%v", resp),
+			},
 		}
-		if len(req.WSchedule.Start) > 0 {
-			schedule["start_date"] = req.WSchedule.Start
+	}
+	return resp.GetPayload().Resources[0], nil
+}
+
+// delaySchedule returns a copy of the schedule whose time cycle starts the given number of minutes later.
+func delaySchedule(sch *models.Schedule, minutes int) (*models.Schedule, error) {
+	if minutes == 0 {
+		return sch, nil
+	}
+	if sch.Once() {
+		at, err := time.Parse(time.RFC3339, sch.RunAt)
+		if err != nil {
+			return nil, err
 		}
-		if len(req.WSchedule.End) > 0 {
-			schedule["end_date"] = req.WSchedule.End
+		loc, err := time.LoadLocation(sch.Timezone)
+		if err != nil {
+			return nil, err
 		}
-		scheduleParams := model.ParameterTriggerFieldParameter{
-			Properties: schedule,
+		return models.OnceSchedule(at.In(loc).Add(time.Duration(minutes) * time.Minute)), nil
+	}
+	timeCycle, err := models.ShiftTimeCycle(sch.TimeCycle, minutes)
+	if err != nil {
+		return nil, err
+	}
+	delayed := *sch
+	delayed.TimeCycle = timeCycle
+	return &delayed, nil
+}
+
+// targetWaves resolves the targeted hosts and groups into device ids and splits them into batches.
+// No waves are returned when the job does not use batching.
+func targetWaves(ctx context.Context, target *models.TargetHost, client *client.CrowdStrikeAPISpecification) ([][]string, []fdk.APIError) {
+	if target.Batching == nil {
+		return nil, nil
+	}
+
+	deviceIDs, errs := targetDeviceIDs(ctx, target, client)
+	if len(errs) != 0 {
+		return nil, errs
+	}
+
+	size := target.Batching.MaxHostsPerWave
+	var waves [][]string
+	for i := 0; i < len(deviceIDs); i += size {
+		end := i + size
+		if end > len(deviceIDs) {
+			end = len(deviceIDs)
 		}
+		waves = append(waves, deviceIDs[i:end])
+	}
+	if len(waves) > models.MaxWaves {
+		return nil, []fdk.APIError{models.NewValidationError(models.InvalidBatchConfig,
+			fmt.Sprintf("%d hosts split into %d waves exceeds the maximum of %d waves", len(deviceIDs), len(waves), models.MaxWaves))}
+	}
+	return waves, nil
+}
 
-		reqBody.Parameters.Trigger.NodeID = &triggerNodeID
-		reqBody.Parameters.Trigger.Fields = make(map[string]model.ParameterTriggerFieldParameter)
-		reqBody.Parameters.Trigger.Fields["timer_event_definition"] = scheduleParams
+// targetDeviceIDs resolves the targeted hosts and groups into device ids.
+func targetDeviceIDs(ctx context.Context, target *models.TargetHost, client *client.CrowdStrikeAPISpecification) ([]string, []fdk.APIError) {
+	deviceIDs := append([]string{}, target.Hosts...)
+	if len(target.HostGroups) != 0 {
+		groupDeviceIDs, errs := getDeviceIDsForHostGroup(ctx, target.HostGroups, client)
+		if len(errs) != 0 {
+			return nil, errs
+		}
+		deviceIDs = append(deviceIDs, groupDeviceIDs...)
+	}
+	deviceIDs = dedupe(deviceIDs)
+	if len(deviceIDs) == 0 {
+		return nil, []fdk.APIError{models.NewValidationError(models.InvalidJobTarget, "target hosts and groups do not resolve to any host")}
+	}
+	return deviceIDs, nil
+}
 
-		name := req.Name + " Schedule"
-		reqBody.Name = &name
-		provisionReq := workflows.NewProvisionParams()
-		provisionReq.SetBody(reqBody)
-		provisionReq.SetContext(ctx)
-		resp, err := client.Workflows.Provision(provisionReq)
+func getDeviceIDsForHostGroup(ctx context.Context, hostgroups []string, client *client.CrowdStrikeAPISpecification) ([]string, []fdk.APIError) {
+	var fqlStrings []string
+	for _, grp := range hostgroups {
+		fqlStrings = append(fqlStrings, fmt.Sprintf("%s:'%s'", deviceHostGroups, grp))
+	}
+	fql := strings.Join(fqlStrings, ",")
+
+	var deviceIDs []string
+	limit := int64(deviceQueryLimit)
+	offset := int64(0)
+	for {
+		reqBody := hosts.NewQueryDevicesByFilterParamsWithContext(ctx)
+		reqBody.SetFilter(&fql)
+		reqBody.SetLimit(&limit)
+		reqBody.SetOffset(&offset)
+		resp, err := client.Hosts.QueryDevicesByFilter(reqBody)
 		if err != nil {
 			return nil, []fdk.APIError{{
 				Code:    http.StatusInternalServerError,
@@ -585,21 +818,31 @@ func provisionWorkflowWithAct(ctx context.Context, req *models.Job, conf *models
 			}}
 		}
 		if len(resp.GetPayload().Errors) != 0 {
-			errs = convertMsaErrorsToAPIErrors(resp.GetPayload().Errors)
-			return nil, errs
+			return nil, convertMsaErrorsToAPIErrors(resp.GetPayload().Errors)
 		}
-		if len(resp.GetPayload().Resources) == 0 {
-			return nil, []fdk.APIError{
-				{
-					Code:    2001,
-					Message: fmt.Sprintf("resources from workflow is 0 response:%v", resp),
-				},
-			}
+
+		resources := resp.GetPayload().Resources
+		deviceIDs = append(deviceIDs, resources...)
+		offset += int64(len(resources))
+		if len(resources) == 0 || resp.GetPayload().Meta == nil || resp.GetPayload().Meta.Pagination == nil ||
+			resp.GetPayload().Meta.Pagination.Total == nil || offset >= *resp.GetPayload().Meta.Pagination.Total {
+			break
 		}
-		workflowIDs = append(workflowIDs, resp.GetPayload().Resources[0])
 	}
+	return deviceIDs, nil
+}
 
-	return workflowIDs, errs
+func dedupe(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	result := make([]string, 0, len(values))
+	for _, v := range values {
+		if v == "" || seen[v] {
+			continue
+		}
+		seen[v] = true
+		result = append(result, v)
+	}
+	return result
 }
 
 func getDeviceCountForHostGroup(ctx context.Context, hostgroups []string, client *client.CrowdStrikeAPISpecification) (int, []fdk.APIError) {
@@ -626,9 +869,54 @@ func getDeviceCountForHostGroup(ctx context.Context, hostgroups []string, client
 		return 0, errs
 	}
 
+	// the query returns a single page of hosts, the total is taken from the pagination when available
+	if meta := resp.GetPayload().Meta; meta != nil && meta.Pagination != nil && meta.Pagination.Total != nil {
+		return int(*meta.Pagination.Total), nil
+	}
 	return len(resp.GetPayload().Resources), nil
 }
 
+// activeJobCount returns the number of active jobs of a user, leaving out the job with the given id.
+func activeJobCount(ctx context.Context, userID, excludeID string, conf *models.Config, client *client.CrowdStrikeAPISpecification) (int, []fdk.APIError) {
+	fqlFilter, err := models.NewFQLQuery([]models.Filter{{Field: "user_id", Value: userID, Op: models.EQ}})
+	if err != nil {
+		return 0, []fdk.APIError{models.NewAPIError(http.StatusInternalServerError, fmt.Sprintf("error constructing FQL query: %v", err))}
+	}
+
+	now := time.Now()
+	count := 0
+	searchReq := models.SearchObjectsRequest{
+		Collection: conf.JobsCollection,
+		Filter:     fqlFilter,
+	}
+	for {
+		searchResponse, errs := search(ctx, searchReq, client)
+		if len(errs) != 0 {
+			return 0, errs
+		}
+		for _, id := range searchResponse.ObjectKeys {
+			if id == excludeID {
+				continue
+			}
+			j, errs := jobInfo(ctx, id, conf, client)
+			if len(errs) != 0 {
+				if errs[0].Code == http.StatusNotFound {
+					continue
+				}
+				return 0, errs
+			}
+			if j.Active(now) {
+				count++
+			}
+		}
+		// the offset is only returned while there are more results
+		if searchResponse.Offset == 0 || len(searchResponse.ObjectKeys) == 0 {
+			return count, nil
+		}
+		searchReq.Offset = searchResponse.Offset
+	}
+}
+
 func convertMsaErrorsToAPIErrors(msaAPIErrors []*model.MsaAPIError) []fdk.APIError {
 	var errs []fdk.APIError
 	for _, e := range msaAPIErrors {
@@ -649,38 +937,36 @@ func convertMsaErrorsToAPIErrors(msaAPIErrors []*model.MsaAPIError) []fdk.APIErr
 	return errs
 }
 
-func updateSchedule(req *models.Job) (*models.Schedule, *models.Schedule) {
-	var runNow, schedule *models.Schedule
+// delayedRunSchedule returns a timer firing exactly once the given number of minutes from now, in the timezone of
+// the schedule of the job.
+func delayedRunSchedule(req *models.Job, minutes int) *models.Schedule {
+	return models.OnceSchedule(time.Now().In(scheduleLocation(req)).Add(time.Duration(minutes) * time.Minute))
+}
+
+func scheduleLocation(req *models.Job) *time.Location {
 	loc, _ := time.LoadLocation("UTC")
 	if req.Schedule != nil && req.Schedule.Timezone != "" {
 		loc, _ = time.LoadLocation(req.Schedule.Timezone)
 	}
+	return loc
+}
 
-	if req.RunNow {
-		startTime := time.Now().In(loc)
-		currTime := startTime.Add(2 * time.Minute)
-		endTime := currTime.AddDate(0, 0, 1)
-
-		runNow = &models.Schedule{}
-		runNow.Start = fmt.Sprintf(models.DateFormat, startTime.Month(), startTime.Day(), startTime.Year())
-		runNow.End = fmt.Sprintf(models.DateFormat, endTime.Month(), endTime.Day(), endTime.Year())
-		runNow.Timezone = loc.String()
-		runNow.TimeCycle = fmt.Sprintf(models.RunNowTimeCyclesFormat, currTime.Minute(), currTime.Hour())
-		runNow.SkipConcurrent = false
-	}
+// updateSchedule returns the schedule of the job in workflow format, nil when the job is not scheduled.
+func updateSchedule(req *models.Job) *models.Schedule {
+	var schedule *models.Schedule
+	loc := scheduleLocation(req)
 
 	if req.Schedule == nil {
-		return runNow, schedule
+		return schedule
+	}
+	if req.Schedule.Once() {
+		// validated with the job
+		at, _ := req.Schedule.RunAtTime()
+		req.Schedule.Timezone = at.Location().String()
+		return models.OnceSchedule(at)
 	}
 
 	schedule = &models.Schedule{}
-	if req.Schedule.TimeCycle == "" {
-		startTime, _ := time.Parse(time.RFC3339, req.Schedule.Start)
-		if req.Schedule.End == "" {
-			req.Schedule.End = startTime.AddDate(0, 0, 1).Format(time.RFC3339)
-		}
-		req.Schedule.TimeCycle = fmt.Sprintf(models.RunNowTimeCyclesFormat, startTime.Minute(), startTime.Hour())
-	}
 	req.Schedule.Timezone = loc.String()
 
 	if len(req.Schedule.Start) > 0 {
@@ -697,7 +983,7 @@ func updateSchedule(req *models.Job) (*models.Schedule, *models.Schedule) {
 	schedule.Timezone = req.Schedule.Timezone
 	schedule.SkipConcurrent = false
 
-	return runNow, schedule
+	return schedule
 }
 
 func asString(s *string) string {
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+	"github.com/Crowdstrike/foundry-sample-scalable-rtr/functions/Func_Jobs/api/models"
+	"github.com/crowdstrike/gofalcon/falcon/client"
+	"github.com/crowdstrike/gofalcon/falcon/client/custom_storage"
+	"github.com/go-openapi/runtime"
+)
+
+// indexWorkflows maps the workflow definitions running a job to the job, so that job_history attributes their
+// executions to it. Definitions are indexed before they run.
+func indexWorkflows(ctx context.Context, jobID string, info *models.WorkflowsInfo, conf *models.Config, client *client.CrowdStrikeAPISpecification) []fdk.APIError {
+	for _, id := range info.Definitions() {
+		if errs := putWorkflowIndexEntry(ctx, models.WorkflowIndexEntry{DefinitionID: id, JobID: jobID}, conf, client); len(errs) != 0 {
+			return errs
+		}
+	}
+	return nil
+}
+
+// discardWorkflows deprovisions and unindexes the workflows provisioned for a version of a job which failed to be
+// saved. The workflows of the stored version are kept.
+func discardWorkflows(ctx context.Context, provisioned, stored *models.WorkflowsInfo, conf *models.Config, client *client.CrowdStrikeAPISpecification) []fdk.APIError {
+	discarded := staleWorkflows(provisioned, stored)
+	errs := deprovisionWorkflows(ctx, discarded, client)
+	return append(errs, unindexWorkflows(ctx, discarded, conf, client)...)
+}
+
+// unindexWorkflows removes the workflow definitions of a job from the index. Definitions missing from the index,
+// such as the ones provisioned before it existed, are ignored.
+func unindexWorkflows(ctx context.Context, info *models.WorkflowsInfo, conf *models.Config, client *client.CrowdStrikeAPISpecification) []fdk.APIError {
+	for _, id := range info.Definitions() {
+		req := custom_storage.NewDeleteObjectParamsWithContext(ctx)
+		req.SetObjectKey(id)
+		req.SetCollectionName(conf.WorkflowsCollection)
+
+		resp, err := client.CustomStorage.DeleteObject(req)
+		if err != nil {
+			var apiErr *runtime.APIError
+			if errors.As(err, &apiErr) && apiErr.IsCode(http.StatusNotFound) {
+				continue
+			}
+			return []fdk.APIError{models.NewAPIError(http.StatusInternalServerError, fmt.Sprintf("failed to remove workflow: %s from the index with err: %v", id, err))}
+		}
+		if len(resp.GetPayload().Errors) > 0 {
+			return convertMsaErrorsToAPIErrors(resp.GetPayload().Errors)
+		}
+	}
+	return nil
+}
+
+// indexedWorkflows pages through the workflow definitions indexed to a job, which include the workflows job_history
+// provisions to run the job downstream of other jobs.
+func indexedWorkflows(ctx context.Context, jobID string, conf *models.Config, client *client.CrowdStrikeAPISpecification) ([]string, []fdk.APIError) {
+	fqlFilter, err := models.NewFQLQuery([]models.Filter{{Field: "job_id", Value: jobID, Op: models.EQ}})
+	if err != nil {
+		return nil, []fdk.APIError{models.NewAPIError(http.StatusInternalServerError, fmt.Sprintf("error constructing FQL query: %v", err))}
+	}
+
+	var ids []string
+	searchReq := models.SearchObjectsRequest{
+		Collection: conf.WorkflowsCollection,
+		Filter:     fqlFilter,
+	}
+	for {
+		searchResponse, errs := search(ctx, searchReq, client)
+		if len(errs) != 0 {
+			return nil, errs
+		}
+		ids = append(ids, searchResponse.ObjectKeys...)
+		// the offset is only returned while there are more results
+		if searchResponse.Offset == 0 || len(searchResponse.ObjectKeys) == 0 {
+			return ids, nil
+		}
+		searchReq.Offset = searchResponse.Offset
+	}
+}
+
+// deprovisionChainedRuns deprovisions the workflows indexed to a job which are not part of its workflows, the runs
+// of the job downstream of other jobs which did not finish yet.
+func deprovisionChainedRuns(ctx context.Context, job *models.Job, conf *models.Config, client *client.CrowdStrikeAPISpecification) []fdk.APIError {
+	ids, errs := indexedWorkflows(ctx, job.ID, conf, client)
+	if len(errs) != 0 {
+		return errs
+	}
+	chained := staleWorkflows(&models.WorkflowsInfo{ScheduleWorkflow: ids}, job.Workflows)
+	if errs := deprovisionWorkflows(ctx, chained, client); len(errs) != 0 {
+		return errs
+	}
+	return unindexWorkflows(ctx, chained, conf, client)
+}
+
+func putWorkflowIndexEntry(ctx context.Context, entry models.WorkflowIndexEntry, conf *models.Config, client *client.CrowdStrikeAPISpecification) []fdk.APIError {
+	rawObject, err := json.Marshal(entry)
+	if err != nil {
+		return []fdk.APIError{models.NewAPIError(http.StatusInternalServerError, err.Error())}
+	}
+
+	req := custom_storage.NewPutObjectParamsWithContext(ctx)
+	req.SetObjectKey(entry.DefinitionID)
+	req.SetCollectionName(conf.WorkflowsCollection)
+	req.SetBody(io.NopCloser(bytes.NewReader(rawObject)))
+
+	resp, err := client.CustomStorage.PutObject(req)
+	if err != nil {
+		return []fdk.APIError{models.NewAPIError(http.StatusInternalServerError, fmt.Sprintf("failed to index workflow: %s with err: %v", entry.DefinitionID, err))}
+	}
+	if len(resp.GetPayload().Errors) > 0 {
+		return convertMsaErrorsToAPIErrors(resp.GetPayload().Errors)
+	}
+	return nil
+}
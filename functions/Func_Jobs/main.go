@@ -2,8 +2,11 @@ package main
 
 import (
 	"context"
+	_ "embed"
+	"errors"
 	"log/slog"
 	"os"
+	"path/filepath"
 
 	fdk "github.com/CrowdStrike/foundry-fn-go"
 	api2 "github.com/Crowdstrike/foundry-sample-scalable-rtr/functions/Func_Jobs/api"
@@ -17,11 +20,31 @@ const (
 	getJob          = "/job"
 	getListOfJob    = "/jobs"
 	getListOfAudits = "/audits"
+	exportJobs      = "/jobs/export"
+	importJobs      = "/jobs/import"
+	planJobs        = "/jobs/plan"
+	applyJobs       = "/jobs/apply"
+	approveJob      = "/jobs/approve"
+	rejectJob       = "/jobs/reject"
+	jobsCalendar    = "/jobs/calendar"
+	jobsLifecycle   = "/jobs/lifecycle"
 )
 
+// defaultTemplates are the workflow templates of the app, CS_TEMPLATES_CONFIG_PATH overrides them.
+//
+//go:embed templates.yml
+var defaultTemplates []byte
+
+// defaultPolicy is the job policy of the app, CS_POLICY_CONFIG_PATH overrides it.
+//
+//go:embed policy.yml
+var defaultPolicy []byte
+
 var (
 	logger      logrus.FieldLogger
 	falconCloud falcon.CloudType
+	templates   models.Templates
+	policy      models.Policy
 )
 
 func doInit(cloud string) {
@@ -32,35 +55,98 @@ func doInit(cloud string) {
 	falconCloud = falcon.Cloud(cloud)
 }
 
+// loadTemplates loads the workflow templates and verifies them against the workflow definitions of the app,
+// when they are available next to the function or in CS_WORKFLOWS_DIR.
+func loadTemplates() (models.Templates, error) {
+	b := defaultTemplates
+	if path := os.Getenv("CS_TEMPLATES_CONFIG_PATH"); path != "" {
+		var err error
+		if b, err = os.ReadFile(path); err != nil {
+			return models.Templates{}, err
+		}
+	}
+	t, err := models.ParseTemplates(b)
+	if err != nil {
+		return t, err
+	}
+
+	dirs := []string{"workflows", filepath.Join("..", "..", "workflows")}
+	if dir := os.Getenv("CS_WORKFLOWS_DIR"); dir != "" {
+		dirs = []string{dir}
+	}
+	for _, dir := range dirs {
+		if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		logger.WithField("workflows_dir", dir).Info("verifying workflow templates")
+		return t, t.Verify(dir)
+	}
+	logger.Info("workflow definitions not found, skipping workflow template verification")
+	return t, nil
+}
+
+// loadPolicy loads the job policy every job is evaluated against.
+func loadPolicy() (models.Policy, error) {
+	b := defaultPolicy
+	if path := os.Getenv("CS_POLICY_CONFIG_PATH"); path != "" {
+		var err error
+		if b, err = os.ReadFile(path); err != nil {
+			return models.Policy{}, err
+		}
+	}
+	return models.ParsePolicy(b)
+}
+
 func handler(context.Context, *slog.Logger, fdk.SkipCfg) fdk.Handler {
 
 	conf := models.Config{
-		Cloud:                                   falconCloud,
-		JobsCollection:                          "Jobs_Info_Scalable_RTR",
-		AuditLogsCollection:                     "Jobs_Audit_Logger_Scalable_RTR",
-		ExecutionNotifierWorkflow:               "Notify status",
-		BuildQFileExistTemplateName:             "Check if files or registry key exist",
-		BuildQRegistryKeyValueExistTemplateName: "Check_If_Registry_key_Value_Exist",
-		RegistryKeyValueConditionNodeID:         "platform_is_equal_to_windows_host_groups_includes_to_parameterized_hostname_includes_to_parameterize_02ba0c09",
-		FileExistConditionNodeID:                "platform_is_equal_to_windows_host_groups_includes_to_parameterized_hostname_includes_to_parameterize_02ba0c09",
+		Cloud:               falconCloud,
+		JobsCollection:      "Jobs_Info_Scalable_RTR",
+		AuditLogsCollection: "Jobs_Audit_Logger_Scalable_RTR",
+		WorkflowsCollection: "Job_Workflows_Scalable_RTR",
+		Templates:           templates,
+		Policy:              policy,
 	}
 
 	upsertJobHandler := api2.NewUpsertJobHandler(&conf)
 	jobHandler := api2.NewJobHandler(&conf)
 	jobsHandler := api2.NewJobsHandler(&conf)
 	auditsHandler := api2.NewAuditsHandler(&conf)
+	exportJobsHandler := api2.NewExportJobsHandler(&conf)
+	importJobsHandler := api2.NewImportJobsHandler(&conf)
+	planJobsHandler := api2.NewPlanJobsHandler(&conf)
+	applyJobsHandler := api2.NewApplyJobsHandler(&conf)
+	approveJobHandler := api2.NewApproveJobHandler(&conf)
+	rejectJobHandler := api2.NewRejectJobHandler(&conf)
+	calendarHandler := api2.NewCalendarHandler(&conf)
+	lifecycleHandler := api2.NewLifecycleHandler(&conf)
 
 	mux := fdk.NewMux()
 	mux.Get(getJob, jobHandler)
 	mux.Get(getListOfAudits, auditsHandler)
 	mux.Get(getListOfJob, jobsHandler)
 	mux.Put(upsertJob, upsertJobHandler)
+	mux.Get(exportJobs, exportJobsHandler)
+	mux.Post(importJobs, importJobsHandler)
+	mux.Post(planJobs, planJobsHandler)
+	mux.Post(applyJobs, applyJobsHandler)
+	mux.Post(approveJob, approveJobHandler)
+	mux.Post(rejectJob, rejectJobHandler)
+	mux.Get(jobsCalendar, calendarHandler)
+	mux.Post(jobsLifecycle, lifecycleHandler)
 	return mux
 }
 
 func main() {
 	cloud := os.Getenv("CS_CLOUD")
 	doInit(cloud)
+	var err error
+	if templates, err = loadTemplates(); err != nil {
+		logger.Fatalf("invalid workflow templates: %s", err)
+	}
+	if policy, err = loadPolicy(); err != nil {
+		logger.Fatalf("invalid job policy: %s", err)
+	}
 	logger.Print("running")
 	fdk.Run(context.Background(), handler)
 }
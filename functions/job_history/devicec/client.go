@@ -0,0 +1,80 @@
+package devicec
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/crowdstrike/gofalcon/falcon/client/hosts"
+	"github.com/crowdstrike/gofalcon/falcon/models"
+	"github.com/sirupsen/logrus"
+)
+
+// DeviceC represents a device client.
+type DeviceC interface {
+	// UpdateTags adds or removes grouping tags on devices. Devices which fail to update are reported in the
+	// response, an error is returned when a request fails altogether.
+	UpdateTags(ctx context.Context, req UpdateTagsRequest) (UpdateTagsResponse, error)
+}
+
+// Client is the client.
+type Client struct {
+	c      hosts.ClientService
+	logger logrus.FieldLogger
+}
+
+var _ DeviceC = (*Client)(nil)
+
+// NewClient returns a new device client.
+func NewClient(c hosts.ClientService, logger logrus.FieldLogger) *Client {
+	return &Client{
+		c:      c,
+		logger: logger,
+	}
+}
+
+func (c *Client) UpdateTags(ctx context.Context, req UpdateTagsRequest) (UpdateTagsResponse, error) {
+	resp := UpdateTagsResponse{Failed: make(map[string]string)}
+	for start := 0; start < len(req.DeviceIDs); start += MaxDevicesPerRequest {
+		end := min(start+MaxDevicesPerRequest, len(req.DeviceIDs))
+		action := req.Action
+		params := hosts.NewUpdateDeviceTagsParamsWithContext(ctx)
+		params.SetBody(&models.DeviceapiUpdateDeviceTagsRequestV1{
+			Action:    &action,
+			DeviceIds: req.DeviceIDs[start:end],
+			Tags:      req.Tags,
+		})
+		ok, accepted, err := c.c.UpdateDeviceTags(params)
+		if err != nil {
+			return resp, fmt.Errorf("failed to %s device tags: %w", req.Action, err)
+		}
+		var payload *models.DeviceapiUpdateDeviceTagsSwaggerV1
+		switch {
+		case ok != nil:
+			payload = ok.GetPayload()
+		case accepted != nil:
+			payload = accepted.GetPayload()
+		}
+		if payload == nil {
+			resp.Updated += end - start
+			continue
+		}
+		for _, r := range payload.Resources {
+			if r == nil || r.DeviceID == nil {
+				continue
+			}
+			if r.Updated != nil && *r.Updated {
+				resp.Updated++
+				continue
+			}
+			reason := r.Error
+			if reason == "" {
+				reason = fmt.Sprintf("not updated, code %d", r.Code)
+			}
+			resp.Failed[*r.DeviceID] = reason
+		}
+	}
+	c.logger.WithField("action", req.Action).
+		WithField("tags", req.Tags).
+		Infof("updated tags of %d devices, %d failed", resp.Updated, len(resp.Failed))
+	return resp, nil
+}
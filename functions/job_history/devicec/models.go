@@ -0,0 +1,29 @@
+package devicec
+
+const (
+	// ActionAdd adds the tags to the devices.
+	ActionAdd = "add"
+	// ActionRemove removes the tags from the devices.
+	ActionRemove = "remove"
+
+	// MaxDevicesPerRequest is the number of devices updated by a single request, larger updates are split.
+	MaxDevicesPerRequest = 500
+)
+
+// UpdateTagsRequest adds or removes Falcon grouping tags on devices.
+type UpdateTagsRequest struct {
+	// Action is ActionAdd or ActionRemove.
+	Action string
+	// DeviceIDs are the IDs of the devices to update.
+	DeviceIDs []string
+	// Tags are the grouping tags, including their FalconGroupingTags/ prefix.
+	Tags []string
+}
+
+// UpdateTagsResponse is the outcome of a tag update.
+type UpdateTagsResponse struct {
+	// Failed maps the IDs of the devices which were not updated to the reason.
+	Failed map[string]string
+	// Updated is the number of devices updated.
+	Updated int
+}
@@ -10,9 +10,12 @@ import (
 	"time"
 
 	fdk "github.com/CrowdStrike/foundry-fn-go"
+	"github.com/Crowdstrike/foundry-sample-scalable-rtr/functions/job_history/devicec"
 	"github.com/Crowdstrike/foundry-sample-scalable-rtr/functions/job_history/processor"
 	"github.com/Crowdstrike/foundry-sample-scalable-rtr/functions/job_history/searchc"
 	"github.com/Crowdstrike/foundry-sample-scalable-rtr/functions/job_history/storagec"
+	"github.com/Crowdstrike/foundry-sample-scalable-rtr/functions/job_history/webhookc"
+	"github.com/Crowdstrike/foundry-sample-scalable-rtr/functions/job_history/workflowc"
 	"github.com/crowdstrike/gofalcon/falcon"
 	"github.com/crowdstrike/gofalcon/falcon/client"
 	"github.com/sirupsen/logrus"
@@ -57,6 +60,7 @@ func handler(context.Context, *slog.Logger, fdk.SkipCfg) fdk.Handler {
 	mux := fdk.NewMux()
 	mux.Get("/run-history", fdk.HandlerFn(runHistoryHandler))
 	mux.Put("/upsert", fdk.HandlerFn(upsertHandler))
+	mux.Post("/missed-runs", fdk.HandlerFn(missedRunsHandler))
 	return mux
 }
 
@@ -121,6 +125,37 @@ func upsertHandler(ctx context.Context, req fdk.Request) (fResp fdk.Response) {
 	return
 }
 
+func missedRunsHandler(ctx context.Context, req fdk.Request) (fResp fdk.Response) {
+	defer func() {
+		if fr := ensurePanicLogged(); fr != nil {
+			fResp = *fr
+		}
+	}()
+
+	p, err := newMissedRunsProcessor(ctx, req.AccessToken)
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize missed runs processor: %s", err)
+		logger.Error(msg)
+		return fdk.Response{
+			Errors: []fdk.APIError{{Code: 500, Message: msg}},
+		}
+	}
+
+	resp := p.Process(ctx, req)
+	if len(resp.Errs) > 0 {
+		fResp = fdk.Response{
+			Code:   resp.Code,
+			Errors: resp.Errs,
+		}
+	} else {
+		fResp = fdk.Response{
+			Body: json.RawMessage(resp.Body),
+			Code: resp.Code,
+		}
+	}
+	return
+}
+
 func ensurePanicLogged() *fdk.Response {
 	p := recover()
 	if p == nil {
@@ -173,6 +208,19 @@ func newStorageClient(fc *client.CrowdStrikeAPISpecification, token string) stor
 	return storagec.NewClient(fc.CustomStorage, hc, token, falconCloud.Host(), logger)
 }
 
+func newWebhookClient() webhookc.WebhookC {
+	hc := &http.Client{Timeout: 10 * time.Second}
+	return webhookc.NewClient(hc, logger)
+}
+
+func newWorkflowClient(fc *client.CrowdStrikeAPISpecification) workflowc.WorkflowC {
+	return workflowc.NewClient(fc.Workflows, logger)
+}
+
+func newDeviceClient(fc *client.CrowdStrikeAPISpecification) devicec.DeviceC {
+	return devicec.NewClient(fc.Hosts, logger)
+}
+
 func newExecutionsProcessor(ctx context.Context, token string) (*processor.ExecutionsProcessor, error) {
 	fc, err := newFalconClient(ctx, token)
 	if err != nil {
@@ -189,5 +237,14 @@ func newUpsertProcessor(ctx context.Context, token string) (*processor.UpsertPro
 	}
 	srchc := newSearchClient(fc)
 	strgc := newStorageClient(fc, token)
-	return processor.NewUpsertProcessor(host, srchc, strgc, logger), nil
+	return processor.NewUpsertProcessor(host, srchc, strgc, newWebhookClient(), newWorkflowClient(fc), newDeviceClient(fc), logger), nil
+}
+
+func newMissedRunsProcessor(ctx context.Context, token string) (*processor.MissedRunsProcessor, error) {
+	fc, err := newFalconClient(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	strgc := newStorageClient(fc, token)
+	return processor.NewMissedRunsProcessor(strgc, newWebhookClient(), newWorkflowClient(fc), logger), nil
 }
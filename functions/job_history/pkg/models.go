@@ -16,18 +16,27 @@ const (
 	StatusFailed = "failed"
 )
 
+// PlatformWindows is the platform of jobs that do not specify any target platform.
+const PlatformWindows = "windows"
+
 // JobExecution represents a job execution history record.
 type JobExecution struct {
+	// ChainToken identifies the runs of downstream jobs started once the execution finished.
+	ChainToken string `json:"chain_token,omitempty"`
 	// CSVOutput contains a link to the logscale output in CSV format.
 	CSVOutput string `json:"output_1"`
 	// Duration is the number of hours, minutes, and seconds the job ran/has run in string format.
 	Duration string `json:"duration"`
+	// Downstream lists the runs of the downstream jobs of the job started once the execution finished.
+	Downstream []ChainedRun `json:"downstream,omitempty"`
 	// EndDate is the timestamp at which the job stopped executing.
 	EndDate string `json:"endDate"`
 	// ExecutionID is the workflow execution ID.
 	ExecutionID string `json:"execution_id"`
 	// Hosts is a list of hostnames on which the job ran.
 	Hosts []string `json:"hosts"`
+	// HostTagging is the outcome of tagging the hosts by their result, nil when the job does not tag hosts.
+	HostTagging *HostTaggingOutcome `json:"host_tagging,omitempty"`
 	// ID is the ID of record.
 	ID string `json:"id"`
 	// JobID is the ID of the RTR job.
@@ -36,24 +45,258 @@ type JobExecution struct {
 	JobName string `json:"name"`
 	// LogscaleOutput is a link to the Logscale output.
 	LogscaleOutput string `json:"output_2"`
+	// Platforms lists the platforms the execution ran against when a job targets more than windows.
+	Platforms []string `json:"platforms,omitempty"`
 	// NumHosts is the length of the Hosts slice.
 	NumHosts int `json:"numHosts"`
 	// ReceivedFiles is number of files received
 	ReceivedFiles int `json:"receivedFiles"`
 	// RunDate is the timestamp at which the job began running.
 	RunDate string `json:"run_date"`
+	// RunNow is set when the execution was started on demand by running the job now.
+	RunNow bool `json:"run_now,omitempty"`
 	// RunStatus is the status of the job.
 	RunStatus string `json:"status"`
 	// TargetedHosts is a breakdown of which hosts the job ran against and the status of their execution.
 	TargetedHosts []TargetedHost `json:"targeted_hosts"`
+	// TotalWaves is the number of workflows the execution is split into, one per wave and platform.
+	// Zero when the job neither uses batching nor targets several platforms.
+	TotalWaves int `json:"total_waves,omitempty"`
+	// TriggeredBy is the execution of the upstream job which started this execution, nil when it was not chained.
+	TriggeredBy *ChainOrigin `json:"triggered_by,omitempty"`
+	// Waves contains the workflow executions of each wave aggregated into this record.
+	Waves []WaveExecution `json:"waves,omitempty"`
+}
+
+// ChainDepth returns the number of upstream executions which led to the execution, zero when it was not chained.
+func (e JobExecution) ChainDepth() int {
+	if e.TriggeredBy == nil {
+		return 0
+	}
+	return e.TriggeredBy.Depth
+}
+
+// ChainedRun is the run of a downstream job started once an execution finished.
+type ChainedRun struct {
+	// DefinitionIDs are the workflow definitions provisioned for the run.
+	DefinitionIDs []string `json:"definition_ids,omitempty"`
+	// DeprovisionedAt is the time the workflows of the run were deprovisioned, once its execution finished.
+	DeprovisionedAt string `json:"deprovisioned_at,omitempty"`
+	// ExecutionID is the workflow execution ID of the run, set once the run started.
+	ExecutionID string `json:"execution_id,omitempty"`
+	// JobID is the ID of the downstream job.
+	JobID string `json:"job_id"`
+	// JobName is the name of the downstream job.
+	JobName string `json:"name,omitempty"`
+	// Message explains why the run was skipped or failed to start.
+	Message string `json:"message,omitempty"`
+	// NotifierID is the workflow definition recording the execution of the run.
+	NotifierID string `json:"notifier_id,omitempty"`
+	// NumHosts is the number of hosts the run targets.
+	NumHosts int `json:"numHosts"`
+	// Status is started, skipped or failed.
+	Status string `json:"status"`
+}
+
+// HostTaggingOutcome is the outcome of tagging the hosts of an execution with Falcon grouping tags.
+type HostTaggingOutcome struct {
+	// Errors lists the devices which could not be tagged and the failed requests.
+	Errors []string `json:"errors,omitempty"`
+	// SkippedHosts is the number of hosts left untouched, as their query failed or their device ID is unknown.
+	SkippedHosts int `json:"skipped_hosts"`
+	// Updates are the tag updates applied.
+	Updates []TagUpdate `json:"updates,omitempty"`
+}
+
+// TagUpdate is the addition or removal of grouping tags on the hosts of an execution.
+type TagUpdate struct {
+	// Action is add or remove.
+	Action string `json:"action"`
+	// Failed is the number of hosts which could not be updated.
+	Failed int `json:"failed"`
+	// Tags are the grouping tags.
+	Tags []string `json:"tags"`
+	// Updated is the number of hosts updated.
+	Updated int `json:"updated"`
+}
+
+// ChainOrigin is the execution of an upstream job which started a run of a downstream job.
+type ChainOrigin struct {
+	// Depth is the number of upstream executions which led to the run.
+	Depth int `json:"depth"`
+	// ExecutionID is the workflow execution ID of the upstream execution.
+	ExecutionID string `json:"execution_id"`
+	// JobID is the ID of the upstream job.
+	JobID string `json:"job_id"`
+	// JobName is the name of the upstream job.
+	JobName string `json:"name"`
+}
+
+// ExecutionSummary is posted to the webhooks of a job when one of its executions completes or fails.
+type ExecutionSummary struct {
+	// CSVOutput contains a link to the logscale output in CSV format.
+	CSVOutput string `json:"csv_output,omitempty"`
+	// Duration is the number of hours, minutes, and seconds the job ran in string format.
+	Duration string `json:"duration"`
+	// EndDate is the timestamp at which the job stopped executing.
+	EndDate string `json:"end_date"`
+	// Event is execution.completed or execution.failed.
+	Event string `json:"event"`
+	// ExecutionID is the ID of the execution record.
+	ExecutionID string `json:"execution_id"`
+	// HostStatuses is the number of targeted hosts by execution status.
+	HostStatuses map[string]int `json:"host_statuses"`
+	// JobID is the ID of the RTR job.
+	JobID string `json:"job_id"`
+	// JobName is the name of the RTR job.
+	JobName string `json:"job_name"`
+	// LogscaleOutput is a link to the Logscale output.
+	LogscaleOutput string `json:"logscale_output,omitempty"`
+	// NumHosts is the number of hosts the job ran against.
+	NumHosts int `json:"num_hosts"`
+	// RunDate is the timestamp at which the job began running.
+	RunDate string `json:"run_date"`
+	// RunStatus is the status of the execution.
+	RunStatus string `json:"status"`
+}
+
+// MissedRunsSummary is the payload posted to the webhooks of a job when scheduled runs of the job did not start.
+type MissedRunsSummary struct {
+	// CheckedThrough is the timestamp up to which the schedule of the job was checked.
+	CheckedThrough string `json:"checked_through"`
+	// Event is run.missed.
+	Event string `json:"event"`
+	// JobID is the ID of the RTR job.
+	JobID string `json:"job_id"`
+	// JobName is the name of the RTR job.
+	JobName string `json:"job_name"`
+	// MissedRuns are the timestamps of the scheduled runs which did not start.
+	MissedRuns []string `json:"missed_runs"`
+}
+
+// WaveExecution represents the workflow execution of a single wave of a batched job.
+type WaveExecution struct {
+	// CSVOutput contains a link to the logscale output of the wave in CSV format.
+	CSVOutput string `json:"output_1,omitempty"`
+	// EndDate is the timestamp at which the wave stopped executing.
+	EndDate string `json:"endDate,omitempty"`
+	// ExecutionID is the workflow execution ID of the wave.
+	ExecutionID string `json:"execution_id"`
+	// Platform is the platform the wave ran against.
+	Platform string `json:"platform,omitempty"`
+	// RunDate is the timestamp at which the wave began running.
+	RunDate string `json:"run_date"`
+	// RunStatus is the status of the wave.
+	RunStatus string `json:"status"`
+	// TargetedHosts is a breakdown of which hosts the wave ran against and the status of their execution.
+	TargetedHosts []TargetedHost `json:"targeted_hosts"`
+	// Wave is the 1-based index of the wave.
+	Wave int `json:"wave"`
+}
+
+// TargetPlatform returns the platform of the wave, waves recorded without a platform ran against windows.
+func (w WaveExecution) TargetPlatform() string {
+	if w.Platform == "" {
+		return PlatformWindows
+	}
+	return w.Platform
 }
 
 // TargetedHost contains information about a host against which an RTR workflow ran.
 type TargetedHost struct {
 	// DeviceID is the ID of the device.
 	DeviceID string `json:"device_id"`
+	// Files is the outcome of a file query for every queried path.
+	Files []FileResult `json:"files,omitempty"`
 	// HostName is the name of the device.
 	HostName string `json:"host_name"`
+	// Output is the output of the script run by a run script job, following the output schema of the script.
+	Output map[string]any `json:"output,omitempty"`
+	// Presence is the outcome of a process or service query for every searched pattern.
+	Presence []PresenceResult `json:"presence,omitempty"`
+	// Registry is the outcome of a registry query for every queried key.
+	Registry []RegistryResult `json:"registry,omitempty"`
 	// Status is the status of execution.
 	Status string `json:"status"`
+	// Steps is the outcome of every step of a multi-step job, in order.
+	Steps []StepResult `json:"steps,omitempty"`
+}
+
+// StepResult is the outcome of a single step of a multi-step job on a host.
+type StepResult struct {
+	// Error is the reason the step failed.
+	Error string `json:"error,omitempty"`
+	// Index is the 1-based position of the step.
+	Index int `json:"index"`
+	// Name describes the step.
+	Name string `json:"name"`
+	// Output is the output of the step, such as the hash of a file.
+	Output string `json:"output,omitempty"`
+	// Status is completed, failed or skipped when a previous step failed.
+	Status string `json:"status"`
+	// Target is the file, registry key or process the step ran against.
+	Target string `json:"target,omitempty"`
+	// Type is the type of the step.
+	Type string `json:"type"`
+}
+
+// Matched reports whether a query matched on the host: a file existed with the expected attributes, a registry
+// value matched or a process or service was found.
+func (h TargetedHost) Matched() bool {
+	for _, f := range h.Files {
+		if f.Exists && len(f.Mismatched) == 0 {
+			return true
+		}
+	}
+	for _, r := range h.Registry {
+		if r.Match {
+			return true
+		}
+	}
+	for _, p := range h.Presence {
+		if p.Found {
+			return true
+		}
+	}
+	return false
+}
+
+// FileResult is the outcome of a file query for a single path on a host.
+type FileResult struct {
+	// Exists indicates whether the path exists on the host.
+	Exists bool `json:"exists"`
+	// Matched lists the expected attributes the file matched, such as sha256, size and version.
+	Matched []string `json:"matched,omitempty"`
+	// Mismatched lists the expected attributes the file did not match.
+	Mismatched []string `json:"mismatched,omitempty"`
+	// Path is the queried path.
+	Path string `json:"path"`
+}
+
+// RegistryResult is the outcome of a registry query for a single key on a host.
+type RegistryResult struct {
+	// Actual is the data of the registry value found on the host.
+	Actual string `json:"actual,omitempty"`
+	// Exists indicates whether the registry value exists on the host, only set for value comparisons.
+	Exists *bool `json:"exists,omitempty"`
+	// Key is the queried registry key.
+	Key string `json:"key"`
+	// Match indicates whether the registry value matched the expected data.
+	Match bool `json:"match"`
+	// ValueName is the name of the compared registry value.
+	ValueName string `json:"value_name,omitempty"`
+}
+
+// PresenceResult is the outcome of a process or service search on a host.
+type PresenceResult struct {
+	// Found indicates whether a process or service matching the search was found in the expected state.
+	Found bool `json:"found"`
+	// Matches lists the names of the matching processes or services.
+	Matches []string `json:"matches,omitempty"`
+	// Name is the searched name pattern.
+	Name string `json:"name,omitempty"`
+	// Path is the searched path pattern.
+	Path string `json:"path,omitempty"`
+	// State is running, stopped or absent.
+	State string `json:"state"`
 }
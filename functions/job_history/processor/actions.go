@@ -0,0 +1,150 @@
+package processor
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/Crowdstrike/foundry-sample-scalable-rtr/functions/job_history/pkg"
+	"github.com/sirupsen/logrus"
+)
+
+// actionType extracts the per host outcome of one type of job action from the logscale events of its workflows.
+// Adding an action type means registering an implementation with registerActionType.
+type actionType interface {
+	// extract returns the outcome of a single event, false when the event holds no result of this action type.
+	extract(e map[string]any, j job, l logrus.FieldLogger) (logscaleRecord, bool)
+}
+
+// extractorFunc adapts a function to the actionType interface.
+type extractorFunc func(e map[string]any, j job, l logrus.FieldLogger) (logscaleRecord, bool)
+
+func (f extractorFunc) extract(e map[string]any, j job, l logrus.FieldLogger) (logscaleRecord, bool) {
+	return f(e, j, l)
+}
+
+var (
+	actionTypes = make(map[string]actionType)
+	// fallbackActionTypes are tried in order for jobs without a registered action type.
+	fallbackActionTypes []actionType
+)
+
+func init() {
+	registerFallbackActionType(extractorFunc(func(e map[string]any, _ job, _ logrus.FieldLogger) (logscaleRecord, bool) {
+		return extractLogscaleInstall(e)
+	}))
+	registerFallbackActionType(extractorFunc(func(e map[string]any, _ job, l logrus.FieldLogger) (logscaleRecord, bool) {
+		return extractLogscaleRemove(e, l)
+	}))
+	registerActionType(actionBuildQuery, extractorFunc(extractLogscaleBuildQuery))
+	registerActionType(actionRunScript, extractorFunc(func(e map[string]any, j job, _ logrus.FieldLogger) (logscaleRecord, bool) {
+		return extractLogscaleScriptOutput(e, j.scriptName())
+	}))
+	steps := extractorFunc(func(e map[string]any, _ job, l logrus.FieldLogger) (logscaleRecord, bool) {
+		return extractLogscaleSteps(e, l)
+	})
+	registerActionType(actionSteps, steps)
+	// the file actions run with the step runner script, their extraction is already a fallback
+	actionTypes[actionHashFile] = steps
+	actionTypes[actionRemoveFile] = steps
+}
+
+// registerActionType registers the result extraction of an action type, which is also used as a fallback.
+func registerActionType(name string, a actionType) {
+	actionTypes[name] = a
+	registerFallbackActionType(a)
+}
+
+// registerFallbackActionType registers a result extraction which is not bound to an action type.
+func registerFallbackActionType(a actionType) {
+	fallbackActionTypes = append(fallbackActionTypes, a)
+}
+
+// extractLogscaleOutcome extracts the outcome of a single event using the action type of the job.
+func extractLogscaleOutcome(e map[string]any, j job, l logrus.FieldLogger) (logscaleRecord, bool) {
+	if j.Action != nil {
+		if a, ok := actionTypes[j.Action.Type]; ok {
+			return a.extract(e, j, l)
+		}
+	}
+	for _, a := range fallbackActionTypes {
+		if lr, ok := a.extract(e, j, l); ok {
+			return lr, true
+		}
+	}
+	return logscaleRecord{}, false
+}
+
+// extractLogscaleBuildQuery extracts the outcome of a file, registry, process or service query.
+func extractLogscaleBuildQuery(e map[string]any, _ job, l logrus.FieldLogger) (logscaleRecord, bool) {
+	if lr, ok := extractLogscaleFileQuery(e, l); ok {
+		return lr, true
+	}
+	if lr, ok := extractLogscaleRegistryQuery(e, l); ok {
+		return lr, true
+	}
+	return extractLogscalePresenceQuery(e, l)
+}
+
+// stepResult is a single entry of the output of the step runner script.
+type stepResult struct {
+	Error  string `json:"Error"`
+	Index  int    `json:"Index"`
+	Name   string `json:"Name"`
+	Output string `json:"Output"`
+	Status string `json:"Status"`
+	Target string `json:"Target"`
+	Type   string `json:"Type"`
+}
+
+// extractLogscaleSteps extracts the per step outcome of a multi-step job from the output of the step runner script.
+// The host fails when a step failed without continuing on failure.
+func extractLogscaleSteps(e map[string]any, l logrus.FieldLogger) (logscaleRecord, bool) {
+	hostName := ""
+	stdout := ""
+
+	for k, v := range e {
+		lk := strings.ToLower(k)
+		switch {
+		case strings.HasSuffix(lk, "device.getdetails.hostname"):
+			if s, ok := v.(string); ok && strings.TrimSpace(s) != "" {
+				hostName = strings.TrimSpace(s)
+			}
+		case strings.HasSuffix(lk, "rtr.app_run_job_steps.stdout"):
+			if s, ok := v.(string); ok && strings.TrimSpace(s) != "" {
+				stdout = strings.TrimSpace(s)
+			}
+		}
+	}
+
+	if hostName == "" || stdout == "" {
+		return logscaleRecord{}, false
+	}
+
+	var entries []stepResult
+	if err := decodeScriptResult(stdout, &entries); err != nil {
+		l.WithField("host_name", hostName).Errorf("failed to decode job steps output: %s", err)
+		return logscaleRecord{HostName: hostName, Success: "false"}, true
+	}
+	var out struct {
+		Aborted bool `json:"aborted"`
+	}
+	_ = json.Unmarshal([]byte(stdout), &out)
+
+	steps := make([]pkg.StepResult, 0, len(entries))
+	for _, r := range entries {
+		steps = append(steps, pkg.StepResult{
+			Error:  r.Error,
+			Index:  r.Index,
+			Name:   r.Name,
+			Output: r.Output,
+			Status: r.Status,
+			Target: r.Target,
+			Type:   r.Type,
+		})
+	}
+	success := "true"
+	if out.Aborted {
+		success = "false"
+	}
+	return logscaleRecord{HostName: hostName, Steps: steps, Success: success}, true
+}
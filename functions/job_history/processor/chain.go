@@ -0,0 +1,316 @@
+package processor
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Crowdstrike/foundry-sample-scalable-rtr/functions/job_history/pkg"
+	"github.com/Crowdstrike/foundry-sample-scalable-rtr/functions/job_history/storagec"
+	"github.com/Crowdstrike/foundry-sample-scalable-rtr/functions/job_history/workflowc"
+)
+
+// maxChainDepth is the maximum number of jobs a chain of downstream jobs runs one after another. Func_Jobs rejects
+// cycles, the limit guards against cycles introduced by jobs saved before it did.
+const maxChainDepth = 4
+
+// chainRunDelay leaves time for the provisioned workflows of a run of a downstream job to be ready.
+const chainRunDelay = 2 * time.Minute
+
+const (
+	chainRunStarted = "started"
+	chainRunSkipped = "skipped"
+	chainRunFailed  = "failed"
+)
+
+// deviceIDKeySuffix is the suffix of the logscale field carrying the ID of the device a workflow loop ran against.
+const deviceIDKeySuffix = "device.query.devices.#"
+
+// triggerDownstream starts the downstream jobs of a job on the hosts of an execution which just finished, recording
+// the runs on the execution. Failures to start a run are recorded on the run, they do not fail the upsert.
+func (p *UpsertProcessor) triggerDownstream(ctx context.Context, j job, execRecord pkg.JobExecution) pkg.JobExecution {
+	if len(j.Downstream) == 0 || p.wfc == nil {
+		return execRecord
+	}
+
+	if execRecord.ChainToken == "" {
+		token, err := newChainToken()
+		if err != nil {
+			p.logger.WithField("job_id", execRecord.JobID).Errorf("failed to generate chain token: %s", err)
+			return execRecord
+		}
+		execRecord.ChainToken = token
+	}
+
+	runs := make([]pkg.ChainedRun, 0, len(j.Downstream))
+	for _, d := range j.Downstream {
+		run := pkg.ChainedRun{JobID: d.JobID}
+		if execRecord.ChainDepth()+1 >= maxChainDepth {
+			run.Status = chainRunSkipped
+			run.Message = fmt.Sprintf("chain reached %d jobs", maxChainDepth)
+		} else {
+			run = p.startDownstream(ctx, d, execRecord)
+		}
+		if run.Status == chainRunFailed {
+			p.logger.WithField("job_id", execRecord.JobID).
+				WithField("downstream_job_id", d.JobID).
+				Errorf("failed to start downstream job: %s", run.Message)
+		}
+		runs = append(runs, run)
+	}
+	execRecord.Downstream = runs
+	return execRecord
+}
+
+// startDownstream provisions a single run of a downstream job, along with the notifier recording its execution. The
+// workflows are indexed to the downstream job, so that Func_Jobs deprovisions them along with the job, and are
+// deprovisioned when the run fails to start.
+func (p *UpsertProcessor) startDownstream(ctx context.Context, d downstreamJob, execRecord pkg.JobExecution) pkg.ChainedRun {
+	run := pkg.ChainedRun{JobID: d.JobID}
+	if d.OnlyOnCompleted && execRecord.RunStatus != pkg.StatusCompleted {
+		run.Status = chainRunSkipped
+		run.Message = fmt.Sprintf("execution %s", execRecord.RunStatus)
+		return run
+	}
+	deviceIDs := chainTargets(execRecord.TargetedHosts, d.OnlyMatchedHosts)
+	run.NumHosts = len(deviceIDs)
+	if len(deviceIDs) == 0 {
+		run.Status = chainRunSkipped
+		run.Message = "no hosts to target"
+		return run
+	}
+
+	failed := func(msg string, args ...any) pkg.ChainedRun {
+		run.Status = chainRunFailed
+		run.Message = fmt.Sprintf(msg, args...)
+		if len(run.DefinitionIDs) != 0 || run.NotifierID != "" {
+			if err := p.releaseWorkflows(ctx, &run); err != nil {
+				run.Message += fmt.Sprintf(", %s", err)
+			}
+		}
+		return run
+	}
+	jobMap, err := p.fetchObject(ctx, jobCollection, d.JobID)
+	if err != nil {
+		if errors.Is(err, storagec.NotFound) {
+			return failed("downstream job no longer exists")
+		}
+		return failed("failed to fetch downstream job: %s", err)
+	}
+	downstream, err := distillJob(jobMap)
+	if err != nil {
+		return failed("failed to distill downstream job: %s", err)
+	}
+	run.JobName = downstream.Name
+	switch {
+	case downstream.DeletedAt != nil:
+		return failed("downstream job was deleted")
+	case downstream.ArchivedAt != nil || downstream.Lifecycle == lifecycleArchived:
+		return failed("downstream job is archived")
+	case downstream.awaitingApproval():
+		return failed("downstream job is awaiting approval")
+	}
+	launch := downstream.Launch
+	if launch == nil || len(launch.Workflows) == 0 {
+		return failed("downstream job is not provisioned")
+	}
+
+	runAt := p.nowProvider().Add(chainRunDelay)
+	for _, w := range launch.Workflows {
+		id, err := p.wfc.Provision(ctx, workflowc.ProvisionRequest{
+			Activities: map[string]any{w.ActivityNodeID: w.Properties},
+			Conditions: map[string][]workflowc.ConditionField{
+				w.ConditionNodeID: {
+					{Name: launch.HostGroupsField, Operator: workflowc.OperatorNotIn, Values: []string{workflowc.UndefinedValue}},
+					{Name: launch.HostsField, Operator: workflowc.OperatorIn, Values: deviceIDs},
+				},
+			},
+			Name:         fmt.Sprintf("%s Chain %s%s", downstream.Name, execRecord.ChainToken, w.NameSuffix),
+			RunAt:        runAt,
+			TemplateName: w.TemplateName,
+		})
+		if err != nil {
+			return failed("%s", err)
+		}
+		run.DefinitionIDs = append(run.DefinitionIDs, id)
+		if err := p.indexWorkflow(ctx, id, d.JobID); err != nil {
+			return failed("failed to index workflow: %s", err)
+		}
+	}
+
+	n := launch.Notifier
+	notifierID, err := p.wfc.Provision(ctx, workflowc.ProvisionRequest{
+		Activities: map[string]any{n.EmailNodeID: map[string]any{"to": n.Recipients}},
+		Conditions: map[string][]workflowc.ConditionField{
+			n.ConditionNodeID: {{Name: n.DefinitionIDField, Operator: workflowc.OperatorIn, Values: run.DefinitionIDs}},
+		},
+		Name:         downstream.Name,
+		TemplateName: n.TemplateName,
+	})
+	if err != nil {
+		return failed("%s", err)
+	}
+	run.NotifierID = notifierID
+	if err := p.indexWorkflow(ctx, notifierID, d.JobID); err != nil {
+		return failed("failed to index workflow: %s", err)
+	}
+	run.Status = chainRunStarted
+	return run
+}
+
+// releaseWorkflows deprovisions and unindexes the workflows of a run of a downstream job, the notifier first so that
+// it does not report on a partially deprovisioned run. Every workflow is attempted, the failures are joined.
+func (p *UpsertProcessor) releaseWorkflows(ctx context.Context, run *pkg.ChainedRun) error {
+	var errs []error
+	for _, id := range append([]string{run.NotifierID}, run.DefinitionIDs...) {
+		if id == "" {
+			continue
+		}
+		if err := p.wfc.Deprovision(ctx, id); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		err := p.strgc.DeleteObject(ctx, storagec.DeleteObjectRequest{Collection: workflowIndexCollection, ObjectKey: id})
+		if err != nil && !errors.Is(err, storagec.NotFound) {
+			errs = append(errs, fmt.Errorf("failed to unindex workflow %s: %w", id, err))
+		}
+	}
+	if len(errs) != 0 {
+		return errors.Join(errs...)
+	}
+	run.DeprovisionedAt = p.now()
+	return nil
+}
+
+// releaseChainedRun deprovisions the workflows of the run of a downstream job once its execution finished, and
+// records it on the upstream execution. Failures are logged, they do not fail the upsert.
+func (p *UpsertProcessor) releaseChainedRun(ctx context.Context, token, jobID, execID string) {
+	if p.wfc == nil {
+		return
+	}
+	l := p.logger.WithField("chain_token", token).WithField("job_id", jobID)
+	key, upstream, err := p.upstreamExecution(ctx, token)
+	if err != nil {
+		l.Errorf("failed to fetch the upstream execution: %s", err)
+		return
+	}
+	if key == "" {
+		return
+	}
+	for i, r := range upstream.Downstream {
+		if r.JobID != jobID || r.ExecutionID != execID || r.DeprovisionedAt != "" {
+			continue
+		}
+		if err := p.releaseWorkflows(ctx, &upstream.Downstream[i]); err != nil {
+			l.Errorf("failed to deprovision the workflows of the chained run: %s", err)
+			return
+		}
+		if err := p.putExecutionRecordObject(ctx, jobExecutionCollection, key, upstream); err != nil {
+			l.Errorf("failed to save the upstream execution: %s", err)
+		}
+		return
+	}
+}
+
+// upstreamExecution returns the execution which started the runs of downstream jobs with the given token, along with
+// its key, empty when the execution is gone.
+func (p *UpsertProcessor) upstreamExecution(ctx context.Context, token string) (string, pkg.JobExecution, error) {
+	sr, err := p.strgc.SearchAndFetch(ctx, storagec.SearchObjectsRequest{
+		Collection: jobExecutionCollection,
+		Filter:     fmt.Sprintf("chain_token:'%s'", token),
+		Limit:      1,
+	})
+	if err != nil {
+		return "", pkg.JobExecution{}, err
+	}
+	if len(sr.Objects) == 0 {
+		return "", pkg.JobExecution{}, nil
+	}
+	upstream, err := pkg.DecodeJobExecution(sr.Objects[0].Data)
+	if err != nil {
+		return "", pkg.JobExecution{}, err
+	}
+	return sr.Objects[0].Key, upstream, nil
+}
+
+// indexWorkflow maps a workflow definition provisioned for a job to the job, so that its executions are attributed
+// to the job.
+func (p *UpsertProcessor) indexWorkflow(ctx context.Context, definitionID, jobID string) error {
+	b, err := json.Marshal(map[string]string{"definition_id": definitionID, "job_id": jobID})
+	if err != nil {
+		return err
+	}
+	return p.putObject(ctx, workflowIndexCollection, definitionID, b)
+}
+
+// linkChainedRun returns the upstream execution which started a run of a downstream job, and records the execution
+// of the run on the upstream execution. The run is recorded without its origin when the upstream execution is gone.
+func (p *UpsertProcessor) linkChainedRun(ctx context.Context, token, jobID, execID string) *pkg.ChainOrigin {
+	l := p.logger.WithField("chain_token", token).WithField("job_id", jobID)
+	key, upstream, err := p.upstreamExecution(ctx, token)
+	if err != nil {
+		l.Errorf("failed to fetch the upstream execution: %s", err)
+		return nil
+	}
+	if key == "" {
+		l.Warn("upstream execution not found")
+		return nil
+	}
+
+	for i, r := range upstream.Downstream {
+		if r.JobID == jobID && r.ExecutionID == "" {
+			upstream.Downstream[i].ExecutionID = execID
+			if err := p.putExecutionRecordObject(ctx, jobExecutionCollection, key, upstream); err != nil {
+				l.Errorf("failed to link the upstream execution: %s", err)
+			}
+			break
+		}
+	}
+	return &pkg.ChainOrigin{
+		Depth:       upstream.ChainDepth() + 1,
+		ExecutionID: upstream.ExecutionID,
+		JobID:       upstream.JobID,
+		JobName:     upstream.JobName,
+	}
+}
+
+// chainTargets returns the IDs of the devices a downstream job runs against. Hosts recorded without their device ID
+// cannot be targeted.
+func chainTargets(hosts []pkg.TargetedHost, onlyMatched bool) []string {
+	seen := make(map[string]bool)
+	var deviceIDs []string
+	for _, h := range hosts {
+		if h.DeviceID == "" || seen[h.DeviceID] || (onlyMatched && !h.Matched()) {
+			continue
+		}
+		seen[h.DeviceID] = true
+		deviceIDs = append(deviceIDs, h.DeviceID)
+	}
+	return deviceIDs
+}
+
+// extractDeviceID returns the ID of the device a logscale event was written for.
+func extractDeviceID(e map[string]any) string {
+	for k, v := range e {
+		if !strings.HasSuffix(strings.ToLower(k), deviceIDKeySuffix) {
+			continue
+		}
+		if s, ok := v.(string); ok {
+			return strings.TrimSpace(s)
+		}
+	}
+	return ""
+}
+
+func newChainToken() (string, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -2,6 +2,8 @@ package processor
 
 import (
 	"errors"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -13,6 +15,16 @@ const (
 	csvCollection          = "Job_Executions_CSV_Scalable_RTR"
 	jobCollection          = "Jobs_Info_Scalable_RTR"
 	jobExecutionCollection = "Job_Executions_Scalable_RTR"
+	// workflowIndexCollection maps the workflow definitions provisioned for jobs to their job.
+	workflowIndexCollection = "Job_Workflows_Scalable_RTR"
+)
+
+const (
+	actionBuildQuery = "buildQuery"
+	actionRunScript  = "runScript"
+	actionSteps      = "steps"
+	actionHashFile   = "hashFile"
+	actionRemoveFile = "removeFile"
 )
 
 const (
@@ -20,6 +32,12 @@ const (
 	prevPage = -1
 )
 
+// partitionSuffixRE matches the wave and platform suffixes appended to the RunNow/Schedule/Chain suffix of a workflow.
+var partitionSuffixRE = regexp.MustCompile(`( RunNow| Schedule| Chain [0-9a-f]{8})(?: Wave (\d+))?(?: (Linux|Mac))?$`)
+
+// chainSuffixRE matches the suffix of the workflows of a run of a downstream job, carrying the chain token.
+var chainSuffixRE = regexp.MustCompile(` Chain ([0-9a-f]{8})$`)
+
 // Response is the response from the call.
 type Response struct {
 	// Body is the payload of the response.
@@ -38,6 +56,15 @@ type paging struct {
 	Total int    `json:"total"`
 }
 
+// upsertResponse is the response of an upsert, Notify tells the notifier workflow whether to send its email.
+type upsertResponse struct {
+	jobExecutionResponse
+	JobName       string   `json:"job_name,omitempty"`
+	Notify        bool     `json:"notify"`
+	NotifyReasons []string `json:"notify_reasons,omitempty"`
+	Recipients    []string `json:"recipients,omitempty"`
+}
+
 type jobExecutionResponse struct {
 	Errs      []fdk.APIError     `json:"errors,omitempty"`
 	Meta      paging             `json:"meta"`
@@ -63,6 +90,12 @@ type filterJobExecsRequest struct {
 }
 
 type logscaleRecord struct {
+	DeviceID string
+	Files    []pkg.FileResult
+	Output   map[string]any
+	Presence []pkg.PresenceResult
+	Registry []pkg.RegistryResult
+	Steps    []pkg.StepResult
 	Success  string
 	HostName string
 }
@@ -73,11 +106,18 @@ type offsetMeta struct {
 	Page      int
 }
 
+// workflowMeta describes the workflow execution reported to the job history. The on demand workflows started by
+// run now jobs are shared by every job, they report the job, wave and platform they were started for.
 type workflowMeta struct {
+	DefinitionID       string `json:"definition_id,omitempty"`
 	ExecutionID        string `json:"execution_id,omitempty"`
 	ExecutionTimestamp string `json:"execution_timestamp,omitempty"`
 	DefinitionName     string `json:"definition_name,omitempty"`
+	JobID              string `json:"job_id,omitempty"`
+	Platform           string `json:"platform,omitempty"`
+	RunNow             bool   `json:"run_now,omitempty"`
 	Status             string `json:"status,omitempty"`
+	Wave               int    `json:"wave,omitempty"`
 }
 
 func (w workflowMeta) jobName() (string, error) {
@@ -89,6 +129,7 @@ func (w workflowMeta) jobName() (string, error) {
 	}
 	// +2 advances index to first character following "- "
 	dn = dn[idx+2:]
+	dn = partitionSuffixRE.ReplaceAllString(dn, "$1")
 
 	suffix := ""
 	switch {
@@ -96,6 +137,8 @@ func (w workflowMeta) jobName() (string, error) {
 		suffix = " RunNow"
 	case strings.HasSuffix(dn, " Schedule"):
 		suffix = " Schedule"
+	case chainSuffixRE.MatchString(dn):
+		suffix = chainSuffixRE.FindString(dn)
 	}
 	if suffix == "" {
 		return dn, nil
@@ -109,18 +152,258 @@ func (w workflowMeta) jobName() (string, error) {
 	return dn, nil
 }
 
+// wave returns the 1-based wave of a batched job the workflow belongs to.
+func (w workflowMeta) wave() int {
+	if w.Wave > 0 {
+		return w.Wave
+	}
+	m := partitionSuffixRE.FindStringSubmatch(w.DefinitionName)
+	if m == nil || m[2] == "" {
+		return 1
+	}
+	wave, err := strconv.Atoi(m[2])
+	if err != nil || wave < 1 {
+		return 1
+	}
+	return wave
+}
+
+// chainToken returns the token of the upstream execution which started the workflow, empty when it was not chained.
+func (w workflowMeta) chainToken() string {
+	m := partitionSuffixRE.FindStringSubmatch(w.DefinitionName)
+	if m == nil {
+		return ""
+	}
+	if cm := chainSuffixRE.FindStringSubmatch(m[1]); cm != nil {
+		return cm[1]
+	}
+	return ""
+}
+
+// platform returns the platform targeted by the workflow, windows workflows carry no platform suffix.
+func (w workflowMeta) platform() string {
+	if w.Platform != "" {
+		return strings.ToLower(w.Platform)
+	}
+	m := partitionSuffixRE.FindStringSubmatch(w.DefinitionName)
+	if m == nil || m[3] == "" {
+		return pkg.PlatformWindows
+	}
+	return strings.ToLower(m[3])
+}
+
 type job struct {
-	LastRun          time.Time    `json:"last_run"`
-	NextRun          time.Time    `json:"next_run"`
-	OutputFormats    []string     `json:"output_format,omitempty"`
-	RunCount         uint64       `json:"run_count"`
-	RunNow           bool         `json:"run_now"`
-	Schedule         *jobSchedule `json:"schedule,omitempty"`
-	TotalRecurrences uint64       `json:"total_recurrences"`
+	Action              *jobAction           `json:"action,omitempty"`
+	Approval            *jobApproval         `json:"approval,omitempty"`
+	ArchivedAt          *time.Time           `json:"archived_at,omitempty"`
+	CreatedAt           *time.Time           `json:"created_at,omitempty"`
+	DeletedAt           *time.Time           `json:"deleted_at,omitempty"`
+	Downstream          []downstreamJob      `json:"downstream_jobs,omitempty"`
+	Draft               bool                 `json:"draft"`
+	HostTagging         *hostTagging         `json:"host_tagging,omitempty"`
+	ID                  string               `json:"id,omitempty"`
+	LastRun             time.Time            `json:"last_run"`
+	Launch              *jobLaunch           `json:"launch,omitempty"`
+	Lifecycle           string               `json:"lifecycle,omitempty"`
+	MissedRuns          *missedRuns          `json:"missed_runs,omitempty"`
+	Name                string               `json:"name"`
+	ProvisionedAt       *time.Time           `json:"provisioned_at,omitempty"`
+	NextRun             time.Time            `json:"next_run"`
+	NotificationRules   []notificationRule   `json:"notification_rules,omitempty"`
+	NotificationTargets []notificationTarget `json:"notification_targets,omitempty"`
+	Notifications       []string             `json:"notifications,omitempty"`
+	OutputFormats       []string             `json:"output_format,omitempty"`
+	RunCount            uint64               `json:"run_count"`
+	RunNow              bool                 `json:"run_now"`
+	RunNowExecutionIDs  []string             `json:"run_now_execution_ids,omitempty"`
+	Schedule            *jobSchedule         `json:"schedule,omitempty"`
+	Target              *jobTarget           `json:"target,omitempty"`
+	TotalRecurrences    uint64               `json:"total_recurrences"`
+	Waves               int                  `json:"waves,omitempty"`
+	Workflows           *jobWorkflows        `json:"workflows,omitempty"`
+}
+
+const notificationEmail = "email"
+
+const notificationWebhook = "webhook"
+
+const (
+	ruleOnFailure        = "on_failure"
+	ruleAnyHostMatched   = "any_host_matched"
+	ruleFailedPercentage = "failed_percentage_above"
+	ruleResultChanged    = "result_changed"
+)
+
+type notificationRule struct {
+	Threshold *float64 `json:"threshold,omitempty"`
+	Type      string   `json:"type"`
+}
+
+type notificationTarget struct {
+	Email  string `json:"email,omitempty"`
+	Secret string `json:"secret,omitempty"`
+	Type   string `json:"type"`
+	URL    string `json:"url,omitempty"`
+}
+
+// webhooks returns the webhook notification targets of the job.
+func (j job) webhooks() []notificationTarget {
+	var webhooks []notificationTarget
+	for _, t := range j.NotificationTargets {
+		if t.Type == notificationWebhook && t.URL != "" {
+			webhooks = append(webhooks, t)
+		}
+	}
+	return webhooks
+}
+
+// emailRecipients returns the email addresses of the notifications and of the email targets of the job.
+func (j job) emailRecipients() []string {
+	seen := make(map[string]bool)
+	var recipients []string
+	add := func(email string) {
+		if email != "" && !seen[email] {
+			seen[email] = true
+			recipients = append(recipients, email)
+		}
+	}
+	for _, email := range j.Notifications {
+		add(email)
+	}
+	for _, t := range j.NotificationTargets {
+		if t.Type == notificationEmail {
+			add(t.Email)
+		}
+	}
+	return recipients
+}
+
+const (
+	approvalPending  = "pending"
+	approvalApproved = "approved"
+)
+
+// awaitingApproval reports whether the job is waiting to be approved or was rejected, it is not provisioned.
+func (j job) awaitingApproval() bool {
+	return j.Approval != nil && j.Approval.Status != approvalApproved
+}
+
+const (
+	lifecycleCompleted = "completed"
+	lifecycleArchived  = "archived"
+)
+
+// completed returns whether the job ran all of its runs. Archived jobs stay archived.
+func (j job) completed() bool {
+	return j.Lifecycle != lifecycleArchived && j.TotalRecurrences > 0 && j.RunCount >= j.TotalRecurrences
+}
+
+type jobApproval struct {
+	Status string `json:"status"`
+}
+
+type jobWorkflows struct {
+	ScheduleWorkflow []string `json:"scheduled_workflow"`
+}
+
+// missedRuns flags the scheduled runs of a job which did not start, it is saved with the job by the missed run check.
+type missedRuns struct {
+	CheckedThrough time.Time   `json:"checked_through"`
+	Count          int         `json:"count"`
+	LastMissed     *time.Time  `json:"last_missed,omitempty"`
+	Recent         []time.Time `json:"recent,omitempty"`
+}
+
+type hostTagging struct {
+	MatchTags   []string `json:"match_tags,omitempty"`
+	NoMatchTags []string `json:"no_match_tags,omitempty"`
+	RemoveStale bool     `json:"remove_stale,omitempty"`
+}
+
+type downstreamJob struct {
+	JobID            string `json:"job_id"`
+	OnlyMatchedHosts bool   `json:"only_matched_hosts,omitempty"`
+	OnlyOnCompleted  bool   `json:"only_on_completed,omitempty"`
+}
+
+// jobLaunch describes how to provision a run of a job on any list of hosts, it is saved by Func_Jobs with every
+// provisioned job.
+type jobLaunch struct {
+	HostGroupsField string           `json:"host_groups_field"`
+	HostsField      string           `json:"hosts_field"`
+	Notifier        launchNotifier   `json:"notifier"`
+	Workflows       []launchWorkflow `json:"workflows"`
+}
+
+type launchWorkflow struct {
+	ActivityNodeID  string `json:"activity_node_id"`
+	ConditionNodeID string `json:"condition_node_id"`
+	NameSuffix      string `json:"name_suffix,omitempty"`
+	Properties      any    `json:"properties"`
+	TemplateName    string `json:"template_name"`
+}
+
+type launchNotifier struct {
+	ConditionNodeID   string   `json:"condition_node_id"`
+	DefinitionIDField string   `json:"definition_id_field"`
+	EmailNodeID       string   `json:"email_node_id"`
+	Recipients        []string `json:"recipients"`
+	TemplateName      string   `json:"template_name"`
+}
+
+type jobAction struct {
+	ScriptName string `json:"script_name,omitempty"`
+	Type       string `json:"type"`
+}
+
+// scriptName returns the RTR script run by a run script job, empty for other action types.
+func (j job) scriptName() string {
+	if j.Action == nil || j.Action.Type != actionRunScript {
+		return ""
+	}
+	return j.Action.ScriptName
+}
+
+type jobTarget struct {
+	Platforms []string `json:"platforms,omitempty"`
+}
+
+// platforms returns the platforms targeted by the job, jobs saved before platforms were introduced target windows.
+func (j job) platforms() []string {
+	if j.Target == nil || len(j.Target.Platforms) == 0 {
+		return []string{pkg.PlatformWindows}
+	}
+	return j.Target.Platforms
+}
+
+// ranNow reports whether the workflow execution was started on demand when the job was last run now. Executions
+// reporting themselves as run now are matched before the job is saved with their IDs.
+func (j job) ranNow(wfMeta workflowMeta) bool {
+	if wfMeta.RunNow {
+		return true
+	}
+	executionID := wfMeta.ExecutionID
+	for _, id := range j.RunNowExecutionIDs {
+		if id == executionID {
+			return true
+		}
+	}
+	return false
+}
+
+// partitions returns the number of workflows provisioned for a single run of the job, one per wave and platform.
+func (j job) partitions() int {
+	waves := j.Waves
+	if waves < 1 {
+		waves = 1
+	}
+	return waves * len(j.platforms())
 }
 
 type jobSchedule struct {
 	End            string `json:"end_date,omitempty"`
+	RunAt          string `json:"run_at,omitempty"`
+	RunAtTimezone  string `json:"run_at_timezone,omitempty"`
 	SkipConcurrent bool   `json:"skip_concurrent,omitempty"`
 	Start          string `json:"start_date,omitempty"`
 	TimeCycle      string `json:"time_cycle,omitempty"`
@@ -0,0 +1,183 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/Crowdstrike/foundry-sample-scalable-rtr/functions/job_history/pkg"
+	"github.com/Crowdstrike/foundry-sample-scalable-rtr/functions/job_history/storagec"
+	"github.com/Crowdstrike/foundry-sample-scalable-rtr/functions/job_history/webhookc"
+)
+
+const (
+	eventExecutionCompleted = "execution.completed"
+	eventExecutionFailed    = "execution.failed"
+)
+
+// isTerminal reports whether an execution with the given status has stopped running.
+func isTerminal(status string) bool {
+	return status == pkg.StatusCompleted || status == pkg.StatusFailed
+}
+
+// executionSummary summarizes an execution for the webhooks of its job.
+func executionSummary(execRecord pkg.JobExecution) pkg.ExecutionSummary {
+	event := eventExecutionCompleted
+	if execRecord.RunStatus == pkg.StatusFailed {
+		event = eventExecutionFailed
+	}
+	hostStatuses := make(map[string]int)
+	for _, h := range execRecord.TargetedHosts {
+		hostStatuses[h.Status]++
+	}
+	return pkg.ExecutionSummary{
+		CSVOutput:      execRecord.CSVOutput,
+		Duration:       execRecord.Duration,
+		EndDate:        execRecord.EndDate,
+		Event:          event,
+		ExecutionID:    execRecord.ExecutionID,
+		HostStatuses:   hostStatuses,
+		JobID:          execRecord.JobID,
+		JobName:        execRecord.JobName,
+		LogscaleOutput: execRecord.LogscaleOutput,
+		NumHosts:       execRecord.NumHosts,
+		RunDate:        execRecord.RunDate,
+		RunStatus:      execRecord.RunStatus,
+	}
+}
+
+// notifyWebhooks posts the signed summary of a finished execution to every webhook of the job. Failed deliveries
+// are logged, they do not fail the upsert of the execution.
+func (p *UpsertProcessor) notifyWebhooks(ctx context.Context, j job, execRecord pkg.JobExecution) {
+	webhooks := j.webhooks()
+	if len(webhooks) == 0 || p.webhc == nil {
+		return
+	}
+
+	body, err := json.Marshal(executionSummary(execRecord))
+	if err != nil {
+		p.logger.Errorf("failed to marshal execution summary: %s", err)
+		return
+	}
+	for i, w := range webhooks {
+		err := p.webhc.Post(ctx, webhookc.PostRequest{
+			Body:       body,
+			DeliveryID: fmt.Sprintf("%s-%d", execRecord.ExecutionID, i),
+			Secret:     w.Secret,
+			URL:        w.URL,
+		})
+		if err != nil {
+			p.logger.WithField("job_id", execRecord.JobID).
+				WithField("execution_id", execRecord.ExecutionID).
+				WithField("url", w.URL).
+				Errorf("failed to notify webhook: %s", err)
+		}
+	}
+}
+
+// shouldNotify evaluates the notification rules of the job against the per host outcome of an execution that just
+// finished, returning the reasons of the rules which matched. Jobs without rules notify of every update.
+func (p *UpsertProcessor) shouldNotify(ctx context.Context, j job, execRecord pkg.JobExecution, finished bool) (bool, []string) {
+	if len(j.NotificationRules) == 0 {
+		return true, nil
+	}
+	if !finished {
+		return false, nil
+	}
+
+	failed, matched := 0, 0
+	for _, h := range execRecord.TargetedHosts {
+		if h.Status == pkg.StatusFailed {
+			failed++
+		}
+		if h.Matched() {
+			matched++
+		}
+	}
+
+	var reasons []string
+	for _, r := range j.NotificationRules {
+		switch r.Type {
+		case ruleOnFailure:
+			if execRecord.RunStatus == pkg.StatusFailed {
+				reasons = append(reasons, "execution failed")
+			} else if failed > 0 {
+				reasons = append(reasons, fmt.Sprintf("%d hosts failed", failed))
+			}
+		case ruleAnyHostMatched:
+			if matched > 0 {
+				reasons = append(reasons, fmt.Sprintf("query matched on %d hosts", matched))
+			}
+		case ruleFailedPercentage:
+			if r.Threshold == nil || len(execRecord.TargetedHosts) == 0 {
+				continue
+			}
+			pct := float64(failed) * 100 / float64(len(execRecord.TargetedHosts))
+			if pct > *r.Threshold {
+				reasons = append(reasons, fmt.Sprintf("%.1f%% of hosts failed, above %g%%", pct, *r.Threshold))
+			}
+		case ruleResultChanged:
+			if reason, changed := p.resultChanged(ctx, execRecord); changed {
+				reasons = append(reasons, reason)
+			}
+		default:
+			p.logger.WithField("job_id", execRecord.JobID).Warnf("ignoring unknown notification rule: %s", r.Type)
+		}
+	}
+	return len(reasons) > 0, reasons
+}
+
+// resultChanged compares the per host outcome of an execution with the previous finished execution of the job.
+// The result is considered changed when there is no previous execution or it cannot be fetched.
+func (p *UpsertProcessor) resultChanged(ctx context.Context, execRecord pkg.JobExecution) (string, bool) {
+	previous, err := p.previousExecution(ctx, execRecord)
+	if err != nil {
+		p.logger.WithField("job_id", execRecord.JobID).Errorf("failed to fetch the previous execution: %s", err)
+		return "previous result unavailable", true
+	}
+	if previous == nil {
+		return "first result", true
+	}
+	if !reflect.DeepEqual(hostResults(previous.TargetedHosts), hostResults(execRecord.TargetedHosts)) {
+		return fmt.Sprintf("result changed since the execution of %s", previous.RunDate), true
+	}
+	return "", false
+}
+
+// previousExecution returns the latest finished execution of the job other than the given one, nil if there is none.
+func (p *UpsertProcessor) previousExecution(ctx context.Context, execRecord pkg.JobExecution) (*pkg.JobExecution, error) {
+	fqlSort, err := pkg.NewFQLSort("run_date", pkg.Desc)
+	if err != nil {
+		return nil, err
+	}
+	sr, err := p.strgc.SearchAndFetch(ctx, storagec.SearchObjectsRequest{
+		Collection: jobExecutionCollection,
+		Filter:     fmt.Sprintf("id:'%s'", execRecord.JobID),
+		Limit:      5,
+		Sort:       fqlSort,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range sr.Objects {
+		e, err := pkg.DecodeJobExecution(o.Data)
+		if err != nil {
+			return nil, err
+		}
+		if e.ExecutionID != execRecord.ExecutionID && isTerminal(e.RunStatus) {
+			return &e, nil
+		}
+	}
+	return nil, nil
+}
+
+// hostResults returns the serialized outcome of every host by host name.
+func hostResults(hosts []pkg.TargetedHost) map[string]string {
+	results := make(map[string]string, len(hosts))
+	for _, h := range hosts {
+		b, _ := json.Marshal(h)
+		results[h.HostName] = string(b)
+	}
+	return results
+}
@@ -25,6 +25,22 @@ func jobExecRespJSON(page *paging, j []pkg.JobExecution, e []fdk.APIError, logge
 	return rJSON
 }
 
+func upsertRespJSON(execRecord pkg.JobExecution, j job, notify bool, reasons []string, logger logrus.FieldLogger) []byte {
+	r := upsertResponse{
+		jobExecutionResponse: jobExecutionResponse{Resources: []pkg.JobExecution{execRecord}},
+		JobName:              j.Name,
+		Notify:               notify,
+		NotifyReasons:        reasons,
+		Recipients:           j.emailRecipients(),
+	}
+	rJSON, err := json.Marshal(r)
+	if err != nil {
+		logger.Errorf("failed to serialize response: %s", err)
+		return nil
+	}
+	return rJSON
+}
+
 func nowT() time.Time {
 	return time.Now().UTC()
 }
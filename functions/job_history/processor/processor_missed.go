@@ -0,0 +1,482 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+	"github.com/Crowdstrike/foundry-sample-scalable-rtr/functions/job_history/pkg"
+	"github.com/Crowdstrike/foundry-sample-scalable-rtr/functions/job_history/storagec"
+	"github.com/Crowdstrike/foundry-sample-scalable-rtr/functions/job_history/webhookc"
+	"github.com/Crowdstrike/foundry-sample-scalable-rtr/functions/job_history/workflowc"
+	"github.com/robfig/cron/v3"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	eventRunMissed = "run.missed"
+	// missedRunAlertWorkflow is the on demand workflow of the app emailing the notification targets of a job.
+	missedRunAlertWorkflow = "Missed run alert"
+
+	defaultGraceMinutes  = 30
+	defaultLookbackHours = 24
+	// maxExpectedRuns bounds the number of scheduled runs checked for a single job in a single check.
+	maxExpectedRuns = 100
+	// maxRecentMissedRuns is the number of missed runs listed on the job.
+	maxRecentMissedRuns = 10
+)
+
+// MissedRunsProcessor compares the scheduled runs of the active jobs with their execution records, flagging the
+// runs which did not start on the job and alerting its notification targets.
+type MissedRunsProcessor struct {
+	logger      logrus.FieldLogger
+	strgc       storagec.StorageC
+	webhc       webhookc.WebhookC
+	wfc         workflowc.WorkflowC
+	nowProvider func() time.Time
+}
+
+// NewMissedRunsProcessor creates a new initialized MissedRunsProcessor instance.
+func NewMissedRunsProcessor(strgc storagec.StorageC, webhc webhookc.WebhookC, wfc workflowc.WorkflowC, logger logrus.FieldLogger, opts ...func(p *MissedRunsProcessor)) *MissedRunsProcessor {
+	p := &MissedRunsProcessor{
+		logger:      logger,
+		strgc:       strgc,
+		webhc:       webhc,
+		wfc:         wfc,
+		nowProvider: nowT,
+	}
+
+	for _, o := range opts {
+		o(p)
+	}
+	return p
+}
+
+// missedRunsRequest tunes the check, GraceMinutes is how late a run may start and LookbackHours is how far back
+// the schedules of jobs checked for the first time are checked.
+type missedRunsRequest struct {
+	GraceMinutes  int `json:"grace_minutes,omitempty"`
+	LookbackHours int `json:"lookback_hours,omitempty"`
+}
+
+type missedRunsResource struct {
+	JobID      string   `json:"job_id"`
+	JobName    string   `json:"job_name"`
+	MissedRuns []string `json:"missed_runs"`
+}
+
+type missedRunsResponse struct {
+	CheckedJobs int                  `json:"checked_jobs"`
+	Errs        []fdk.APIError       `json:"errors,omitempty"`
+	Resources   []missedRunsResource `json:"resources"`
+}
+
+// Process handles a request.
+func (p *MissedRunsProcessor) Process(ctx context.Context, req fdk.Request) Response {
+	mr, err := missedRunsRequestFrom(req)
+	if err != nil {
+		msg := fmt.Sprintf("failed to parse missed runs request: %s", err)
+		p.logger.Error(msg)
+		return Response{
+			Code: http.StatusBadRequest,
+			Errs: []fdk.APIError{{Code: http.StatusBadRequest, Message: msg}},
+		}
+	}
+
+	jobs, err := p.allJobs(ctx)
+	if err != nil {
+		msg := fmt.Sprintf("failed to fetch jobs: %s", err)
+		p.logger.Error(msg)
+		return Response{
+			Code: http.StatusInternalServerError,
+			Errs: []fdk.APIError{{Code: http.StatusInternalServerError, Message: msg}},
+		}
+	}
+
+	now := p.nowProvider()
+	grace := time.Duration(mr.GraceMinutes) * time.Minute
+	until := now.Add(-grace)
+	earliest := now.Add(-time.Duration(mr.LookbackHours) * time.Hour)
+
+	resp := missedRunsResponse{Resources: make([]missedRunsResource, 0)}
+	for jobID, jobMap := range jobs {
+		j, err := distillJob(jobMap)
+		if err != nil {
+			p.logger.WithField("job_id", jobID).Errorf("could not distill job record from dictionary: %s", err)
+			continue
+		}
+		if !j.scheduled() {
+			continue
+		}
+		resp.CheckedJobs++
+
+		missed, err := p.checkJob(ctx, jobID, j, earliest, until, grace)
+		if err != nil {
+			msg := fmt.Sprintf("failed to check missed runs of job %s: %s", jobID, err)
+			p.logger.WithField("job_id", jobID).Error(msg)
+			resp.Errs = append(resp.Errs, fdk.APIError{Code: http.StatusInternalServerError, Message: msg})
+			continue
+		}
+		if len(missed) == 0 {
+			continue
+		}
+
+		p.alert(ctx, jobID, j, missed, until)
+		resp.Resources = append(resp.Resources, missedRunsResource{
+			JobID:      jobID,
+			JobName:    j.Name,
+			MissedRuns: formatTimes(missed),
+		})
+	}
+	sort.Slice(resp.Resources, func(i, k int) bool {
+		return resp.Resources[i].JobName < resp.Resources[k].JobName
+	})
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+		p.logger.Errorf("failed to serialize response: %s", err)
+	}
+	return Response{
+		Body: body,
+		Code: http.StatusOK,
+	}
+}
+
+// checkJob returns the runs of the job scheduled after the job was last checked which did not start within the
+// grace period. The job is flagged with the missed runs and the time it was checked through, unless it was deleted
+// or is no longer scheduled.
+func (p *MissedRunsProcessor) checkJob(ctx context.Context, jobID string, j job, earliest, until time.Time, grace time.Duration) ([]time.Time, error) {
+	since := j.checkedSince(earliest)
+	expected, err := j.expectedRuns(since, until)
+	if err != nil {
+		return nil, err
+	}
+	if len(expected) == 0 {
+		return nil, nil
+	}
+
+	runDates, err := p.scheduledRunDates(ctx, jobID, since.Add(-time.Minute))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch job executions: %s", err)
+	}
+	missed := unmatchedRuns(expected, runDates, grace)
+
+	// the job may have been saved, archived or deleted since the check started, only the missed runs of the job
+	// saved now are updated
+	jobMap, err := fetchRecord(ctx, p.strgc, jobCollection, jobID)
+	if errors.Is(err, storagec.NotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch job record: %s", err)
+	}
+	if j, err = distillJob(jobMap); err != nil {
+		return nil, fmt.Errorf("could not distill job record from dictionary: %s", err)
+	}
+	if !j.scheduled() {
+		return nil, nil
+	}
+
+	flag := missedRuns{}
+	if j.MissedRuns != nil {
+		flag = *j.MissedRuns
+	}
+	flag.CheckedThrough = until
+	if len(missed) > 0 {
+		last := missed[len(missed)-1]
+		flag.Count += len(missed)
+		flag.LastMissed = &last
+		flag.Recent = append(flag.Recent, missed...)
+		if len(flag.Recent) > maxRecentMissedRuns {
+			flag.Recent = flag.Recent[len(flag.Recent)-maxRecentMissedRuns:]
+		}
+	}
+	jobMap["missed_runs"] = flag
+
+	jobB, err := json.Marshal(jobMap)
+	if err != nil {
+		return nil, err
+	}
+	_, err = p.strgc.PutObject(ctx, storagec.PutObjectRequest{
+		Collection: jobCollection,
+		Data:       jobB,
+		ObjectKey:  jobID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to save job record: %s", err)
+	}
+	return missed, nil
+}
+
+// allJobs pages through every job, keyed by job ID.
+func (p *MissedRunsProcessor) allJobs(ctx context.Context) (map[string]map[string]any, error) {
+	fqlFilter, err := pkg.NewFQLQuery([]pkg.Filter{{Field: "created_at", Value: "0", Op: pkg.GTE}})
+	if err != nil {
+		return nil, err
+	}
+	fqlSort, err := pkg.NewFQLSort("created_at", pkg.Asc)
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := p.searchAll(ctx, storagec.SearchObjectsRequest{
+		Collection: jobCollection,
+		Filter:     fqlFilter,
+		Sort:       fqlSort,
+	})
+	if err != nil {
+		return nil, err
+	}
+	jobs := make(map[string]map[string]any, len(records))
+	for _, r := range records {
+		data, err := pkg.DecodeBase64JSON(r.Data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to deserialize job %s: %s", r.Key, err)
+		}
+		var jobMap map[string]any
+		if err = json.Unmarshal(data, &jobMap); err != nil {
+			return nil, fmt.Errorf("failed to deserialize job %s: %s", r.Key, err)
+		}
+		jobs[r.Key] = jobMap
+	}
+	return jobs, nil
+}
+
+// scheduledRunDates returns the run dates of the executions of the job started by its schedule since the given
+// time, leaving out the executions run now and the runs started by an upstream job.
+func (p *MissedRunsProcessor) scheduledRunDates(ctx context.Context, jobID string, since time.Time) ([]time.Time, error) {
+	fqlFilter, err := pkg.NewFQLQuery([]pkg.Filter{
+		{Field: "id", Value: jobID, Op: pkg.EQ},
+		{Field: "run_date", Value: since.UTC().Format(pkg.ISOTimeFormat), Op: pkg.GTE},
+	})
+	if err != nil {
+		return nil, err
+	}
+	fqlSort, err := pkg.NewFQLSort("run_date", pkg.Asc)
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := p.searchAll(ctx, storagec.SearchObjectsRequest{
+		Collection: jobExecutionCollection,
+		Filter:     fqlFilter,
+		Sort:       fqlSort,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var runDates []time.Time
+	for _, r := range records {
+		e, err := pkg.DecodeJobExecution(r.Data)
+		if err != nil {
+			return nil, err
+		}
+		if e.RunNow || e.TriggeredBy != nil {
+			continue
+		}
+		t, err := time.Parse(pkg.ISOTimeFormat, e.RunDate)
+		if err != nil {
+			p.logger.WithField("execution_id", e.ExecutionID).Warnf("ignoring execution with bad run date: %s", e.RunDate)
+			continue
+		}
+		runDates = append(runDates, t)
+	}
+	return runDates, nil
+}
+
+func (p *MissedRunsProcessor) searchAll(ctx context.Context, req storagec.SearchObjectsRequest) ([]storagec.SearchAndFetchRecord, error) {
+	var records []storagec.SearchAndFetchRecord
+	for {
+		sr, err := p.strgc.SearchAndFetch(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, sr.Objects...)
+		// the offset is only returned while there are more results
+		if sr.Offset == 0 || len(sr.Objects) == 0 {
+			return records, nil
+		}
+		req.Offset = sr.Offset
+	}
+}
+
+// alert posts the missed runs to the webhooks of the job and emails its recipients through the alert workflow.
+// Failed alerts are logged, the runs stay flagged on the job.
+func (p *MissedRunsProcessor) alert(ctx context.Context, jobID string, j job, missed []time.Time, until time.Time) {
+	l := p.logger.WithField("job_id", jobID)
+	summary := pkg.MissedRunsSummary{
+		CheckedThrough: until.UTC().Format(pkg.ISOTimeFormat),
+		Event:          eventRunMissed,
+		JobID:          jobID,
+		JobName:        j.Name,
+		MissedRuns:     formatTimes(missed),
+	}
+	// the alerts of a check are delivered once, whatever the number of attempts
+	deliveryID := fmt.Sprintf("%s-missed-%d", jobID, until.Unix())
+
+	if webhooks := j.webhooks(); len(webhooks) > 0 && p.webhc != nil {
+		body, err := json.Marshal(summary)
+		if err != nil {
+			l.Errorf("failed to marshal missed runs summary: %s", err)
+			return
+		}
+		for i, w := range webhooks {
+			err := p.webhc.Post(ctx, webhookc.PostRequest{
+				Body:       body,
+				DeliveryID: fmt.Sprintf("%s-%d", deliveryID, i),
+				Secret:     w.Secret,
+				URL:        w.URL,
+			})
+			if err != nil {
+				l.WithField("url", w.URL).Errorf("failed to notify webhook of missed runs: %s", err)
+			}
+		}
+	}
+
+	recipients := j.emailRecipients()
+	if len(recipients) == 0 || p.wfc == nil {
+		return
+	}
+	_, err := p.wfc.Execute(ctx, workflowc.ExecuteRequest{
+		Body: map[string]any{
+			"job_name":    j.Name,
+			"missed_runs": strings.Join(summary.MissedRuns, ", "),
+			"recipients":  recipients,
+		},
+		Key:  deliveryID,
+		Name: missedRunAlertWorkflow,
+	})
+	if err != nil {
+		l.Errorf("failed to email missed runs: %s", err)
+	}
+}
+
+// scheduled reports whether the job is provisioned on a schedule whose runs are expected to start.
+func (j job) scheduled() bool {
+	if j.Draft || j.Schedule == nil || j.Workflows == nil || len(j.Workflows.ScheduleWorkflow) == 0 {
+		return false
+	}
+	if j.Approval != nil && j.Approval.Status == approvalPending {
+		return false
+	}
+	return j.Schedule.TimeCycle != "" || j.Schedule.RunAt != ""
+}
+
+// checkedSince returns the time the schedule of the job is checked from, the latest of the earliest time checked,
+// the time the job was last checked through and the time its current workflows were provisioned. Saving a job which
+// stays provisioned does not move it, the runs due before are still checked.
+func (j job) checkedSince(earliest time.Time) time.Time {
+	since := earliest
+	if j.MissedRuns != nil && j.MissedRuns.CheckedThrough.After(since) {
+		since = j.MissedRuns.CheckedThrough
+	}
+	for _, t := range []*time.Time{j.CreatedAt, j.ProvisionedAt} {
+		if t != nil && t.After(since) {
+			since = *t
+		}
+	}
+	return since
+}
+
+// expectedRuns returns the runs of the schedule of the job after since and up to until, in ascending order.
+func (j job) expectedRuns(since, until time.Time) ([]time.Time, error) {
+	if !since.Before(until) {
+		return nil, nil
+	}
+	if j.Schedule.RunAt != "" {
+		at, err := time.Parse(time.RFC3339, j.Schedule.RunAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse job run time: %s", err)
+		}
+		if at.After(since) && !at.After(until) {
+			return []time.Time{at.UTC()}, nil
+		}
+		return nil, nil
+	}
+
+	s, err := cron.ParseStandard(j.Schedule.TimeCycle)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse job cron expression: %s", err)
+	}
+	if j.Schedule.Start != "" {
+		start, err := time.Parse(time.RFC3339, j.Schedule.Start)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse job start time: %s", err)
+		}
+		if start.After(since) {
+			// the first run is the first time of the cycle at or after the start
+			since = start.Add(-time.Second)
+		}
+	}
+	if j.Schedule.End != "" {
+		end, err := time.Parse(time.RFC3339, j.Schedule.End)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse job end time: %s", err)
+		}
+		if end.Before(until) {
+			until = end
+		}
+	}
+
+	var runs []time.Time
+	for t := s.Next(since.UTC()); !t.IsZero() && !t.After(until) && len(runs) < maxExpectedRuns; t = s.Next(t) {
+		runs = append(runs, t)
+	}
+	return runs, nil
+}
+
+// unmatchedRuns returns the expected runs without an execution started between a minute before the run and the
+// end of its grace period. Each execution matches a single run.
+func unmatchedRuns(expected, runDates []time.Time, grace time.Duration) []time.Time {
+	used := make([]bool, len(runDates))
+	var missed []time.Time
+	for _, t := range expected {
+		matched := false
+		for i, rd := range runDates {
+			if used[i] || rd.Before(t.Add(-time.Minute)) || rd.After(t.Add(grace)) {
+				continue
+			}
+			used[i], matched = true, true
+			break
+		}
+		if !matched {
+			missed = append(missed, t)
+		}
+	}
+	return missed
+}
+
+func formatTimes(ts []time.Time) []string {
+	formatted := make([]string, len(ts))
+	for i, t := range ts {
+		formatted[i] = t.UTC().Format(pkg.ISOTimeFormat)
+	}
+	return formatted
+}
+
+func missedRunsRequestFrom(req fdk.Request) (missedRunsRequest, error) {
+	var mr missedRunsRequest
+	if req.Body != nil {
+		err := json.NewDecoder(req.Body).Decode(&mr)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return mr, err
+		}
+	}
+	if mr.GraceMinutes < 0 || mr.LookbackHours < 0 {
+		return mr, errors.New("grace_minutes and lookback_hours cannot be negative")
+	}
+	if mr.GraceMinutes == 0 {
+		mr.GraceMinutes = defaultGraceMinutes
+	}
+	if mr.LookbackHours == 0 {
+		mr.LookbackHours = defaultLookbackHours
+	}
+	return mr, nil
+}
@@ -8,15 +8,19 @@ import (
 	"fmt"
 	"github.com/robfig/cron/v3"
 	"net/http"
+	"regexp"
 	"sort"
 	"strings"
 	"time"
 
 	fdk "github.com/CrowdStrike/foundry-fn-go"
 	"github.com/Crowdstrike/foundry-sample-scalable-rtr/functions/job_history/csv"
+	"github.com/Crowdstrike/foundry-sample-scalable-rtr/functions/job_history/devicec"
 	"github.com/Crowdstrike/foundry-sample-scalable-rtr/functions/job_history/pkg"
 	"github.com/Crowdstrike/foundry-sample-scalable-rtr/functions/job_history/searchc"
 	"github.com/Crowdstrike/foundry-sample-scalable-rtr/functions/job_history/storagec"
+	"github.com/Crowdstrike/foundry-sample-scalable-rtr/functions/job_history/webhookc"
+	"github.com/Crowdstrike/foundry-sample-scalable-rtr/functions/job_history/workflowc"
 	"github.com/sirupsen/logrus"
 	"github.com/spaolacci/murmur3"
 )
@@ -27,16 +31,22 @@ type UpsertProcessor struct {
 	logger      logrus.FieldLogger
 	srchc       searchc.SearchC
 	strgc       storagec.StorageC
+	webhc       webhookc.WebhookC
+	wfc         workflowc.WorkflowC
+	devc        devicec.DeviceC
 	nowProvider func() time.Time
 }
 
 // NewUpsertProcessor creates a new initialized UpsertProcessor instance.
-func NewUpsertProcessor(host string, srchc searchc.SearchC, strgc storagec.StorageC, logger logrus.FieldLogger, opts ...func(p *UpsertProcessor)) *UpsertProcessor {
+func NewUpsertProcessor(host string, srchc searchc.SearchC, strgc storagec.StorageC, webhc webhookc.WebhookC, wfc workflowc.WorkflowC, devc devicec.DeviceC, logger logrus.FieldLogger, opts ...func(p *UpsertProcessor)) *UpsertProcessor {
 	p := &UpsertProcessor{
 		falconHost:  host,
 		logger:      logger,
 		srchc:       srchc,
 		strgc:       strgc,
+		webhc:       webhc,
+		wfc:         wfc,
+		devc:        devc,
 		nowProvider: nowT,
 	}
 
@@ -68,31 +78,45 @@ func (p *UpsertProcessor) Process(ctx context.Context, req fdk.Request) Response
 		}
 	}
 
-	jobName, err := wfMeta.jobName()
-	p.logger.Infof("received upsert request for job ID: %s", jobName)
+	jobID, err := p.executionJobID(ctx, &wfMeta)
 	if err != nil {
-		msg := fmt.Sprintf("bad job name provided: %s", err)
-		p.logger.WithField("workflow_meta", wfMeta).Error(msg)
-		return Response{
-			Body: p.genOutRespJSON(nil, []fdk.APIError{{Code: http.StatusBadRequest, Message: msg}}),
-			Code: http.StatusBadRequest,
-			Errs: []fdk.APIError{{Code: http.StatusBadRequest, Message: msg}},
-		}
-	}
-	jobID, err := generateJobID(jobName)
-	if err != nil {
-		msg := fmt.Sprintf("job ID could not be determined: %s", err)
-		p.logger.WithField("job_name", jobName).Error(msg)
+		msg := fmt.Sprintf("could not look up workflow definition: %s", err)
+		p.logger.WithField("definition_id", wfMeta.DefinitionID).Error(msg)
 		return Response{
 			Body: p.genOutRespJSON(nil, []fdk.APIError{{Code: http.StatusInternalServerError, Message: msg}}),
 			Code: http.StatusInternalServerError,
 			Errs: []fdk.APIError{{Code: http.StatusInternalServerError, Message: msg}},
 		}
 	}
+	jobName := ""
+	if jobID == "" {
+		// definitions provisioned before they were indexed are attributed by the job name in their name
+		jobName, err = wfMeta.jobName()
+		if err != nil {
+			msg := fmt.Sprintf("bad job name provided: %s", err)
+			p.logger.WithField("workflow_meta", wfMeta).Error(msg)
+			return Response{
+				Body: p.genOutRespJSON(nil, []fdk.APIError{{Code: http.StatusBadRequest, Message: msg}}),
+				Code: http.StatusBadRequest,
+				Errs: []fdk.APIError{{Code: http.StatusBadRequest, Message: msg}},
+			}
+		}
+		jobID, err = generateJobID(jobName)
+		if err != nil {
+			msg := fmt.Sprintf("job ID could not be determined: %s", err)
+			p.logger.WithField("job_name", jobName).Error(msg)
+			return Response{
+				Body: p.genOutRespJSON(nil, []fdk.APIError{{Code: http.StatusInternalServerError, Message: msg}}),
+				Code: http.StatusInternalServerError,
+				Errs: []fdk.APIError{{Code: http.StatusInternalServerError, Message: msg}},
+			}
+		}
+	}
+	p.logger.Infof("received upsert request for job ID: %s", jobID)
 	jobMap, err := p.fetchObject(ctx, jobCollection, jobID)
 	if err != nil {
 		msg := fmt.Sprintf("could not fetch job record: %s", err)
-		p.logger.WithField("job_name", jobName).
+		p.logger.WithField("definition_id", wfMeta.DefinitionID).
 			WithField("job_id", jobID).Error(msg)
 		return Response{
 			Body: p.genOutRespJSON(nil, []fdk.APIError{{Code: http.StatusInternalServerError, Message: msg}}),
@@ -103,7 +127,7 @@ func (p *UpsertProcessor) Process(ctx context.Context, req fdk.Request) Response
 	jobInstance, err := distillJob(jobMap)
 	if err != nil {
 		msg := fmt.Sprintf("could not distill job record from dictionary: %s", err)
-		p.logger.WithField("job_name", jobName).
+		p.logger.WithField("definition_id", wfMeta.DefinitionID).
 			WithField("job_id", jobID).Error(msg)
 		return Response{
 			Body: p.genOutRespJSON(nil, []fdk.APIError{{Code: http.StatusInternalServerError, Message: msg}}),
@@ -111,8 +135,17 @@ func (p *UpsertProcessor) Process(ctx context.Context, req fdk.Request) Response
 			Errs: []fdk.APIError{{Code: http.StatusInternalServerError, Message: msg}},
 		}
 	}
+	// executions are recorded under the current name of the job, which may have been renamed
+	if jobInstance.Name != "" {
+		jobName = jobInstance.Name
+	}
+	// runs of a downstream job are provisioned without batching
+	chained := wfMeta.chainToken() != ""
+	if chained {
+		jobInstance.Waves = 1
+	}
 
-	jobExecutionKey, execRecord, newExec, err := p.jobExecutionRecord(ctx, jobID, jobName, wfMeta)
+	jobExecutionKey, execRecord, newExec, err := p.jobExecutionRecord(ctx, jobID, jobName, jobInstance, wfMeta)
 	if err != nil {
 		msg := fmt.Sprintf("failed to fetch job execution record: %s", err)
 		p.logger.Error(msg)
@@ -122,14 +155,40 @@ func (p *UpsertProcessor) Process(ctx context.Context, req fdk.Request) Response
 			Errs: []fdk.APIError{{Code: http.StatusInternalServerError, Message: msg}},
 		}
 	}
+
+	// notifications are only evaluated the first time the execution finishes
+	prevStatus := execRecord.RunStatus
+
+	lsResp, err := p.execLSResults(ctx, wfMeta.ExecutionID)
+	if err != nil {
+		msg := fmt.Sprintf("failed to execute logscale search: %s", err)
+		p.logger.Error(msg)
+		return Response{
+			Body: p.genOutRespJSON(nil, []fdk.APIError{{Code: http.StatusInternalServerError, Message: msg}}),
+			Code: http.StatusInternalServerError,
+			Errs: []fdk.APIError{{Code: http.StatusInternalServerError, Message: msg}},
+		}
+	}
+	hosts := extractHostsFromLogscale(lsResp, jobInstance, p.logger)
+
+	// the waves and platforms of a job are aggregated into a single execution record
+	wave := wfMeta.wave()
+	runStatus := wfMeta.Status
+	partitioned := jobInstance.partitions() > 1
+	if partitioned {
+		execRecord = mergeWaveExecution(execRecord, wave, wfMeta, hosts, p.now())
+		hosts = execRecord.TargetedHosts
+		runStatus = execRecord.RunStatus
+	}
+
 	endDate := execRecord.EndDate
 	if endDate == "" {
 		endDate = p.now()
-		if wfMeta.Status == pkg.StatusCompleted || wfMeta.Status == pkg.StatusFailed {
+		if runStatus == pkg.StatusCompleted || runStatus == pkg.StatusFailed {
 			execRecord.EndDate = endDate
 		}
 	}
-	d, err := computeJobDuration(execRecord.RunDate, endDate, wfMeta.Status)
+	d, err := computeJobDuration(execRecord.RunDate, endDate, runStatus)
 	if err != nil {
 		msg := fmt.Sprintf("failed to compute job duration execution: %s", err)
 		p.logger.Error(msg)
@@ -143,29 +202,21 @@ func (p *UpsertProcessor) Process(ctx context.Context, req fdk.Request) Response
 		execRecord.Duration = d
 	}
 
-	if wfMeta.Status != "" {
-		execRecord.RunStatus = wfMeta.Status
-	}
-
-	lsResp, err := p.execLSResults(ctx, wfMeta.ExecutionID)
-	if err != nil {
-		msg := fmt.Sprintf("failed to execute logscale search: %s", err)
-		p.logger.Error(msg)
-		return Response{
-			Body: p.genOutRespJSON(nil, []fdk.APIError{{Code: http.StatusInternalServerError, Message: msg}}),
-			Code: http.StatusInternalServerError,
-			Errs: []fdk.APIError{{Code: http.StatusInternalServerError, Message: msg}},
-		}
+	if runStatus != "" {
+		execRecord.RunStatus = runStatus
 	}
 
-	hosts := extractHostsFromLogscale(lsResp, p.logger)
 	execRecord.TargetedHosts = hosts
 	execRecord.NumHosts = len(hosts)
-	if shouldOutputAs(jobInstance, newExec, "logscale") {
+	if shouldOutputAs(jobInstance, newExec, "logscale") && execRecord.LogscaleOutput == "" {
 		execRecord.LogscaleOutput = lsResp.JobURL
 	}
 
-	jobInstance, err = p.updateJobRunStats(jobInstance, execRecord.RunStatus)
+	// only the first wave of a batched job on its first platform counts as a run of the job, runs of a downstream
+	// job are not part of its schedule
+	if wave == 1 && wfMeta.platform() == jobInstance.platforms()[0] && !chained {
+		jobInstance, err = p.updateJobRunStats(jobInstance, wfMeta.Status)
+	}
 	if err != nil {
 		msg := fmt.Sprintf("failed to update job record: %s", err)
 		p.logger.Error(msg)
@@ -188,7 +239,11 @@ func (p *UpsertProcessor) Process(ctx context.Context, req fdk.Request) Response
 	}
 
 	if shouldOutputAs(jobInstance, newExec, "csv") {
-		link, err := p.saveCSV(ctx, execRecord.ID, lsResp.Events)
+		csvName := execRecord.ID
+		if partitioned {
+			csvName = fmt.Sprintf("%s_%s", execRecord.ID, wfMeta.ExecutionID)
+		}
+		link, err := p.saveCSV(ctx, csvName, lsResp.Events)
 		if err != nil {
 			msg := fmt.Sprintf("failed to write CSV record: %s", err)
 			p.logger.Error(msg)
@@ -199,7 +254,22 @@ func (p *UpsertProcessor) Process(ctx context.Context, req fdk.Request) Response
 			}
 		}
 		if link != "" {
-			execRecord.CSVOutput = link
+			if partitioned {
+				execRecord = setWaveCSVOutput(execRecord, wfMeta.ExecutionID, link)
+			}
+			if execRecord.CSVOutput == "" || !partitioned {
+				execRecord.CSVOutput = link
+			}
+		}
+	}
+
+	finished := isTerminal(execRecord.RunStatus) && !isTerminal(prevStatus)
+	if finished {
+		execRecord = p.tagHosts(ctx, jobInstance, execRecord)
+		execRecord = p.triggerDownstream(ctx, jobInstance, execRecord)
+		// the workflows provisioned for a run of a downstream job are only used once
+		if chained {
+			p.releaseChainedRun(ctx, wfMeta.chainToken(), jobID, execRecord.ExecutionID)
 		}
 	}
 
@@ -225,8 +295,13 @@ func (p *UpsertProcessor) Process(ctx context.Context, req fdk.Request) Response
 		}
 	}
 
+	notify, reasons := p.shouldNotify(ctx, jobInstance, execRecord, finished)
+	if finished && notify {
+		p.notifyWebhooks(ctx, jobInstance, execRecord)
+	}
+
 	return Response{
-		Body: jobExecRespJSON(nil, []pkg.JobExecution{execRecord}, nil, p.logger),
+		Body: upsertRespJSON(execRecord, jobInstance, notify, reasons, p.logger),
 		Code: http.StatusOK,
 	}
 }
@@ -243,13 +318,17 @@ func shouldOutputAs(j job, newExec bool, kind string) bool {
 	return false
 }
 
-func (p *UpsertProcessor) jobExecutionRecord(ctx context.Context, jobID, jobName string, wfMeta workflowMeta) (string, pkg.JobExecution, bool, error) {
+func (p *UpsertProcessor) jobExecutionRecord(ctx context.Context, jobID, jobName string, jobInstance job, wfMeta workflowMeta) (string, pkg.JobExecution, bool, error) {
+	totalWaves := jobInstance.partitions()
 	tsNano, err := time.Parse(pkg.ISOTimeFormat, wfMeta.ExecutionTimestamp)
 	if err != nil {
 		return "", pkg.JobExecution{}, false, fmt.Errorf("failed to parse execution timestamp: %s", err)
 	}
 	var execRecordMap map[string]any
 	jobExecutionKey, err := p.locateJobExecution(ctx, wfMeta.ExecutionID)
+	if jobExecutionKey == "" && err == nil && totalWaves > 1 {
+		jobExecutionKey, err = p.locateWaveExecution(ctx, jobID, wfMeta)
+	}
 	if jobExecutionKey == "" {
 		jobExecutionKey = fmt.Sprintf("%d_%s", tsNano.UnixNano(), wfMeta.ExecutionID)
 		err = storagec.NotFound
@@ -272,6 +351,18 @@ func (p *UpsertProcessor) jobExecutionRecord(ctx context.Context, jobID, jobName
 			"name":         jobName,
 			"run_date":     wfMeta.ExecutionTimestamp,
 		}
+		if totalWaves > 1 {
+			execRecordMap["total_waves"] = totalWaves
+			execRecordMap["platforms"] = jobInstance.platforms()
+		}
+		if jobInstance.ranNow(wfMeta) {
+			execRecordMap["run_now"] = true
+		}
+		if token := wfMeta.chainToken(); token != "" {
+			if origin := p.linkChainedRun(ctx, token, jobID, wfMeta.ExecutionID); origin != nil {
+				execRecordMap["triggered_by"] = origin
+			}
+		}
 	}
 
 	execRecord, err := mapToJobExecution(execRecordMap)
@@ -294,7 +385,131 @@ func (p *UpsertProcessor) locateJobExecution(ctx context.Context, execID string)
 	return sr.ObjectKeys[0], err
 }
 
-func extractHostsFromLogscale(sr searchc.SearchResponse, l logrus.FieldLogger) []pkg.TargetedHost {
+// locateWaveExecution returns the key of the latest execution record of a batched or multi-platform job if the
+// wave belongs to it. A wave belongs to the latest record when that record is still missing waves, including this one.
+func (p *UpsertProcessor) locateWaveExecution(ctx context.Context, jobID string, wfMeta workflowMeta) (string, error) {
+	fqlSort, err := pkg.NewFQLSort("run_date", pkg.Desc)
+	if err != nil {
+		return "", err
+	}
+	sr, err := p.strgc.SearchAndFetch(ctx, storagec.SearchObjectsRequest{
+		Collection: jobExecutionCollection,
+		Filter:     fmt.Sprintf("id:'%s'", jobID),
+		Limit:      1,
+		Sort:       fqlSort,
+	})
+	if err != nil || len(sr.Objects) == 0 {
+		return "", err
+	}
+	latest, err := pkg.DecodeJobExecution(sr.Objects[0].Data)
+	if err != nil {
+		return "", err
+	}
+
+	wave, platform := wfMeta.wave(), wfMeta.platform()
+	for _, w := range latest.Waves {
+		if w.ExecutionID == wfMeta.ExecutionID {
+			return sr.Objects[0].Key, nil
+		}
+		if w.Wave == wave && w.TargetPlatform() == platform {
+			// this wave was already recorded, so it starts a new run
+			return "", nil
+		}
+	}
+	if latest.TotalWaves <= 1 || len(latest.Waves) >= latest.TotalWaves {
+		return "", nil
+	}
+	return sr.Objects[0].Key, nil
+}
+
+// mergeWaveExecution records the state of a single wave and recomputes the status and hosts of the aggregated execution.
+func mergeWaveExecution(execRecord pkg.JobExecution, wave int, wfMeta workflowMeta, hosts []pkg.TargetedHost, now string) pkg.JobExecution {
+	idx := -1
+	for i, w := range execRecord.Waves {
+		if w.ExecutionID == wfMeta.ExecutionID {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		execRecord.Waves = append(execRecord.Waves, pkg.WaveExecution{
+			ExecutionID: wfMeta.ExecutionID,
+			Platform:    wfMeta.platform(),
+			RunDate:     wfMeta.ExecutionTimestamp,
+			Wave:        wave,
+		})
+		idx = len(execRecord.Waves) - 1
+	}
+
+	w := execRecord.Waves[idx]
+	if wfMeta.Status != "" {
+		w.RunStatus = wfMeta.Status
+	}
+	if w.EndDate == "" && (w.RunStatus == pkg.StatusCompleted || w.RunStatus == pkg.StatusFailed) {
+		w.EndDate = now
+	}
+	w.TargetedHosts = hosts
+	execRecord.Waves[idx] = w
+
+	sort.Slice(execRecord.Waves, func(i, j int) bool {
+		if execRecord.Waves[i].Wave != execRecord.Waves[j].Wave {
+			return execRecord.Waves[i].Wave < execRecord.Waves[j].Wave
+		}
+		return execRecord.Waves[i].Platform < execRecord.Waves[j].Platform
+	})
+	if execRecord.RunDate == "" || execRecord.Waves[0].RunDate < execRecord.RunDate {
+		execRecord.RunDate = execRecord.Waves[0].RunDate
+	}
+
+	hostSet := make(map[string]pkg.TargetedHost)
+	for _, w := range execRecord.Waves {
+		for _, h := range w.TargetedHosts {
+			hostSet[h.HostName] = h
+		}
+	}
+	merged := make([]pkg.TargetedHost, 0, len(hostSet))
+	for _, h := range hostSet {
+		merged = append(merged, h)
+	}
+	sort.Slice(merged, func(i, j int) bool {
+		return merged[i].HostName <= merged[j].HostName
+	})
+	execRecord.TargetedHosts = merged
+	execRecord.RunStatus = aggregateWaveStatus(execRecord.Waves, execRecord.TotalWaves)
+	return execRecord
+}
+
+// aggregateWaveStatus is in progress until every wave finished, and failed if any of the waves failed.
+func aggregateWaveStatus(waves []pkg.WaveExecution, totalWaves int) string {
+	if len(waves) < totalWaves {
+		return pkg.StatusInProgress
+	}
+	failed := false
+	for _, w := range waves {
+		switch w.RunStatus {
+		case pkg.StatusFailed:
+			failed = true
+		case pkg.StatusCompleted:
+		default:
+			return pkg.StatusInProgress
+		}
+	}
+	if failed {
+		return pkg.StatusFailed
+	}
+	return pkg.StatusCompleted
+}
+
+func setWaveCSVOutput(execRecord pkg.JobExecution, execID, link string) pkg.JobExecution {
+	for i, w := range execRecord.Waves {
+		if w.ExecutionID == execID {
+			execRecord.Waves[i].CSVOutput = link
+		}
+	}
+	return execRecord
+}
+
+func extractHostsFromLogscale(sr searchc.SearchResponse, j job, l logrus.FieldLogger) []pkg.TargetedHost {
 	events := sr.Events
 	if len(events) == 0 {
 		return make([]pkg.TargetedHost, 0)
@@ -302,11 +517,8 @@ func extractHostsFromLogscale(sr searchc.SearchResponse, l logrus.FieldLogger) [
 
 	devSet := make(map[string]logscaleRecord)
 	for _, e := range events {
-		lr, lrOk := extractLogscaleInstall(e)
-		if !lrOk {
-			lr, lrOk = extractLogscaleRemove(e, l)
-		}
-		if lrOk {
+		if lr, ok := extractLogscaleOutcome(e, j, l); ok {
+			lr.DeviceID = extractDeviceID(e)
 			devSet[lr.HostName] = lr
 		}
 	}
@@ -318,9 +530,14 @@ func extractHostsFromLogscale(sr searchc.SearchResponse, l logrus.FieldLogger) [
 			status = pkg.StatusCompleted
 		}
 		devs[i] = pkg.TargetedHost{
-			DeviceID: "",
+			DeviceID: d.DeviceID,
+			Files:    d.Files,
 			HostName: d.HostName,
+			Output:   d.Output,
+			Presence: d.Presence,
+			Registry: d.Registry,
 			Status:   status,
+			Steps:    d.Steps,
 		}
 		i++
 	}
@@ -412,6 +629,270 @@ func extractLogscaleRemove(e map[string]any, l logrus.FieldLogger) (logscaleReco
 		checkSuccessful == "true" || checkSuccessful == "false"
 }
 
+// fileQueryResultKey matches the result of the file query scripts, for example
+// rtr.app_check_file_or_registry_exist.result or rtr.app_check_file_exist_linux.result.
+var fileQueryResultKey = regexp.MustCompile(`rtr\.app_check_file_[a-z_]*\.result(\.|$)`)
+
+// extractLogscaleFileQuery extracts the per path outcome of a file query. The result is either logged as a
+// JSON object or flattened into one key per path and field, such as result.C:\Windows\notepad.exe.Exists.
+func extractLogscaleFileQuery(e map[string]any, l logrus.FieldLogger) (logscaleRecord, bool) {
+	hostName := ""
+	results := make(map[string]map[string]string)
+
+	for k, v := range e {
+		lk := strings.ToLower(k)
+		if strings.HasSuffix(lk, "device.getdetails.hostname") {
+			if s, ok := v.(string); ok && strings.TrimSpace(s) != "" {
+				hostName = strings.TrimSpace(s)
+			}
+			continue
+		}
+		loc := fileQueryResultKey.FindStringIndex(lk)
+		if loc == nil {
+			continue
+		}
+		s, ok := v.(string)
+		if !ok {
+			continue
+		}
+		if loc[1] == len(lk) {
+			var m map[string]map[string]string
+			if err := json.Unmarshal([]byte(s), &m); err != nil {
+				l.WithField("key", k).Errorf("failed to decode file query result: %s", err)
+				continue
+			}
+			for path, fields := range m {
+				results[path] = fields
+			}
+			continue
+		}
+		// the path may contain dots, the field name never does
+		rest := k[loc[1]:]
+		idx := strings.LastIndex(rest, ".")
+		if idx <= 0 {
+			continue
+		}
+		path, field := rest[:idx], rest[idx+1:]
+		if results[path] == nil {
+			results[path] = make(map[string]string)
+		}
+		results[path][field] = s
+	}
+
+	if hostName == "" || len(results) == 0 {
+		return logscaleRecord{}, false
+	}
+
+	files := make([]pkg.FileResult, 0, len(results))
+	for path, fields := range results {
+		files = append(files, pkg.FileResult{
+			Exists:     strings.EqualFold(fields["Exists"], "true"),
+			Matched:    splitAttributes(fields["Matched"]),
+			Mismatched: splitAttributes(fields["Mismatched"]),
+			Path:       path,
+		})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+	return logscaleRecord{Files: files, HostName: hostName, Success: "true"}, true
+}
+
+// registryQueryResult is a single entry of the output of the registry query script. Match is a boolean, but older
+// versions of the script serialize it as a string.
+type registryQueryResult struct {
+	Actual    string `json:"Actual"`
+	Exists    *bool  `json:"Exists"`
+	Key       string `json:"Key"`
+	Match     any    `json:"Match"`
+	ValueName string `json:"ValueName"`
+}
+
+// extractLogscaleRegistryQuery extracts the per key outcome of a registry query from the output of the script.
+func extractLogscaleRegistryQuery(e map[string]any, l logrus.FieldLogger) (logscaleRecord, bool) {
+	hostName := ""
+	stdout := ""
+
+	for k, v := range e {
+		lk := strings.ToLower(k)
+		switch {
+		case strings.HasSuffix(lk, "device.getdetails.hostname"):
+			if s, ok := v.(string); ok && strings.TrimSpace(s) != "" {
+				hostName = strings.TrimSpace(s)
+			}
+		case strings.HasSuffix(lk, "rtr.app_check_registry_exist.stdout"):
+			if s, ok := v.(string); ok && strings.TrimSpace(s) != "" {
+				stdout = strings.TrimSpace(s)
+			}
+		}
+	}
+
+	if hostName == "" || stdout == "" {
+		return logscaleRecord{}, false
+	}
+
+	var entries []registryQueryResult
+	if err := decodeScriptResult(stdout, &entries); err != nil {
+		l.WithField("host_name", hostName).Errorf("failed to decode registry query output: %s", err)
+		return logscaleRecord{HostName: hostName, Success: "false"}, true
+	}
+
+	results := make([]pkg.RegistryResult, 0, len(entries))
+	for _, r := range entries {
+		match := false
+		switch m := r.Match.(type) {
+		case bool:
+			match = m
+		case string:
+			match = strings.EqualFold(m, "true")
+		}
+		results = append(results, pkg.RegistryResult{
+			Actual:    r.Actual,
+			Exists:    r.Exists,
+			Key:       r.Key,
+			Match:     match,
+			ValueName: r.ValueName,
+		})
+	}
+	return logscaleRecord{HostName: hostName, Registry: results, Success: "true"}, true
+}
+
+// extractLogscaleScriptOutput extracts the output fields of an RTR script of the app, such as
+// rtr.app_check_file_exist_linux.result. A JSON object written to stdout is decoded into its fields.
+func extractLogscaleScriptOutput(e map[string]any, script string) (logscaleRecord, bool) {
+	if script == "" {
+		return logscaleRecord{}, false
+	}
+	hostName := ""
+	prefix := "rtr.app_" + strings.ToLower(script) + "."
+	output := make(map[string]any)
+
+	for k, v := range e {
+		lk := strings.ToLower(k)
+		if strings.HasSuffix(lk, "device.getdetails.hostname") {
+			if s, ok := v.(string); ok && strings.TrimSpace(s) != "" {
+				hostName = strings.TrimSpace(s)
+			}
+			continue
+		}
+		idx := strings.Index(lk, prefix)
+		if idx < 0 {
+			continue
+		}
+		field := k[idx+len(prefix):]
+		if s, ok := v.(string); ok && strings.EqualFold(field, "stdout") {
+			var fields map[string]any
+			if err := json.Unmarshal([]byte(strings.TrimSpace(s)), &fields); err == nil {
+				for name, value := range fields {
+					output[name] = value
+				}
+				continue
+			}
+		}
+		output[field] = v
+	}
+
+	if hostName == "" || len(output) == 0 {
+		return logscaleRecord{}, false
+	}
+	success := "true"
+	for field, v := range output {
+		if s, ok := v.(string); ok && strings.EqualFold(field, "stderr") && strings.TrimSpace(s) != "" {
+			success = "false"
+		}
+	}
+	return logscaleRecord{HostName: hostName, Output: output, Success: success}, true
+}
+
+// presenceQueryResult is a single entry of the output of the process and service query script.
+type presenceQueryResult struct {
+	Found   bool            `json:"Found"`
+	Matches json.RawMessage `json:"Matches"`
+	Name    string          `json:"Name"`
+	Path    string          `json:"Path"`
+	State   string          `json:"State"`
+}
+
+// extractLogscalePresenceQuery extracts the per search outcome of a process or service query from the output of the script.
+func extractLogscalePresenceQuery(e map[string]any, l logrus.FieldLogger) (logscaleRecord, bool) {
+	hostName := ""
+	stdout := ""
+
+	for k, v := range e {
+		lk := strings.ToLower(k)
+		switch {
+		case strings.HasSuffix(lk, "device.getdetails.hostname"):
+			if s, ok := v.(string); ok && strings.TrimSpace(s) != "" {
+				hostName = strings.TrimSpace(s)
+			}
+		case strings.HasSuffix(lk, "rtr.app_check_process_or_service.stdout"):
+			if s, ok := v.(string); ok && strings.TrimSpace(s) != "" {
+				stdout = strings.TrimSpace(s)
+			}
+		}
+	}
+
+	if hostName == "" || stdout == "" {
+		return logscaleRecord{}, false
+	}
+
+	var entries []presenceQueryResult
+	if err := decodeScriptResult(stdout, &entries); err != nil {
+		l.WithField("host_name", hostName).Errorf("failed to decode process or service query output: %s", err)
+		return logscaleRecord{HostName: hostName, Success: "false"}, true
+	}
+
+	results := make([]pkg.PresenceResult, 0, len(entries))
+	for _, r := range entries {
+		// a single match is serialized as a string rather than an array
+		var matches []string
+		if err := json.Unmarshal(r.Matches, &matches); err != nil {
+			var match string
+			if json.Unmarshal(r.Matches, &match) == nil && match != "" {
+				matches = []string{match}
+			}
+		}
+		results = append(results, pkg.PresenceResult{
+			Found:   r.Found,
+			Matches: matches,
+			Name:    r.Name,
+			Path:    r.Path,
+			State:   r.State,
+		})
+	}
+	return logscaleRecord{HostName: hostName, Presence: results, Success: "true"}, true
+}
+
+// decodeScriptResult decodes the result list of the output of a script. PowerShell serializes a single result as
+// an object rather than an array.
+func decodeScriptResult[T any](stdout string, entries *[]T) error {
+	var out struct {
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &out); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(out.Result, entries); err == nil {
+		return nil
+	}
+	var entry T
+	if err := json.Unmarshal(out.Result, &entry); err != nil {
+		return err
+	}
+	*entries = append(*entries, entry)
+	return nil
+}
+
+func splitAttributes(s string) []string {
+	var attrs []string
+	for _, a := range strings.Split(s, ",") {
+		if a = strings.TrimSpace(a); a != "" {
+			attrs = append(attrs, a)
+		}
+	}
+	return attrs
+}
+
 func isRemoveSuccessful(s string) (string, error) {
 	var m map[string]any
 	if err := json.Unmarshal([]byte(s), &m); err != nil {
@@ -507,7 +988,8 @@ func wfMetaFromRequest(req fdk.Request) (workflowMeta, error) {
 	if wfMeta.DefinitionName == "" {
 		return wfMeta, errors.New("missing definition name")
 	}
-	if strings.Index(wfMeta.DefinitionName, "-") < 0 {
+	// the job of an indexed definition is looked up by its ID, the job name is only parsed from older definitions
+	if wfMeta.JobID == "" && wfMeta.DefinitionID == "" && strings.Index(wfMeta.DefinitionName, "-") < 0 {
 		return wfMeta, errors.New("definition name does not contain job name")
 	}
 	wfMeta.Status = pkg.NormalizeJobStatus(wfMeta.Status)
@@ -562,11 +1044,16 @@ func (p *UpsertProcessor) execLSResults(ctx context.Context, execID string) (sea
 }
 
 func (p *UpsertProcessor) fetchObject(ctx context.Context, collection, objectKey string) (map[string]any, error) {
+	return fetchRecord(ctx, p.strgc, collection, objectKey)
+}
+
+// fetchRecord returns the object saved with the given key as a dictionary, storagec.NotFound when there is none.
+func fetchRecord(ctx context.Context, strgc storagec.StorageC, collection, objectKey string) (map[string]any, error) {
 	req := storagec.FetchObjectRequest{
 		Collection: collection,
 		ObjectKey:  objectKey,
 	}
-	resp, err := p.strgc.FetchObject(ctx, req)
+	resp, err := strgc.FetchObject(ctx, req)
 	if errors.Is(err, storagec.NotFound) {
 		return nil, err
 	}
@@ -618,6 +1105,61 @@ func (p *UpsertProcessor) now() string {
 	return p.nowProvider().Format(pkg.ISOTimeFormat)
 }
 
+// executionJobID returns the ID of the job the workflow execution runs, empty when it cannot be told from the
+// execution. Executions of the on demand workflows shared by run now jobs report their job when they start, and
+// are matched with the execution recorded then when they finish, along with their wave and platform.
+func (p *UpsertProcessor) executionJobID(ctx context.Context, wfMeta *workflowMeta) (string, error) {
+	if wfMeta.JobID != "" {
+		return wfMeta.JobID, nil
+	}
+	jobID, err := p.indexedJobID(ctx, wfMeta.DefinitionID)
+	if jobID != "" || err != nil {
+		return jobID, err
+	}
+
+	key, err := p.locateJobExecution(ctx, wfMeta.ExecutionID)
+	if key == "" || err != nil {
+		return "", err
+	}
+	execMap, err := p.fetchObject(ctx, jobExecutionCollection, key)
+	if errors.Is(err, storagec.NotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	execRecord, err := mapToJobExecution(execMap)
+	if err != nil {
+		return "", fmt.Errorf("failed to deserialize job execution record: %s", err)
+	}
+	for _, w := range execRecord.Waves {
+		if w.ExecutionID == wfMeta.ExecutionID {
+			wfMeta.Wave, wfMeta.Platform = w.Wave, w.TargetPlatform()
+		}
+	}
+	if execRecord.JobID == "" {
+		return execRecord.ID, nil
+	}
+	return execRecord.JobID, nil
+}
+
+// indexedJobID returns the ID of the job a workflow definition was provisioned for, empty when the definition is
+// not indexed.
+func (p *UpsertProcessor) indexedJobID(ctx context.Context, definitionID string) (string, error) {
+	if definitionID == "" {
+		return "", nil
+	}
+	entry, err := p.fetchObject(ctx, workflowIndexCollection, definitionID)
+	if errors.Is(err, storagec.NotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	jobID, _ := entry["job_id"].(string)
+	return jobID, nil
+}
+
 func generateJobID(key string) (string, error) {
 	b := murmur3.New128()
 	_, err := b.Write([]byte(key))
@@ -647,6 +1189,9 @@ func updateJobMap(j job, jobMap map[string]any) (map[string]any, error) {
 	jobMap["next_run"] = j.NextRun
 	jobMap["run_count"] = j.RunCount
 	jobMap["total_recurrences"] = j.TotalRecurrences
+	if j.completed() {
+		jobMap["lifecycle"] = lifecycleCompleted
+	}
 	if j.Schedule == nil {
 		jobMap["schedule"] = nil
 		return jobMap, nil
@@ -714,6 +1259,18 @@ func initialJobRecurrenceInfo(j job, now time.Time) (job, error) {
 		return j, nil
 	}
 
+	// a one-time schedule runs exactly once, after the run now execution when the job was also run now
+	if j.Schedule.RunAt != "" {
+		if j.RunNow {
+			j.TotalRecurrences++
+			j.NextRun, err = time.Parse(time.RFC3339, j.Schedule.RunAt)
+			if err != nil {
+				return j, fmt.Errorf("failed to parse job run time: %s", err)
+			}
+		}
+		return j, nil
+	}
+
 	if j.RunNow {
 		j.NextRun, err = time.Parse(pkg.ISOTimeFormatOffset, j.Schedule.Start)
 		if err != nil {
@@ -0,0 +1,92 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/Crowdstrike/foundry-sample-scalable-rtr/functions/job_history/devicec"
+	"github.com/Crowdstrike/foundry-sample-scalable-rtr/functions/job_history/pkg"
+)
+
+// groupingTagPrefix prefixes the Falcon grouping tags of hosts, the tags of jobs are saved without it.
+const groupingTagPrefix = "FalconGroupingTags/"
+
+// maxTaggingErrors is the number of device errors recorded on an execution, the others are only counted.
+const maxTaggingErrors = 20
+
+// tagHosts applies the grouping tags of the job to the hosts of an execution which just finished, by the result
+// of each host, and records the outcome on the execution. Failures to tag hosts do not fail the upsert.
+func (p *UpsertProcessor) tagHosts(ctx context.Context, j job, execRecord pkg.JobExecution) pkg.JobExecution {
+	t := j.HostTagging
+	if t == nil || p.devc == nil || (len(t.MatchTags) == 0 && len(t.NoMatchTags) == 0) {
+		return execRecord
+	}
+
+	outcome := &pkg.HostTaggingOutcome{}
+	var matched, unmatched []string
+	for _, h := range execRecord.TargetedHosts {
+		if h.DeviceID == "" || h.Status != pkg.StatusCompleted {
+			outcome.SkippedHosts++
+			continue
+		}
+		if h.Matched() {
+			matched = append(matched, h.DeviceID)
+		} else {
+			unmatched = append(unmatched, h.DeviceID)
+		}
+	}
+
+	updates := []devicec.UpdateTagsRequest{
+		{Action: devicec.ActionAdd, DeviceIDs: matched, Tags: groupingTags(t.MatchTags)},
+		{Action: devicec.ActionAdd, DeviceIDs: unmatched, Tags: groupingTags(t.NoMatchTags)},
+	}
+	if t.RemoveStale {
+		updates = append(updates,
+			devicec.UpdateTagsRequest{Action: devicec.ActionRemove, DeviceIDs: matched, Tags: groupingTags(t.NoMatchTags)},
+			devicec.UpdateTagsRequest{Action: devicec.ActionRemove, DeviceIDs: unmatched, Tags: groupingTags(t.MatchTags)},
+		)
+	}
+
+	l := p.logger.WithField("job_id", execRecord.JobID).WithField("execution_id", execRecord.ExecutionID)
+	for _, u := range updates {
+		if len(u.DeviceIDs) == 0 || len(u.Tags) == 0 {
+			continue
+		}
+		update := pkg.TagUpdate{Action: u.Action, Tags: u.Tags}
+		resp, err := p.devc.UpdateTags(ctx, u)
+		if err != nil {
+			l.Errorf("failed to update host tags: %s", err)
+			outcome.Errors = append(outcome.Errors, err.Error())
+			update.Failed = len(u.DeviceIDs) - resp.Updated
+		} else {
+			update.Failed = len(resp.Failed)
+		}
+		update.Updated = resp.Updated
+		for _, id := range sortedDeviceIDs(resp.Failed) {
+			if len(outcome.Errors) < maxTaggingErrors {
+				outcome.Errors = append(outcome.Errors, fmt.Sprintf("%s: %s", id, resp.Failed[id]))
+			}
+		}
+		outcome.Updates = append(outcome.Updates, update)
+	}
+	execRecord.HostTagging = outcome
+	return execRecord
+}
+
+func groupingTags(tags []string) []string {
+	prefixed := make([]string, 0, len(tags))
+	for _, t := range tags {
+		prefixed = append(prefixed, groupingTagPrefix+t)
+	}
+	return prefixed
+}
+
+func sortedDeviceIDs(failed map[string]string) []string {
+	ids := make([]string, 0, len(failed))
+	for id := range failed {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
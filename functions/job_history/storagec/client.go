@@ -21,6 +21,8 @@ var NotFound = errors.New("not found")
 
 // StorageC is a custom storage client interface.
 type StorageC interface {
+	// DeleteObject removes a single object identified by the given key, NotFound when there is none.
+	DeleteObject(ctx context.Context, req DeleteObjectRequest) error
 	// BulkFetch returns a multiple objects identified by the given keys in a single call.
 	BulkFetch(ctx context.Context, req BulkFetchObjectsRequest) BulkFetchObjectsResponse
 	// FetchKeys returns a page of object keys in a collection.
@@ -176,6 +178,29 @@ func (f *Client) PutObject(ctx context.Context, req PutObjectRequest) (StoredObj
 	}, nil
 }
 
+func (f *Client) DeleteObject(ctx context.Context, req DeleteObjectRequest) error {
+	params := custom_storage.DeleteObjectParams{
+		Context:        ctx,
+		CollectionName: req.Collection,
+		ObjectKey:      req.ObjectKey,
+	}
+	resp, err := f.c.DeleteObject(&params)
+	// hack to get around limitation of the gofalcon client
+	if err != nil && strings.Contains(strings.ToLower(err.Error()), "status 404") {
+		return NotFound
+	}
+	if err != nil {
+		return err
+	}
+	if resp.IsCode(http.StatusNotFound) {
+		return NotFound
+	}
+	if payload := resp.Payload; payload != nil && len(payload.Errors) > 0 {
+		return fmt.Errorf("errors returned from request: %s", joinMsaAPIErrors(payload.Errors))
+	}
+	return nil
+}
+
 func (f *Client) FetchKeys(ctx context.Context, req FetchKeysRequest) (FetchKeysResponse, error) {
 	params := custom_storage.ListObjectsParams{
 		Context:        ctx,
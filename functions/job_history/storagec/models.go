@@ -60,6 +60,14 @@ type msaError struct {
 	Message string
 }
 
+// DeleteObjectRequest is a request to remove an object from a collection.
+type DeleteObjectRequest struct {
+	// Collection is the name of the collection.
+	Collection string
+	// ObjectKey is the key.
+	ObjectKey string
+}
+
 // PutObjectRequest is a request to upload an object into a collection.
 type PutObjectRequest struct {
 	// Collection is the name of the collection.
@@ -0,0 +1,109 @@
+package webhookc
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// WebhookC is a webhook client interface.
+type WebhookC interface {
+	// Post signs the payload and posts it to the webhook, retrying on network errors, 429 and 5xx responses.
+	Post(ctx context.Context, req PostRequest) error
+}
+
+// Client is the client object.
+type Client struct {
+	backoff     time.Duration
+	hc          *http.Client
+	logger      logrus.FieldLogger
+	maxAttempts int
+	now         func() time.Time
+}
+
+var _ WebhookC = (*Client)(nil)
+
+// NewClient returns a new and initialized instance of a Client.
+func NewClient(hc *http.Client, logger logrus.FieldLogger) *Client {
+	return &Client{
+		backoff:     DefaultBackoff,
+		hc:          hc,
+		logger:      logger,
+		maxAttempts: DefaultMaxAttempts,
+		now:         time.Now,
+	}
+}
+
+func (c *Client) Post(ctx context.Context, req PostRequest) error {
+	var err error
+	backoff := c.backoff
+	for attempt := 1; attempt <= c.maxAttempts; attempt++ {
+		var retry bool
+		retry, err = c.post(ctx, req)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt == c.maxAttempts {
+			break
+		}
+
+		c.logger.WithField("url", req.URL).
+			WithField("attempt", attempt).
+			Warnf("webhook delivery failed, retrying in %s: %s", backoff, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+	return err
+}
+
+// post makes a single delivery attempt and reports whether a failed attempt can be retried.
+func (c *Client) post(ctx context.Context, req PostRequest) (bool, error) {
+	// the payload is signed again on every attempt so that receivers can reject stale timestamps
+	timestamp := strconv.FormatInt(c.now().Unix(), 10)
+
+	hr, err := http.NewRequestWithContext(ctx, http.MethodPost, req.URL, bytes.NewReader(req.Body))
+	if err != nil {
+		return false, fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	hr.Header.Set("Content-Type", "application/json")
+	hr.Header.Set(TimestampHeader, timestamp)
+	hr.Header.Set(SignatureHeader, "sha256="+Sign(req.Secret, timestamp, req.Body))
+	if req.DeliveryID != "" {
+		hr.Header.Set(DeliveryHeader, req.DeliveryID)
+	}
+
+	resp, err := c.hc.Do(hr)
+	if err != nil {
+		return true, fmt.Errorf("failed to post webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("webhook responded with status code: %d", resp.StatusCode)
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of the timestamp and the body, joined by a dot.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,29 @@
+package webhookc
+
+import "time"
+
+const (
+	// SignatureHeader carries the hex encoded HMAC-SHA256 of the timestamp and the body, prefixed by "sha256=".
+	SignatureHeader = "X-Scalable-RTR-Signature"
+	// TimestampHeader carries the unix time at which the payload was signed.
+	TimestampHeader = "X-Scalable-RTR-Timestamp"
+	// DeliveryHeader identifies a payload, it is the same for every attempt of a delivery.
+	DeliveryHeader = "X-Scalable-RTR-Delivery"
+
+	// DefaultMaxAttempts is the number of times a payload is posted before giving up.
+	DefaultMaxAttempts = 3
+	// DefaultBackoff is the delay before the first retry, it doubles with every retry.
+	DefaultBackoff = time.Second
+)
+
+// PostRequest is a signed payload to post to a webhook.
+type PostRequest struct {
+	// Body is the JSON payload.
+	Body []byte
+	// DeliveryID identifies the payload.
+	DeliveryID string
+	// Secret is the HMAC shared secret the payload is signed with.
+	Secret string
+	// URL is the endpoint of the webhook.
+	URL string
+}
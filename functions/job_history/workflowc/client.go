@@ -0,0 +1,195 @@
+package workflowc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/crowdstrike/gofalcon/falcon/client/workflows"
+	"github.com/crowdstrike/gofalcon/falcon/models"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	dateFormat      = "%02d-%02d-%d"
+	timeCycleFormat = "%d %d %d %d *"
+	triggerNodeID   = "trigger"
+)
+
+// WorkflowC represents a workflow client.
+type WorkflowC interface {
+	// Execute starts an on demand workflow of the app, returning the ID of its execution.
+	Execute(ctx context.Context, req ExecuteRequest) (string, error)
+	// Provision provisions a workflow from a template, returning the ID of its definition.
+	Provision(ctx context.Context, req ProvisionRequest) (string, error)
+	// Deprovision removes a provisioned workflow definition.
+	Deprovision(ctx context.Context, definitionID string) error
+}
+
+// Client is the client.
+type Client struct {
+	c      workflows.ClientService
+	logger logrus.FieldLogger
+}
+
+var _ WorkflowC = (*Client)(nil)
+
+// NewClient returns a new workflow client.
+func NewClient(c workflows.ClientService, logger logrus.FieldLogger) *Client {
+	return &Client{
+		c:      c,
+		logger: logger,
+	}
+}
+
+func (c *Client) Execute(ctx context.Context, req ExecuteRequest) (string, error) {
+	name := req.Name
+	executeReq := workflows.NewExecuteParamsWithContext(ctx)
+	executeReq.SetName(&name)
+	if req.Key != "" {
+		key := req.Key
+		executeReq.SetKey(&key)
+	}
+	body := models.MapStringInterface(req.Body)
+	if body == nil {
+		body = map[string]any{}
+	}
+	executeReq.SetBody(body)
+	resp, err := c.c.Execute(executeReq)
+	if err != nil {
+		return "", fmt.Errorf("failed to execute workflow %s: %w", name, err)
+	}
+	payload := resp.GetPayload()
+	if len(payload.Errors) != 0 {
+		msgs := make([]string, 0, len(payload.Errors))
+		for _, e := range payload.Errors {
+			if e.Message != nil {
+				msgs = append(msgs, *e.Message)
+			}
+		}
+		return "", fmt.Errorf("failed to execute workflow %s: %s", name, strings.Join(msgs, ", "))
+	}
+	if len(payload.Resources) == 0 {
+		return "", errors.New("workflow execution returned no execution")
+	}
+	c.logger.WithField("execution_id", payload.Resources[0]).Infof("executed workflow %s", name)
+	return payload.Resources[0], nil
+}
+
+func (c *Client) Provision(ctx context.Context, req ProvisionRequest) (string, error) {
+	name, templateName := req.Name, req.TemplateName
+	params := &models.ParameterTemplateProvisionParameters{
+		Activities: &models.ParameterActivityProvisionParameters{},
+	}
+
+	// nodes are sorted so that provisioning requests are reproducible
+	for _, nodeID := range sortedKeys(req.Activities) {
+		id := nodeID
+		params.Activities.Configuration = append(params.Activities.Configuration, &models.ParameterActivityConfigProvisionParameter{
+			NodeID:     &id,
+			Properties: req.Activities[nodeID],
+		})
+	}
+	for _, nodeID := range sortedKeys(req.Conditions) {
+		id := nodeID
+		condition := &models.ParameterConditionProvisionParameter{NodeID: &id}
+		for _, f := range req.Conditions[nodeID] {
+			fieldName, operator := f.Name, f.Operator
+			condition.Fields = append(condition.Fields, &models.ParameterConditionFieldProvisionParameter{
+				Name:     &fieldName,
+				Operator: &operator,
+				Value:    f.Values,
+			})
+		}
+		params.Conditions = append(params.Conditions, condition)
+	}
+	if !req.RunAt.IsZero() {
+		params.Trigger = runAtTrigger(req.RunAt)
+	}
+
+	provisionReq := workflows.NewProvisionParamsWithContext(ctx)
+	provisionReq.SetBody(&models.ClientSystemDefinitionProvisionRequest{
+		Name:         &name,
+		Parameters:   params,
+		TemplateName: &templateName,
+	})
+	resp, err := c.c.Provision(provisionReq)
+	if err != nil {
+		return "", fmt.Errorf("failed to provision workflow %s: %w", name, err)
+	}
+	payload := resp.GetPayload()
+	if len(payload.Errors) != 0 {
+		msgs := make([]string, 0, len(payload.Errors))
+		for _, e := range payload.Errors {
+			if e.Message != nil {
+				msgs = append(msgs, *e.Message)
+			}
+		}
+		return "", fmt.Errorf("failed to provision workflow %s: %s", name, strings.Join(msgs, ", "))
+	}
+	if len(payload.Resources) == 0 {
+		return "", errors.New("workflow provisioning returned no definition")
+	}
+	c.logger.WithField("definition_id", payload.Resources[0]).Infof("provisioned workflow %s", name)
+	return payload.Resources[0], nil
+}
+
+func (c *Client) Deprovision(ctx context.Context, definitionID string) error {
+	id := definitionID
+	deprovisionAll := false
+	deprovisionReq := workflows.NewDeprovisionParamsWithContext(ctx)
+	deprovisionReq.SetBody(&models.ClientSystemDefinitionDeProvisionRequest{
+		DefinitionID:   &id,
+		DeprovisionAll: &deprovisionAll,
+	})
+	resp, err := c.c.Deprovision(deprovisionReq)
+	if err != nil {
+		return fmt.Errorf("failed to deprovision workflow %s: %w", id, err)
+	}
+	payload := resp.GetPayload()
+	if len(payload.Errors) != 0 {
+		msgs := make([]string, 0, len(payload.Errors))
+		for _, e := range payload.Errors {
+			if e.Message != nil {
+				msgs = append(msgs, *e.Message)
+			}
+		}
+		return fmt.Errorf("failed to deprovision workflow %s: %s", id, strings.Join(msgs, ", "))
+	}
+	c.logger.WithField("definition_id", id).Info("deprovisioned workflow")
+	return nil
+}
+
+// runAtTrigger returns a timer trigger running the workflow once, at the minute of the given time in UTC. Its time
+// cycle only matches the day of the year of the run, so that it does not fire again the next day.
+func runAtTrigger(t time.Time) *models.ParameterTriggerProvisionParameter {
+	t = t.UTC()
+	end := t.AddDate(0, 0, 1)
+	nodeID := triggerNodeID
+	return &models.ParameterTriggerProvisionParameter{
+		NodeID: &nodeID,
+		Fields: map[string]models.ParameterTriggerFieldParameter{
+			"timer_event_definition": {
+				Properties: map[string]any{
+					"end_date":        fmt.Sprintf(dateFormat, end.Month(), end.Day(), end.Year()),
+					"skip_concurrent": false,
+					"start_date":      fmt.Sprintf(dateFormat, t.Month(), t.Day(), t.Year()),
+					"time_cycle":      fmt.Sprintf(timeCycleFormat, t.Minute(), t.Hour(), t.Day(), int(t.Month())),
+					"tz":              time.UTC.String(),
+				},
+			},
+		},
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,47 @@
+package workflowc
+
+import "time"
+
+const (
+	// OperatorIn matches the values of a condition field against the given values.
+	OperatorIn = "IN"
+	// OperatorNotIn matches the values of a condition field not in the given values.
+	OperatorNotIn = "NOT_IN"
+
+	// UndefinedValue is the value of a condition field which is left unused.
+	UndefinedValue = "undefined"
+)
+
+// ExecuteRequest starts an on demand workflow of the app by its name.
+type ExecuteRequest struct {
+	// Body is the input of the on demand trigger of the workflow.
+	Body map[string]any
+	// Key deduplicates executions, executions with the same key start the workflow once.
+	Key string
+	// Name is the name of the workflow.
+	Name string
+}
+
+// ProvisionRequest provisions a workflow from a template of the app.
+type ProvisionRequest struct {
+	// Activities configure the parameterized activities of the template, keyed by node ID.
+	Activities map[string]any
+	// Conditions configure the parameterized conditions of the template, keyed by node ID.
+	Conditions map[string][]ConditionField
+	// Name is the name of the provisioned workflow.
+	Name string
+	// RunAt schedules a single run of the workflow, the workflow is provisioned without a trigger when zero.
+	RunAt time.Time
+	// TemplateName is the name of the workflow template.
+	TemplateName string
+}
+
+// ConditionField is a parameterized field of a condition.
+type ConditionField struct {
+	// Name is the name of the field.
+	Name string
+	// Operator compares the field with the values.
+	Operator string
+	// Values are the values the field is compared with.
+	Values []string
+}
@@ -110,6 +110,75 @@ function Get-RegistryKey{
     }
   }
 }
+function ConvertTo-Version([string]$String){
+  [string[]]$Parts=$String.Trim().Split('.')
+  while($Parts.Count -lt 2){$Parts+='0'}
+  [version]($Parts -join '.')
+}
+function Test-Comparison($Actual,[string]$Operator,$Expected){
+  switch($Operator){
+    'eq' {$Actual -eq $Expected}
+    'ne' {$Actual -ne $Expected}
+    'gt' {$Actual -gt $Expected}
+    'ge' {$Actual -ge $Expected}
+    'lt' {$Actual -lt $Expected}
+    'le' {$Actual -le $Expected}
+    default {$false}
+  }
+}
+function Compare-RegistryValue{
+  param(
+    [Parameter(Mandatory=$true)][string]$Key,[Parameter(Mandatory=$true)][string]$Name,[string]$Type,[string]$Operator,
+    [string]$Expected
+  )
+  [string[]]$Path=$Key.Split('\',2)
+  [uint32]$Hive=switch -Regex ($Path[0]){
+    '^HKEY_CLASSES_ROOT' {2147483648}
+    '^HKEY_CURRENT_USER|HKCU' {2147483649}
+    '^HKEY_LOCAL_MACHINE|HKLM' {2147483650}
+    '^HKEY_USERS|HKU' {2147483651}
+    '^HKEY_CURRENT_CONFIG' {2147483653}
+  }
+  [string]$Method=switch($Type){
+    'REG_DWORD' {'GetDWORDValue'}
+    'REG_QWORD' {'GetQWORDValue'}
+    'REG_MULTI_SZ' {'GetMultiStringValue'}
+    default {'GetStringValue'}
+  }
+  [hashtable]$Result=@{Key=$Key;ValueName=$Name;Exists=$false;Match=$false;Actual=''}
+  [hashtable]$Splat=@{Namespace='root\cimv2';Class='StdRegProv'}
+  $Value=iwmi @Splat -Name $Method @($Hive,$Path[1],$Name)
+  # a missing value and a value of another type are both reported as not existing
+  if(!$Value -or $Value.ReturnValue -ne 0){return $Result}
+  $Result.Exists=$true
+  try{
+    if($Type -eq 'REG_DWORD' -or $Type -eq 'REG_QWORD'){
+      $Result.Actual=[string]$Value.uValue
+      $Result.Match=[bool](Test-Comparison ([uint64]$Value.uValue) $Operator ([uint64]$Expected))
+    }elseif($Type -eq 'REG_MULTI_SZ'){
+      [string[]]$Strings=@($Value.sValue)
+      $Result.Actual=$Strings -join "`n"
+      if($Operator -eq 'contains'){
+        $Result.Match=$Strings -contains $Expected
+      }else{
+        $Result.Match=[bool](Test-Comparison $Result.Actual $Operator ($Expected -replace "`r",$null))
+      }
+    }else{
+      $Result.Actual=[string]$Value.sValue
+      if($Operator -eq 'contains'){
+        $Result.Match=$Result.Actual.IndexOf($Expected,[System.StringComparison]::OrdinalIgnoreCase) -ge 0
+      }elseif($Operator -eq 'eq' -or $Operator -eq 'ne'){
+        $Result.Match=[bool](Test-Comparison $Result.Actual $Operator $Expected)
+      }else{
+        $Result.Match=[bool](Test-Comparison (ConvertTo-Version $Result.Actual) $Operator (ConvertTo-Version $Expected))
+      }
+    }
+  }catch{
+    # data which cannot be converted for the comparison does not match
+    $Result.Match=$false
+  }
+  $Result
+}
 try{
   $Body = @(
   )
@@ -121,6 +190,12 @@ try{
   for ($i=0; $i -lt $Param.keys.Length; $i++)
 {
     $k1 = $Param.keys[$i]
+    # typed comparisons are aligned with the keys, keys without a value name compare the whole value
+    $Name = if($Param.value_names){@($Param.value_names)[$i]}
+    if($Name){
+        $Body += Compare-RegistryValue $k1 $Name @($Param.value_types)[$i] @($Param.operators)[$i] @($Param.data)[$i]
+        continue
+    }
     $answer = Get-RegistryKey $Param.keys[$i]
     $answer=ConvertFrom-Json $answer
     $k2 = ConvertFrom-Json $Param.values[$i]
@@ -0,0 +1,82 @@
+#!/bin/bash
+# Checks if each of the given paths exists and matches the expected attributes, and prints the results as JSON.
+# Input: {"keys": ["/path/one", "/path/two"], "sha256": ["<hex>", ""], "size": ["", "1024"]}
+# The optional sha256 and size arrays are aligned with keys, empty entries are not checked.
+
+json_escape() {
+  local s="$1"
+  s="${s//\\/\\\\}"
+  s="${s//\"/\\\"}"
+  printf '%s' "$s"
+}
+
+# json_array prints the string items of the named array, one per line. jq is not available on every host.
+json_array() {
+  local name="$2"
+  printf '%s' "$1" | grep -o "\"$name\"[[:space:]]*:[[:space:]]*\[\([^]\"]\|\"\([^\"\\\\]\|\\\\.\)*\"\)*\]" |
+    sed -e 's/^[^[]*\[//' | grep -o '"\([^"\\]\|\\.\)*"' | sed -e 's/^"//' -e 's/"$//' -e 's/\\"/"/g' -e 's/\\\\/\\/g'
+}
+
+file_sha256() {
+  shasum -a 256 "$1" 2>/dev/null | awk '{print $1}'
+}
+
+file_size() {
+  stat -f %z "$1" 2>/dev/null
+}
+
+join() {
+  local IFS=,
+  printf '%s' "$*"
+}
+
+input="$1"
+if [ -z "$input" ]; then
+  input='{"keys":[]}'
+fi
+
+# read loops instead of mapfile keep the script compatible with bash 3
+keys=()
+while IFS= read -r line; do keys+=("$line"); done < <(json_array "$input" keys)
+hashes=()
+while IFS= read -r line; do hashes+=("$line"); done < <(json_array "$input" sha256)
+sizes=()
+while IFS= read -r line; do sizes+=("$line"); done < <(json_array "$input" size)
+
+aid=""
+falconctl=/Applications/Falcon.app/Contents/Resources/falconctl
+if [ -x "$falconctl" ]; then
+  aid=$("$falconctl" stats agent_info 2>/dev/null | awk '/agentID:/ {print $2}' | tr -d '-' | tr 'A-F' 'a-f')
+fi
+
+result=""
+for i in "${!keys[@]}"; do
+  key="${keys[$i]}"
+  [ -z "$key" ] && continue
+  exists="False"
+  matched=()
+  mismatched=()
+  if [ -e "$key" ]; then
+    exists="True"
+    expected="${hashes[$i]}"
+    if [ -n "$expected" ]; then
+      if [ "$(file_sha256 "$key")" = "$(printf '%s' "$expected" | tr 'A-F' 'a-f')" ]; then
+        matched+=(sha256)
+      else
+        mismatched+=(sha256)
+      fi
+    fi
+    expected="${sizes[$i]}"
+    if [ -n "$expected" ]; then
+      if [ "$(file_size "$key")" = "$expected" ]; then
+        matched+=(size)
+      else
+        mismatched+=(size)
+      fi
+    fi
+  fi
+  [ -n "$result" ] && result="$result,"
+  result="$result\"$(json_escape "$key")\":{\"Exists\":\"$exists\",\"Matched\":\"$(join "${matched[@]}")\",\"Mismatched\":\"$(join "${mismatched[@]}")\"}"
+done
+
+printf '{"aid":"%s","result":{%s}}\n' "$aid" "$result"
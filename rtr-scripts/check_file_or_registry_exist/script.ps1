@@ -46,6 +46,43 @@ function Get-RegistryKey{
 }
 
 
+function Get-FileSha256{
+  param([Parameter(Mandatory=$true)][string]$Path)
+  $Stream=[System.IO.File]::OpenRead($Path)
+  try{
+    $Sha=[System.Security.Cryptography.SHA256]::Create()
+    ([System.BitConverter]::ToString($Sha.ComputeHash($Stream))).Replace('-',$null).ToLower()
+  }finally{
+    $Stream.Close()
+  }
+}
+
+function Compare-FileAttributes{
+  param(
+    [Parameter(Mandatory=$true)][string]$Path,[string]$Sha256,[string]$Size,[string]$Version
+  )
+  $Matched=@()
+  $Mismatched=@()
+  $Item=Get-Item -LiteralPath $Path -Force -ErrorAction SilentlyContinue
+  if($Sha256){
+    $Actual=$null
+    if($Item -and !$Item.PSIsContainer){$Actual=Get-FileSha256 $Item.FullName}
+    if($Actual -eq $Sha256.ToLower()){$Matched+='sha256'}else{$Mismatched+='sha256'}
+  }
+  if($Size){
+    if($Item -and !$Item.PSIsContainer -and $Item.Length -eq [int64]$Size){$Matched+='size'}else{$Mismatched+='size'}
+  }
+  if($Version){
+    $Actual=$null
+    if($Item -and !$Item.PSIsContainer){
+      $Info=$Item.VersionInfo
+      $Actual='{0}.{1}.{2}.{3}' -f $Info.FileMajorPart,$Info.FileMinorPart,$Info.FileBuildPart,$Info.FilePrivatePart
+    }
+    if($Actual -eq $Version){$Matched+='version'}else{$Mismatched+='version'}
+  }
+  @{Matched=($Matched -join ',');Mismatched=($Mismatched -join ',')}
+}
+
 try{
   if($PSVersionTable.PSVersion.ToString() -lt 3.0){
     Add-Type -AssemblyName System.Web.Extensions
@@ -53,10 +90,23 @@ try{
   }
   if($args[0]){$Param=Convert-Json $args[0]}
   $Applications=@{}
-  foreach($obj in $Param.keys)
+  $Keys=@($Param.keys)
+  for($i=0;$i -lt $Keys.Count;$i++)
 {
+    $obj=$Keys[$i]
     $Applications[$obj] = @{
         Exists = Get-RegistryKey $obj
+        Matched = ''
+        Mismatched = ''
+    }
+    # expected attributes are aligned with the keys, empty entries are not checked
+    $Sha256=if($Param.sha256){@($Param.sha256)[$i]}
+    $Size=if($Param.size){@($Param.size)[$i]}
+    $Version=if($Param.version){@($Param.version)[$i]}
+    if($Applications[$obj].Exists -eq 'True' -and ($Sha256 -or $Size -or $Version)){
+        $Comparison = Compare-FileAttributes $obj $Sha256 $Size $Version
+        $Applications[$obj].Matched = $Comparison.Matched
+        $Applications[$obj].Mismatched = $Comparison.Mismatched
     }
 }
 Write-Json (Format-Result $Applications)
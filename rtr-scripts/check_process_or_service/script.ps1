@@ -0,0 +1,61 @@
+function Find-Process{
+  param([string]$Name,[string]$Path)
+  @(Get-WmiObject -Namespace root\cimv2 -Class Win32_Process -ErrorAction SilentlyContinue|?{
+    (!$Name -or $_.Name -like $Name -or $_.Name -like "$Name.exe") -and
+      (!$Path -or ($_.ExecutablePath -and $_.ExecutablePath -like $Path))
+  })
+}
+function Find-Service{
+  param([string]$Name,[string]$Path)
+  @(Get-WmiObject -Namespace root\cimv2 -Class Win32_Service -ErrorAction SilentlyContinue|?{
+    # the path name may be quoted and carry arguments
+    [string]$Executable=$_.PathName -replace '^"([^"]*)".*$','$1'
+    (!$Name -or $_.Name -like $Name -or $_.DisplayName -like $Name) -and
+      (!$Path -or ($Executable -and ($Executable -like $Path -or $_.PathName -like $Path)))
+  })
+}
+try{
+  $Body = @(
+  )
+  if($args[0]){$Param=ConvertFrom-Json $args[0]}
+  [string[]]$Names=@($Param.names)
+  [string[]]$Paths=@($Param.paths)
+  [string[]]$States=@($Param.states)
+  $Count=[math]::Max($Names.Count,$Paths.Count)
+  for ($i=0; $i -lt $Count; $i++)
+{
+    $Name=if($i -lt $Names.Count){$Names[$i]}
+    $Path=if($i -lt $Paths.Count){$Paths[$i]}
+    if(!$Name -and !$Path){continue}
+    if($Param.kind -eq 'service'){
+      $Found=Find-Service $Name $Path
+      $Running=@($Found|?{$_.State -eq 'Running'})
+      $State=if($Running.Count -gt 0){'running'}elseif($Found.Count -gt 0){'stopped'}else{'absent'}
+      $Expected=if($i -lt $States.Count -and $States[$i]){$States[$i]}else{'installed'}
+      $Body += @{
+        Name=$Name
+        Path=$Path
+        Found=if($Expected -eq 'running'){$Running.Count -gt 0}else{$Found.Count -gt 0}
+        State=$State
+        Matches=[string[]]@($Found|%{$_.Name}|sort -Unique)
+      }
+    }else{
+      $Found=Find-Process $Name $Path
+      $Body += @{
+        Name=$Name
+        Path=$Path
+        Found=$Found.Count -gt 0
+        State=if($Found.Count -gt 0){'running'}else{'absent'}
+        Matches=[string[]]@($Found|%{$_.Name}|sort -Unique)
+      }
+    }
+}
+$jsonResponse = @{
+    result=$Body
+}
+$jsonResponse = $jsonResponse | ConvertTo-Json -Depth 4
+Write-Output $jsonResponse
+}catch{
+$_.Exception | Format-List -Force
+  throw $_
+}
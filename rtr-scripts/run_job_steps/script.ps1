@@ -0,0 +1,86 @@
+function Invoke-Step{
+  param([string]$Type,[string]$Target,[string]$ValueName)
+  switch($Type){
+    'check_file'{
+      if(!(Test-Path -LiteralPath $Target -PathType Leaf)){throw "file not found: $Target"}
+      'exists'
+    }
+    'hash_file'{
+      if(!(Test-Path -LiteralPath $Target -PathType Leaf)){throw "file not found: $Target"}
+      $Stream=[System.IO.File]::OpenRead($Target)
+      try{
+        $Sha256=[System.Security.Cryptography.SHA256]::Create()
+        ([System.BitConverter]::ToString($Sha256.ComputeHash($Stream))).Replace('-',$null).ToLower()
+      }finally{
+        $Stream.Dispose()
+      }
+    }
+    'remove_file'{
+      if(!(Test-Path -LiteralPath $Target -PathType Leaf)){'already absent';return}
+      Remove-Item -LiteralPath $Target -Force -ErrorAction Stop
+      'removed'
+    }
+    'verify_removed'{
+      if(Test-Path -LiteralPath $Target){throw "file still exists: $Target"}
+      'absent'
+    }
+    'check_registry'{
+      $Path='Registry::'+($Target -replace '^(HKLM|HKEY_LOCAL_MACHINE):?\\','HKEY_LOCAL_MACHINE\' -replace '^(HKCU|HKEY_CURRENT_USER):?\\','HKEY_CURRENT_USER\' -replace '^(HKU|HKEY_USERS):?\\','HKEY_USERS\' -replace '^(HKCR|HKEY_CLASSES_ROOT):?\\','HKEY_CLASSES_ROOT\')
+      $Key=Get-Item -LiteralPath $Path -ErrorAction Stop
+      $Name=if($ValueName){$ValueName}else{''}
+      if($Key.GetValueNames() -notcontains $Name){throw "registry value not found: $Target\$ValueName"}
+      [string]($Key.GetValue($Name) -join ',')
+    }
+    'check_process'{
+      $Found=@(Get-Process -Name ($Target -replace '\.exe$',$null) -ErrorAction SilentlyContinue)
+      if($Found.Count -eq 0){throw "process not running: $Target"}
+      "$($Found.Count) running"
+    }
+    default{throw "unknown step type: $Type"}
+  }
+}
+try{
+  $Body = @(
+  )
+  if($args[0]){$Param=ConvertFrom-Json $args[0]}
+  [string[]]$Names=@($Param.names)
+  [string[]]$Types=@($Param.types)
+  [string[]]$Targets=@($Param.targets)
+  [string[]]$ValueNames=@($Param.value_names)
+  [string[]]$Continue=@($Param.continue_on_failure)
+  $Aborted=$false
+  for ($i=0; $i -lt $Types.Count; $i++)
+{
+    $Step=@{
+      Index=$i+1
+      Name=if($i -lt $Names.Count -and $Names[$i]){$Names[$i]}else{"$($i+1). $($Types[$i])"}
+      Type=$Types[$i]
+      Target=if($i -lt $Targets.Count){$Targets[$i]}
+    }
+    # the steps left after a failure are skipped unless the failed step continues on failure
+    if($Aborted){
+      $Step.Status='skipped'
+      $Body += $Step
+      continue
+    }
+    try{
+      $ValueName=if($i -lt $ValueNames.Count){$ValueNames[$i]}
+      $Step.Output=[string](Invoke-Step $Types[$i] $Step.Target $ValueName)
+      $Step.Status='completed'
+    }catch{
+      $Step.Status='failed'
+      $Step.Error=$_.Exception.Message
+      if(!($i -lt $Continue.Count -and $Continue[$i] -eq 'true')){$Aborted=$true}
+    }
+    $Body += $Step
+}
+$jsonResponse = @{
+    aborted=$Aborted
+    result=$Body
+}
+$jsonResponse = $jsonResponse | ConvertTo-Json -Depth 4
+Write-Output $jsonResponse
+}catch{
+$_.Exception | Format-List -Force
+  throw $_
+}